@@ -0,0 +1,146 @@
+// Package cron runs recurring jobs on exactly one of many hosts sharing a mutex root directory.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+// A markerSuffix is appended to the lock file name to name the file recording the last run of a job.
+const markerSuffix = ".last-run"
+
+// RunExclusive runs the job every interval on exactly one of the processes (and hosts) calling it
+// with the same root and id, until the context is done. The job runs while holding the mutex id,
+// and its start time is recorded in a marker file next to the lock file, so other processes skip
+// the interval. A failed job is not recorded, so it is retried at the next check of any of the processes.
+// The context passed to the job is canceled, if the lock is lost while the job runs; the run is not recorded then.
+// Errors of the job, of locking and of the marker file are ignored, see RunExclusiveExt to handle them.
+// Returns the context error, or an error of the interval or the mutex id.
+func RunExclusive(ctx context.Context, root string, id string, every time.Duration,
+	job func(ctx context.Context) error, opts ...mutex.Option) error {
+	return RunExclusiveExt(ctx, root, id, every, job, nil, opts...)
+}
+
+// RunExclusiveExt runs the job like RunExclusive, reporting errors to the handler (if not nil):
+// an error of the job (wrapped), an error of locking (mutex.ErrLockLost, if the lock has been lost)
+// or of the marker file. Processing continues at the next check after each error.
+func RunExclusiveExt(ctx context.Context, root string, id string, every time.Duration,
+	job func(ctx context.Context) error, handler func(err error), opts ...mutex.Option) error {
+	if every <= 0 {
+		return errors.New("interval of a job must be positive")
+	}
+	pulse := mutex.DefaultPulse
+	if every/10 < pulse {
+		pulse = every / 10
+	}
+	m, err := mutex.NewMutexExt(root, id, pulse, mutex.DefaultRefresh, mutex.DefaultDeadTimeout, opts...)
+	if err != nil {
+		return err
+	}
+	marker := m.LockPath() + markerSuffix
+	for {
+		next, err := runDue(ctx, m, marker, every, job)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if handler != nil {
+				handler(err)
+			}
+			next = time.Now().Add(every)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// runDue runs the job under the lock of the mutex, if it has not been run within the last interval.
+// Times of runs are taken from the modification time of the lock file, which is written on acquisition,
+// so hosts sharing the root compare them by the clock of the file system rather than by their own clocks.
+// Returns the time of the next check by the local clock.
+func runDue(ctx context.Context, m *mutex.Mutex, marker string, every time.Duration,
+	job func(ctx context.Context) error) (time.Time, error) {
+	if err := m.LockWithContext(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("cannot lock job %s: %w", m.Id(), err)
+	}
+	defer m.TryUnlock() // may fail, if the lock has been lost
+	info, err := os.Stat(m.LockPath())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read start of job %s: %w", m.Id(), err)
+	}
+	start := info.ModTime()
+	// Translates a time by the clock of the file system to the local clock
+	local := func(tm time.Time) time.Time {
+		return time.Now().Add(tm.Sub(start))
+	}
+	last, err := readMarker(marker)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !last.IsZero() && start.Sub(last) < every {
+		return local(last.Add(every)), nil
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := m.KeepAlive(jobCtx)
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-jobCtx.Done():
+		}
+	}()
+	jobErr := job(jobCtx)
+	// Not recorded, if the lock has been lost meanwhile, as another process may be running the job already
+	if err := m.Touch(); err != nil {
+		return time.Time{}, fmt.Errorf("lock of job %s lost: %w", m.Id(), err)
+	}
+	if jobErr != nil {
+		return time.Time{}, fmt.Errorf("job %s failed: %w", m.Id(), jobErr)
+	}
+	return local(start.Add(every)), writeMarker(marker, start)
+}
+
+// readMarker returns the time recorded in the marker file or zero time, if it does not exist.
+func readMarker(fileName string) (time.Time, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	result, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("corrupted marker file %s: %w", fileName, err)
+	}
+	return result, nil
+}
+
+// writeMarker atomically records the time in the marker file.
+func writeMarker(fileName string, tm time.Time) error {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprintln(f, tm.UTC().Format(time.RFC3339Nano))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fileName)
+	}
+	return err
+}
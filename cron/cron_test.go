@@ -0,0 +1,134 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+func temporaryCatalog(t *testing.T) string {
+	tempDir, err := os.MkdirTemp("", "temp-*.dir")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			t.Errorf("error removing temporary directory: %v", err)
+		}
+	})
+	return tempDir
+}
+
+func TestRunExclusive(t *testing.T) {
+	const jobId = "cron-test-job"
+	const every = 200 * time.Millisecond
+	root := temporaryCatalog(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*every+every/2)
+	defer cancel()
+	var runs int32
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := RunExclusive(ctx, root, jobId, every, func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			})
+			if err != context.DeadlineExceeded {
+				t.Errorf("wrong result %v instead of %v", err, context.DeadlineExceeded)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&runs); got != 4 {
+		t.Fatalf("wrong number of runs %d instead of %d", got, 4)
+	}
+}
+
+func TestRunExclusiveFailed(t *testing.T) {
+	const jobId = "cron-failed-test-job"
+	const every = 100 * time.Millisecond
+	root := temporaryCatalog(t)
+	m, err := mutex.NewMutex(root, jobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*every+every/2)
+	defer cancel()
+	failure := errors.New("job failure")
+	var runs int
+	var failures []error
+	err = RunExclusiveExt(ctx, root, jobId, every, func(ctx context.Context) error {
+		if runs++; runs <= 2 {
+			return failure
+		}
+		return nil
+	}, func(err error) {
+		if _, statErr := os.Stat(m.LockPath() + markerSuffix); !os.IsNotExist(statErr) {
+			t.Errorf("a failed job has been recorded (%v)", statErr)
+		}
+		failures = append(failures, err)
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("wrong result %v instead of %v", err, context.DeadlineExceeded)
+	}
+	if len(failures) != 2 || !errors.Is(failures[0], failure) || !errors.Is(failures[1], failure) {
+		t.Fatalf("wrong reported errors %v", failures)
+	}
+	if runs != 3 {
+		t.Fatalf("wrong number of runs %d instead of %d", runs, 3)
+	}
+	if _, err := os.Stat(m.LockPath() + markerSuffix); err != nil {
+		t.Fatalf("a retried job has not been recorded (%v)", err)
+	}
+}
+
+func TestRunExclusiveLost(t *testing.T) {
+	const jobId = "cron-lost-test-job"
+	const every = 100 * time.Millisecond
+	root := temporaryCatalog(t)
+	m, err := mutex.NewMutex(root, jobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), every+every/2)
+	defer cancel()
+	var runs int
+	var failures []error
+	err = RunExclusiveExt(ctx, root, jobId, every, func(ctx context.Context) error {
+		if runs++; runs == 1 {
+			// The lock broken by another process
+			return os.Remove(m.LockPath())
+		}
+		return nil
+	}, func(err error) {
+		if _, statErr := os.Stat(m.LockPath() + markerSuffix); !os.IsNotExist(statErr) {
+			t.Errorf("a job run after the loss of the lock has been recorded (%v)", statErr)
+		}
+		failures = append(failures, err)
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("wrong result %v instead of %v", err, context.DeadlineExceeded)
+	}
+	if len(failures) != 1 || !errors.Is(failures[0], mutex.ErrLockLost) {
+		t.Fatalf("wrong reported errors %v instead of %v", failures, mutex.ErrLockLost)
+	}
+	if runs != 2 {
+		t.Fatalf("wrong number of runs %d instead of %d", runs, 2)
+	}
+}
+
+func TestRunExclusiveInterval(t *testing.T) {
+	err := RunExclusive(context.Background(), temporaryCatalog(t), "cron-interval-test-job", 0,
+		func(ctx context.Context) error { return nil })
+	if err == nil {
+		t.Fatal("zero interval should be rejected")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+// metricsPath is the path at which the exporter serves metrics.
+const metricsPath = "/metrics"
+
+// doExporter serves metrics of mutexes matching the -id pattern in the Prometheus text format,
+// scraping the root on each request. The socket passed by systemd socket activation, if any, replaces -listen.
+// With -statsd, the metrics are also sent to a statsd server every -interval; an empty -listen
+// disables serving them over HTTP.
+func doExporter() int {
+	mgr := newManager(mutex.WithLazyInit())
+	listener, err := sdListener()
+	if err != nil {
+		fatalf(cmn.Id, "Cannot use socket passed by systemd: %v", err)
+	}
+	if exp.Statsd != "" {
+		sink := mutex.NewStatsd(exp.Statsd, exp.StatsdPrefix, splitTags(exp.StatsdTags)...)
+		infof(cmn.Id, "Sending metrics of mutexes \"%s\" to statsd at %s every %v", cmn.Id, exp.Statsd, exp.Interval)
+		if listener == nil && exp.Listen == "" {
+			if err := sdNotify("READY=1"); err != nil {
+				warnf(cmn.Id, "Cannot notify systemd: %v", err)
+			}
+			pushMetrics(mgr, sink)
+			return 0
+		}
+		go pushMetrics(mgr, sink)
+	}
+	http.Handle(metricsPath, metricsHandler(mgr))
+	if listener == nil {
+		if listener, err = net.Listen("tcp", exp.Listen); err != nil {
+			fatalf(cmn.Id, "Cannot serve metrics at %s: %v", exp.Listen, err)
+		}
+	}
+	infof(cmn.Id, "Serving metrics of mutexes \"%s\" at %s%s", cmn.Id, listener.Addr(), metricsPath)
+	if err := sdNotify("READY=1"); err != nil {
+		warnf(cmn.Id, "Cannot notify systemd: %v", err)
+	}
+	if err := http.Serve(listener, nil); err != nil {
+		fatalf(cmn.Id, "Cannot serve metrics at %s: %v", listener.Addr(), err)
+	}
+	return 0
+}
+
+// A mutexSample holds the state of a mutex observed during a scrape.
+type mutexSample struct {
+	id      string
+	locked  bool
+	age     time.Duration
+	waiters int
+	stale   bool
+}
+
+// metricsHandler returns a handler writing metrics of mutexes of the Manager, matching the -id pattern.
+func metricsHandler(mgr *mutex.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		samples, err := scrape(mgr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, samples)
+	})
+}
+
+// scrape returns samples of mutexes of the Manager, matching the -id pattern.
+func scrape(mgr *mutex.Manager) ([]mutexSample, error) {
+	ids, err := mgr.List(cmn.Id)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]mutexSample, 0, len(ids))
+	for _, id := range ids {
+		m, err := mgr.Listed(id)
+		if err != nil {
+			return nil, err
+		}
+		s := mutexSample{id: id, stale: m.Stale()}
+		if tm := m.When(); !tm.IsZero() {
+			s.locked = true
+			s.age = time.Since(tm)
+		}
+		if s.waiters, err = m.Waiters(); err != nil {
+			warnf(id, "Cannot count waiters of mutex \"%s\": %v", id, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// gauges are metrics of a mutexSample, named as in the Prometheus text format;
+// names sent to statsd omit the "fmutex_" prefix, which is replaced by -statsd-prefix.
+var gauges = []struct {
+	name  string
+	help  string
+	value func(s mutexSample) float64
+}{
+	{"fmutex_locked", "Whether the mutex is locked (1) or not (0).",
+		func(s mutexSample) float64 { return boolValue(s.locked) }},
+	{"fmutex_lock_age_seconds", "How long the mutex has been locked, 0 if it is not.",
+		func(s mutexSample) float64 { return s.age.Seconds() }},
+	{"fmutex_waiters", "Number of processes waiting for the mutex.",
+		func(s mutexSample) float64 { return float64(s.waiters) }},
+	{"fmutex_stale", "Whether the mutex is locked, but not refreshed for longer than its lease (1) or not (0).",
+		func(s mutexSample) float64 { return boolValue(s.stale) }},
+}
+
+// writeMetrics writes gauges of the samples in the Prometheus text format.
+func writeMetrics(w io.Writer, samples []mutexSample) {
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, s := range samples {
+			fmt.Fprintf(w, "%s{id=\"%s\"} %g\n", g.name, labelEscaper.Replace(s.id), g.value(s))
+		}
+	}
+}
+
+// pushMetrics sends gauges of mutexes of the Manager, matching the -id pattern, to the statsd sink
+// every -interval. It never returns.
+func pushMetrics(mgr *mutex.Manager, sink *mutex.Statsd) {
+	for {
+		samples, err := scrape(mgr)
+		if err != nil {
+			warnf(cmn.Id, "Cannot scrape mutexes \"%s\": %v", cmn.Id, err)
+		} else if err := sendMetrics(sink, samples); err != nil {
+			warnf(cmn.Id, "Cannot send metrics to statsd at %s: %v", sink.Addr, err)
+		}
+		time.Sleep(exp.Interval)
+	}
+}
+
+// sendMetrics sends gauges of the samples to the statsd sink, tagged with their ids.
+func sendMetrics(sink *mutex.Statsd, samples []mutexSample) error {
+	for _, g := range gauges {
+		for _, s := range samples {
+			if err := sink.Gauge(strings.TrimPrefix(g.name, "fmutex_"), g.value(s), "id:"+s.id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// splitTags returns tags of a comma-separated list, e.g. "env:prod,team:batch".
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// labelEscaper escapes label values of the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
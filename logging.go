@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+const (
+	levelInfo    = "info"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// A logRecord is a log line in the JSON format.
+type logRecord struct {
+	Time   time.Time    `json:"time"`
+	Level  string       `json:"level"`
+	Id     string       `json:"id,omitempty"`
+	Msg    string       `json:"msg,omitempty"`
+	Status string       `json:"status,omitempty"`
+	Event  *mutex.Event `json:"event,omitempty"`
+}
+
+func (r *logRecord) String() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Sprintf(`{"level":"error","msg":%q}`, err.Error())
+	}
+	return string(b)
+}
+
+// logf logs the message related to the mutex id in the format given by the -log-format flag.
+func logf(level string, id string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if cmn.LogFormat != LogFormatJson {
+		if level == levelWarning {
+			msg = "Warning: " + msg
+		}
+		log.Print(msg)
+		return
+	}
+	fmt.Fprintln(log.Writer(), (&logRecord{Time: time.Now(), Level: level, Id: id, Msg: msg}).String())
+}
+
+func infof(id string, format string, args ...interface{}) {
+	logf(levelInfo, id, format, args...)
+}
+
+func warnf(id string, format string, args ...interface{}) {
+	logf(levelWarning, id, format, args...)
+}
+
+func errorf(id string, format string, args ...interface{}) {
+	logf(levelError, id, format, args...)
+}
+
+// fatalf logs the error and exits.
+func fatalf(id string, format string, args ...interface{}) {
+	logf(levelError, id, format, args...)
+	exit(1)
+}
+
+// logMutexEvent logs the mutex event.
+func logMutexEvent(e mutex.Event) {
+	if cmn.LogFormat != LogFormatJson {
+		log.Printf("Mutex event: %v", e)
+		return
+	}
+	level := levelInfo
+	if e.Err != nil {
+		level = levelWarning
+	}
+	fmt.Fprintln(log.Writer(), (&logRecord{Time: e.Time, Level: level, Id: e.Id, Event: &e}).String())
+}
+
+// report prints the status of a successful operation on the mutex to the standard output,
+// followed by the details in the text format.
+func report(id string, status string, details ...string) {
+	if cmn.LogFormat != LogFormatJson {
+		fmt.Println(strings.Join(append([]string{status}, details...), " "))
+		return
+	}
+	fmt.Println((&logRecord{Time: time.Now(), Level: levelInfo, Id: id, Status: status}).String())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestJsonLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	cmn.LogFormat = LogFormatJson
+	defer func() {
+		log.SetOutput(os.Stderr)
+		cmn.LogFormat = LogFormatText
+	}()
+	warnf("test-log", "something %s", "odd")
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("cannot decode log line \"%s\": %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{"level": levelWarning, "id": "test-log", "msg": "something odd"} {
+		if got, _ := record[key].(string); got != want {
+			t.Fatalf("wrong %s \"%s\" instead of \"%s\"", key, got, want)
+		}
+	}
+}
+
+func TestTextLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	prefix := log.Prefix()
+	log.SetPrefix("")
+	defer log.SetPrefix(prefix)
+	warnf("test-log", "something %s", "odd")
+	if got, want := buf.String(), "Warning: something odd\n"; got != want {
+		t.Fatalf("wrong log line \"%s\" instead of \"%s\"", got, want)
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,30 +21,197 @@ import (
 )
 
 const (
-	FlagRoot    = "root"
-	EnvRoot     = "FMUTEX_ROOT"
-	FlagId      = "id"
-	FlagSilent  = "s"
-	FlagPulse   = "pulse"
-	FlagRefresh = "refresh"
-	FlagLimit   = "limit"
-	FlagTimeout = "timeout"
+	FlagRoot         = "root"
+	EnvRoot          = "FMUTEX_ROOT"
+	EnvSecret        = "FMUTEX_SECRET"
+	EnvNamespace     = "FMUTEX_NAMESPACE"
+	FlagId           = "id"
+	FlagSilent       = "s"
+	FlagHash         = "hash"
+	FlagLockFile     = "lock-file"
+	FlagCandidates   = "candidates"
+	FlagDirMode      = "dir-mode"
+	FlagFileMode     = "file-mode"
+	FlagShared       = "shared"
+	FlagXattr        = "xattr"
+	FlagDurable      = "durable"
+	FlagMtime        = "mtime"
+	FlagTmpFile      = "tmp-file"
+	FlagCifs         = "cifs"
+	FlagSharded      = "sharded"
+	FlagOutput       = "output"
+	FlagToSharded    = "to-sharded"
+	FlagSkew         = "skew"
+	FlagDotLock      = "dot-lock"
+	FlagOwner        = "owner"
+	FlagMessage      = "message"
+	FlagWebhook      = "webhook"
+	FlagMirror       = "mirror"
+	FlagStealOlder   = "steal-if-older-than"
+	FlagProbeDir     = "probe-dir"
+	FlagStrict       = "strict"
+	FlagIfOwner      = "if-owner"
+	FlagLogFormat    = "log-format"
+	FlagPulse        = "pulse"
+	FlagMaxPulse     = "max-pulse"
+	FlagRefresh      = "refresh"
+	FlagLimit        = "limit"
+	FlagTimeout      = "timeout"
+	FlagMaxAge       = "max-age"
+	FlagMinAge       = "min-age"
+	FlagHolderHost   = "holder-host"
+	FlagSort         = "sort"
+	FlagGrace        = "grace"
+	FlagPidFile      = "pid-file"
+	FlagWaitLocked   = "wait-locked"
+	FlagWaitUnlocked = "wait-unlocked"
+	FlagFrom         = "from"
+	FlagTo           = "to"
+	FlagCopyHeld     = "copy-held"
+	FlagListen       = "listen"
+	FlagStatsd       = "statsd"
+	FlagStatsdPrefix = "statsd-prefix"
+	FlagStatsdTags   = "statsd-tags"
+	FlagExpect       = "expect"
+	FlagInterval     = "interval"
+	FlagOlderThan    = "older-than"
+	FlagSdNotify     = "sd-notify"
+	FlagLong         = "l"
+	FlagLabel        = "label"
+	FlagSelector     = "selector"
+	FlagVerbose      = "v"
+	FlagVVerbose     = "vv"
 )
 
 var cmn = struct { // Common flags
-	Root   string
-	Id     string
-	Silent bool
+	Root       string
+	Id         string
+	Silent     bool
+	Hash       bool
+	LockFile   string
+	Candidates string
+	DirMode    fileMode
+	FileMode   fileMode
+	Shared     bool
+	Xattr      bool
+	Durable    bool
+	Mtime      bool
+	TmpFile    bool
+	Cifs       bool
+	Sharded    bool
+	Skew       time.Duration
+	DotLock    string
+	Owner      string
+	Message    string
+	Webhook    string
+	Mirror     string
+	LogFormat  string
 }{
-	Root:   ifEmptyStr(os.Getenv(EnvRoot), os.TempDir()),
-	Silent: false,
+	Root:      ifEmptyStr(os.Getenv(EnvRoot), os.TempDir()),
+	Silent:    false,
+	DirMode:   fileMode(mutex.DefaultDirMode),
+	FileMode:  fileMode(mutex.DefaultFileMode),
+	Skew:      mutex.DefaultClockSkewThreshold,
+	LogFormat: LogFormatText,
+}
+
+var wdg = struct { // Watchdog flags
+	MaxAge time.Duration
+}{
+	MaxAge: time.Hour,
+}
+
+var rl = struct { // Release flags
+	IfOwner string
+}{}
+
+var ls = struct { // List flags
+	Long       bool
+	Selector   labels
+	Sort       string
+	MinAge     time.Duration
+	HolderHost string
+}{}
+
+const (
+	SortId      = "id"
+	SortAge     = "age"
+	SortWaiters = "waiters"
+)
+
+var out = struct { // Output flags of list and info
+	Format string
+}{
+	Format: OutputText,
+}
+
+var tst = struct { // Test flags
+	WaitLocked   bool
+	WaitUnlocked bool
+	Timeout      time.Duration
+}{}
+
+var mr = struct { // Migrate-root flags
+	From      string
+	To        string
+	CopyHeld  bool
+	ToSharded bool
+}{}
+
+var exp = struct { // Exporter flags
+	Listen       string
+	Statsd       string
+	StatsdPrefix string
+	StatsdTags   string
+	Interval     time.Duration
+}{
+	Listen:       ":9234",
+	StatsdPrefix: mutex.DefaultStatsdPrefix,
+	Interval:     10 * time.Second,
+}
+
+// Expected states of the healthcheck command
+const (
+	ExpectHeldByMe = "held-by-me"
+	ExpectFree     = "free"
+	ExpectFresh    = "fresh"
+)
+
+var hc = struct { // Healthcheck flags
+	Expect string
+}{
+	Expect: ExpectHeldByMe,
+}
+
+var swp = struct { // GC flags
+	Interval  time.Duration
+	OlderThan time.Duration
+	Selector  labels
+}{
+	Interval:  5 * time.Minute,
+	OlderThan: 2 * time.Hour,
+}
+
+var rn = struct { // Run flags
+	Grace    time.Duration
+	PidFile  string
+	SdNotify bool
+}{
+	Grace: 10 * time.Second,
 }
 
 var lck = struct { // Lock flags
-	Pulse   time.Duration
-	Refresh time.Duration
-	Limit   time.Duration
-	Timeout time.Duration
+	Pulse    time.Duration
+	MaxPulse time.Duration
+	Refresh  time.Duration
+	Limit    time.Duration
+	Timeout  time.Duration
+	Verbose  bool
+	VVerbose bool
+	Labels   labels
+	Steal    time.Duration
+	ProbeDir string
+	Strict   bool
 }{
 	Pulse:   mutex.DefaultPulse,
 	Refresh: mutex.DefaultRefresh,
@@ -45,18 +219,48 @@ var lck = struct { // Lock flags
 }
 
 const (
-	CmdLock    = "lock"
-	CmdRelease = "release"
-	CmdUnlock  = "unlock" // An alias to CmdRelease
-	CmdTest    = "test"
+	CmdLock        = "lock"
+	CmdRelease     = "release"
+	CmdUnlock      = "unlock" // An alias to CmdRelease
+	CmdTest        = "test"
+	CmdList        = "list"
+	CmdMigrate     = "migrate"
+	CmdAdopt       = "adopt"
+	CmdRenew       = "renew"
+	CmdReaders     = "readers"
+	CmdWatchdog    = "watchdog"
+	CmdInfo        = "info"
+	CmdRun         = "run"
+	CmdExport      = "export"
+	CmdImport      = "import"
+	CmdMigrateRoot = "migrate-root"
+	CmdExporter    = "exporter"
+	CmdHealthcheck = "healthcheck"
+	CmdGc          = "gc"
+	CmdReconcile   = "reconcile"
 )
 
 var (
-	cmdLock    *flag.FlagSet
-	cmdRelease *flag.FlagSet
-	cmdTest    *flag.FlagSet
-	cmdAll     []*flag.FlagSet
-	cmdNames   []string
+	cmdLock        *flag.FlagSet
+	cmdRelease     *flag.FlagSet
+	cmdTest        *flag.FlagSet
+	cmdList        *flag.FlagSet
+	cmdMigrate     *flag.FlagSet
+	cmdAdopt       *flag.FlagSet
+	cmdRenew       *flag.FlagSet
+	cmdReaders     *flag.FlagSet
+	cmdWatchdog    *flag.FlagSet
+	cmdInfo        *flag.FlagSet
+	cmdRun         *flag.FlagSet
+	cmdExport      *flag.FlagSet
+	cmdImport      *flag.FlagSet
+	cmdMigrateRoot *flag.FlagSet
+	cmdExporter    *flag.FlagSet
+	cmdHealthcheck *flag.FlagSet
+	cmdGc          *flag.FlagSet
+	cmdReconcile   *flag.FlagSet
+	cmdAll         []*flag.FlagSet
+	cmdNames       []string
 )
 
 func init() {
@@ -64,94 +268,972 @@ func init() {
 	log.SetPrefix(fmt.Sprintf("%s: ", getProg(os.Args)))
 
 	flag.Usage = usage
-	flag.StringVar(&cmn.Root, FlagRoot, cmn.Root, "root directory for mutex(es)")
-	flag.StringVar(&cmn.Id, FlagId, cmn.Id, "mutex id")
+	flag.StringVar(&cmn.Root, FlagRoot, cmn.Root, fmt.Sprintf(
+		"root directory for mutex(es), or a \"%c\" separated list of roots to fail over to, in order", os.PathListSeparator))
+	flag.StringVar(&cmn.Id, FlagId, cmn.Id, "mutex id, for test, release, list (also a glob), migrate, watchdog, export, import, exporter and gc may be a pattern like \"tenantA/...\"")
 	flag.BoolVar(&cmn.Silent, FlagSilent, cmn.Silent, "silent execution")
+	flag.BoolVar(&cmn.Hash, FlagHash, cmn.Hash, "hash mutex id, so it may be an arbitrary string (URL, path, etc.)")
+	flag.StringVar(&cmn.LockFile, FlagLockFile, cmn.LockFile, "lock file name template, \"%s\" stands for the mutex name (e.g. \"%s.lock\")")
+	flag.Var(&cmn.DirMode, FlagDirMode, "permissions (octal) of created mutex directories")
+	flag.Var(&cmn.FileMode, FlagFileMode, "permissions (octal) of lock and candidate files")
+	flag.BoolVar(&cmn.Shared, FlagShared, cmn.Shared, "share mutexes between users of a common group (overrides -dir-mode and -file-mode)")
+	flag.BoolVar(&cmn.Xattr, FlagXattr, cmn.Xattr, "keep timestamps in extended attributes of lock files (Linux only)")
+	flag.BoolVar(&cmn.Durable, FlagDurable, cmn.Durable, "fsync lock files and directories, so locks survive power failures")
+	flag.BoolVar(&cmn.Mtime, FlagMtime, cmn.Mtime, "judge and refresh freshness of locks by modification time of lock files")
+	flag.BoolVar(&cmn.TmpFile, FlagTmpFile, cmn.TmpFile, "create candidate files without a name (O_TMPFILE, Linux only), so crashed waiters leave no files")
+	flag.BoolVar(&cmn.Sharded, FlagSharded, cmn.Sharded, "sharded layout of the root: mutex directories are placed in 256 subdirectories by a hash of their id")
+	flag.BoolVar(&cmn.Cifs, FlagCifs, cmn.Cifs, "SMB/CIFS share compatibility: create lock files exclusively instead of hard links, lower-case mutex directories")
+	flag.DurationVar(&cmn.Skew, FlagSkew, cmn.Skew, "warn when a lock timestamp is ahead of the local clock by more than this (if > 0)")
+	flag.StringVar(&cmn.DotLock, FlagDotLock, cmn.DotLock, "path of a resource to lock with a classic \"path.lock\" file (liblockfile compatible, replaces -id)")
+	flag.StringVar(&cmn.Owner, FlagOwner, cmn.Owner, "owner (e.g. a job name) recorded in lock metadata")
+	flag.StringVar(&cmn.Message, FlagMessage, cmn.Message, "why the lock is held (e.g. \"loading warehouse, ticket OPS-123\"), recorded in lock metadata")
+	flag.StringVar(&cmn.Webhook, FlagWebhook, cmn.Webhook, "URL to POST lock events (acquired, released, stale-broken, etc.) to as JSON")
+	flag.StringVar(&cmn.Mirror, FlagMirror, cmn.Mirror, "secondary root to replicate locks to, best-effort (see the reconcile command)")
+	flag.StringVar(&cmn.LogFormat, FlagLogFormat, cmn.LogFormat, "format of log lines: \"text\" or \"json\" (JSON lines)")
+	flag.StringVar(&cmn.Candidates, FlagCandidates, cmn.Candidates, "locking candidate file name pattern, \"*\" stands for a random string")
 
 	cmdLock = flag.NewFlagSet(CmdLock, flag.ExitOnError)
-	cmdLock.DurationVar(&lck.Pulse, FlagPulse, lck.Pulse, "determines frequency of locking attempts")
-	cmdLock.DurationVar(&lck.Refresh, FlagRefresh, lck.Refresh, "determines frequency of saving current timestamp in a locking file")
-	cmdLock.DurationVar(&lck.Limit, FlagLimit, lck.Limit, "determines how long takes to consider given mutex as \"dead\"")
-	cmdLock.DurationVar(&lck.Timeout, FlagTimeout, lck.Timeout, "locking timeout (if > 0)")
+	defineLockFlags(cmdLock)
 
 	cmdRelease = flag.NewFlagSet(CmdRelease, flag.ExitOnError)
+	cmdRelease.StringVar(&rl.IfOwner, FlagIfOwner, rl.IfOwner, "release only a lock of this owner (see -owner), skip others")
 	cmdTest = flag.NewFlagSet(CmdTest, flag.ExitOnError)
+	cmdTest.BoolVar(&tst.WaitLocked, FlagWaitLocked, tst.WaitLocked, "wait until the mutex (any mutex of a pattern) is locked")
+	cmdTest.BoolVar(&tst.WaitUnlocked, FlagWaitUnlocked, tst.WaitUnlocked, "wait until the mutex (every mutex of a pattern) is unlocked")
+	cmdTest.DurationVar(&tst.Timeout, FlagTimeout, tst.Timeout, "waiting timeout (if > 0)")
+	cmdList = flag.NewFlagSet(CmdList, flag.ExitOnError)
+	cmdList.BoolVar(&ls.Long, FlagLong, ls.Long, "print state, holder, owner, age and number of waiters of each mutex")
+	cmdList.Var(&ls.Selector, FlagSelector, "list only locked mutexes with these labels (e.g. \"team=etl,app=loader\")")
+	cmdList.Var(&ls.Selector, FlagLabel, "list only locked mutexes with this label (key=value), may be repeated")
+	cmdList.DurationVar(&ls.MinAge, FlagMinAge, ls.MinAge, "list only mutexes locked for at least this long")
+	cmdList.StringVar(&ls.HolderHost, FlagHolderHost, ls.HolderHost, "list only mutexes locked by a process of this host")
+	cmdList.StringVar(&ls.Sort, FlagSort, ls.Sort, fmt.Sprintf("sort mutexes by \"%s\", \"%s\" (the oldest locks first) "+
+		"or \"%s\" (the most waiters first), after all of them are found", SortId, SortAge, SortWaiters))
+	defineOutputFlags(cmdList)
+	cmdMigrate = flag.NewFlagSet(CmdMigrate, flag.ExitOnError)
+	cmdAdopt = flag.NewFlagSet(CmdAdopt, flag.ExitOnError)
+	cmdRenew = flag.NewFlagSet(CmdRenew, flag.ExitOnError)
+	cmdReaders = flag.NewFlagSet(CmdReaders, flag.ExitOnError)
+	cmdWatchdog = flag.NewFlagSet(CmdWatchdog, flag.ExitOnError)
+	cmdWatchdog.DurationVar(&wdg.MaxAge, FlagMaxAge, wdg.MaxAge, "maximal age of locks, older ones make the command fail")
+
+	cmdInfo = flag.NewFlagSet(CmdInfo, flag.ExitOnError)
+	defineOutputFlags(cmdInfo)
+
+	cmdRun = flag.NewFlagSet(CmdRun, flag.ExitOnError)
+	defineLockFlags(cmdRun)
+	cmdRun.DurationVar(&rn.Grace, FlagGrace, rn.Grace, "how long to wait after SIGTERM before killing the command, when the lock is lost")
+	cmdRun.StringVar(&rn.PidFile, FlagPidFile, rn.PidFile, "file to write PID of the command to, removed when the command finishes")
+	cmdRun.BoolVar(&rn.SdNotify, FlagSdNotify, rn.SdNotify, "notify systemd: READY=1 once the lock is acquired, WATCHDOG=1 on each refresh")
 
-	cmdAll, cmdNames = mkCommands(cmdLock, cmdRelease, cmdTest)
+	cmdExport = flag.NewFlagSet(CmdExport, flag.ExitOnError)
+	cmdImport = flag.NewFlagSet(CmdImport, flag.ExitOnError)
 
+	cmdMigrateRoot = flag.NewFlagSet(CmdMigrateRoot, flag.ExitOnError)
+	cmdMigrateRoot.StringVar(&mr.From, FlagFrom, mr.From, "root directory to migrate from (defaults to -root)")
+	cmdMigrateRoot.StringVar(&mr.To, FlagTo, mr.To, "root directory to migrate to, its filesystem is verified first")
+	cmdMigrateRoot.BoolVar(&mr.CopyHeld, FlagCopyHeld, mr.CopyHeld, "transplant currently held locks with their metadata and tokens")
+	cmdMigrateRoot.BoolVar(&mr.ToSharded, FlagToSharded, mr.ToSharded, "use the sharded layout in the -to root (see -sharded), e.g. to migrate a flat root")
+
+	cmdExporter = flag.NewFlagSet(CmdExporter, flag.ExitOnError)
+	cmdExporter.StringVar(&exp.Listen, FlagListen, exp.Listen, "address to serve Prometheus metrics at "+metricsPath+
+		" (none, if empty and -statsd is given)")
+	cmdExporter.StringVar(&exp.Statsd, FlagStatsd, exp.Statsd, "address of a statsd server or a Datadog agent to send metrics to, e.g. localhost:8125")
+	cmdExporter.StringVar(&exp.StatsdPrefix, FlagStatsdPrefix, exp.StatsdPrefix, "prefix of metric names sent to statsd")
+	cmdExporter.StringVar(&exp.StatsdTags, FlagStatsdTags, exp.StatsdTags, "comma-separated tags of metrics sent to statsd, e.g. env:prod,team:batch")
+	cmdExporter.DurationVar(&exp.Interval, FlagInterval, exp.Interval, "how often to send metrics to statsd")
+
+	cmdHealthcheck = flag.NewFlagSet(CmdHealthcheck, flag.ExitOnError)
+	cmdHealthcheck.StringVar(&hc.Expect, FlagExpect, hc.Expect, fmt.Sprintf(
+		"expected state of the mutex: \"%s\" (locked and fresh, by this host and -owner, if given), \"%s\" or \"%s\" (locked and fresh)",
+		ExpectHeldByMe, ExpectFree, ExpectFresh))
+
+	cmdGc = flag.NewFlagSet(CmdGc, flag.ExitOnError)
+	cmdGc.DurationVar(&swp.Interval, FlagInterval, swp.Interval, "how often to sweep the root")
+	cmdGc.DurationVar(&swp.OlderThan, FlagOlderThan, swp.OlderThan, "remove locks and candidates not refreshed for longer than this")
+	cmdGc.Var(&swp.Selector, FlagSelector, "remove only locks and candidates with these labels (e.g. \"team=etl,app=loader\")")
+
+	cmdReconcile = flag.NewFlagSet(CmdReconcile, flag.ExitOnError)
+
+	cmdAll, cmdNames = mkCommands(cmdLock, cmdRelease, cmdTest, cmdList, cmdMigrate, cmdAdopt, cmdRenew, cmdReaders,
+		cmdWatchdog, cmdInfo, cmdRun, cmdExport, cmdImport, cmdMigrateRoot,
+		cmdExporter, cmdHealthcheck, cmdGc, cmdReconcile)
+
+}
+
+// defineLockFlags defines flags of commands locking a mutex.
+func defineLockFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&lck.Pulse, FlagPulse, lck.Pulse, "determines frequency of locking attempts")
+	fs.DurationVar(&lck.MaxPulse, FlagMaxPulse, lck.MaxPulse, "if > pulse, delays between locking attempts grow up to this while the mutex stays busy")
+	fs.DurationVar(&lck.Refresh, FlagRefresh, lck.Refresh, "determines frequency of saving current timestamp in a locking file")
+	fs.DurationVar(&lck.Limit, FlagLimit, lck.Limit, "determines how long takes to consider given mutex as \"dead\"")
+	fs.DurationVar(&lck.Timeout, FlagTimeout, lck.Timeout, "locking timeout (if > 0)")
+	fs.BoolVar(&lck.Verbose, FlagVerbose, lck.Verbose, "print each locking attempt and other events of the mutex")
+	fs.BoolVar(&lck.VVerbose, FlagVVerbose, lck.VVerbose, "print each locking attempt and details of the competing lock")
+	fs.DurationVar(&lck.Steal, FlagStealOlder, lck.Steal, "break the current lock, if acquired longer than this ago (if > 0), even if it is refreshed")
+	fs.Var(&lck.Labels, FlagLabel, "key=value label (e.g. \"team=etl\") recorded in lock metadata, may be repeated")
+	fs.BoolVar(&lck.Strict, FlagStrict, lck.Strict, "never break stale locks of others, fail instead, so they can be released manually")
+	fs.StringVar(&lck.ProbeDir, FlagProbeDir, lck.ProbeDir, "local directory (e.g. /tmp) to coordinate waiters of this host in, so only one of them polls the mutex")
 }
 
 func main() {
 	flag.Parse()
 
-	if isEmptyStr(cmn.Id) {
-		log.Fatalf("Flag -%s is required.", FlagId)
+	if flag.NArg() < 1 {
+		fatalf(cmn.Id, "Parameter error - expected command, one of: %s", strings.Join(cmdNames, ", "))
 	}
 
-	if flag.NArg() < 1 {
-		log.Fatalf("Parameter error - expected command, one of: %s", strings.Join(cmdNames, ", "))
+	if isEmptyStr(cmn.Id) && isEmptyStr(cmn.DotLock) {
+		if flag.Arg(0) != CmdList && flag.Arg(0) != CmdMigrate && flag.Arg(0) != CmdWatchdog &&
+			flag.Arg(0) != CmdExport && flag.Arg(0) != CmdImport && flag.Arg(0) != CmdMigrateRoot &&
+			flag.Arg(0) != CmdExporter && flag.Arg(0) != CmdGc && flag.Arg(0) != CmdReconcile {
+			fatalf(cmn.Id, "Flag -%s is required.", FlagId)
+		}
+		cmn.Id = mutex.AllIds
 	}
 
+	if cmn.LogFormat != LogFormatText && cmn.LogFormat != LogFormatJson {
+		fatalf(cmn.Id, "Parameter error - unknown log format \"%s\", valid formats are: %s, %s", cmn.LogFormat,
+			LogFormatText, LogFormatJson)
+	}
 	if cmn.Silent {
 		log.SetOutput(ioutil.Discard)
 	}
 	switch flag.Arg(0) {
 	case CmdLock:
 		cmdLock.Parse(flag.Args()[1:])
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot lock multiple mutexes \"%s\" at once", cmn.Id)
+		}
 		doLock()
 		if !cmn.Silent {
-			fmt.Println("LOCKED")
+			report(cmn.Id, "LOCKED")
 		}
 	case CmdRelease, CmdUnlock:
 		cmdRelease.Parse(flag.Args()[1:])
 		doUnlock()
 		if !cmn.Silent {
-			fmt.Println("RELEASED")
+			report(cmn.Id, "RELEASED")
 		}
 	case CmdTest:
 		cmdTest.Parse(flag.Args()[1:])
-		os.Exit(doTest())
+		if tst.WaitLocked && tst.WaitUnlocked {
+			fatalf(cmn.Id, "Flags -%s and -%s are mutually exclusive", FlagWaitLocked, FlagWaitUnlocked)
+		}
+		if tst.WaitLocked || tst.WaitUnlocked {
+			waitState(tst.WaitLocked)
+		}
+		exit(doTest())
+	case CmdList:
+		cmdList.Parse(flag.Args()[1:])
+		checkOutput()
+		if ls.Sort != "" && ls.Sort != SortId && ls.Sort != SortAge && ls.Sort != SortWaiters {
+			fatalf(cmn.Id, "Parameter error - unknown sort key \"%s\", valid keys are: %s, %s, %s", ls.Sort,
+				SortId, SortAge, SortWaiters)
+		}
+		exit(doList())
+	case CmdAdopt:
+		cmdAdopt.Parse(flag.Args()[1:])
+		doAdopt()
+		if !cmn.Silent {
+			report(cmn.Id, "ADOPTED")
+		}
+	case CmdRenew:
+		cmdRenew.Parse(flag.Args()[1:])
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot renew multiple mutexes \"%s\" at once", cmn.Id)
+		}
+		doRenew()
+		if !cmn.Silent {
+			report(cmn.Id, "RENEWED")
+		}
+	case CmdMigrate:
+		cmdMigrate.Parse(flag.Args()[1:])
+		exit(doMigrate())
+	case CmdReaders:
+		cmdReaders.Parse(flag.Args()[1:])
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot show readers of multiple mutexes \"%s\" at once", cmn.Id)
+		}
+		exit(doReaders())
+	case CmdInfo:
+		cmdInfo.Parse(flag.Args()[1:])
+		checkOutput()
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot show info of multiple mutexes \"%s\" at once", cmn.Id)
+		}
+		exit(doInfo())
+	case CmdWatchdog:
+		cmdWatchdog.Parse(flag.Args()[1:])
+		exit(doWatchdog())
+	case CmdRun:
+		cmdRun.Parse(flag.Args()[1:])
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot lock multiple mutexes \"%s\" at once", cmn.Id)
+		}
+		exit(doRun(cmdRun.Args()))
+	case CmdExport:
+		cmdExport.Parse(flag.Args()[1:])
+		exit(doExport(os.Stdout))
+	case CmdImport:
+		cmdImport.Parse(flag.Args()[1:])
+		exit(doImport(os.Stdin))
+	case CmdMigrateRoot:
+		cmdMigrateRoot.Parse(flag.Args()[1:])
+		if isEmptyStr(mr.To) {
+			fatalf(cmn.Id, "Flag -%s is required.", FlagTo)
+		}
+		exit(doMigrateRoot())
+	case CmdExporter:
+		cmdExporter.Parse(flag.Args()[1:])
+		exit(doExporter())
+	case CmdGc:
+		cmdGc.Parse(flag.Args()[1:])
+		// A non-positive age would sweep locks of live holders, which have not refreshed them yet
+		if swp.OlderThan <= 0 {
+			fatalf(cmn.Id, "Parameter error - flag -%s must be positive, got %v", FlagOlderThan, swp.OlderThan)
+		}
+		if swp.Interval <= 0 {
+			fatalf(cmn.Id, "Parameter error - flag -%s must be positive, got %v", FlagInterval, swp.Interval)
+		}
+		exit(doGc())
+	case CmdReconcile:
+		cmdReconcile.Parse(flag.Args()[1:])
+		if isEmptyStr(cmn.Mirror) {
+			fatalf(cmn.Id, "Flag -%s is required.", FlagMirror)
+		}
+		exit(doReconcile())
+	case CmdHealthcheck:
+		cmdHealthcheck.Parse(flag.Args()[1:])
+		if isPattern(cmn.Id) {
+			fatalf(cmn.Id, "Cannot check health of multiple mutexes \"%s\" at once", cmn.Id)
+		}
+		if hc.Expect != ExpectHeldByMe && hc.Expect != ExpectFree && hc.Expect != ExpectFresh {
+			fatalf(cmn.Id, "Parameter error - unknown expected state \"%s\", valid states are: %s, %s, %s", hc.Expect,
+				ExpectHeldByMe, ExpectFree, ExpectFresh)
+		}
+		exit(doHealthcheck())
 
 	default:
-		log.Fatalf("Fatal parameter error - unknown command \"%s\", valid commands are: %s", flag.Arg(0),
+		fatalf(cmn.Id, "Fatal parameter error - unknown command \"%s\", valid commands are: %s", flag.Arg(0),
 			strings.Join(cmdNames, ", "))
 	}
+	exit(0)
+}
+
+// webhookFlushTimeout limits how long exit waits for events queued for delivery to the -webhook.
+const webhookFlushTimeout = 10 * time.Second
+
+// exit waits for events queued for delivery to the -webhook, then exits with the code.
+func exit(code int) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookFlushTimeout)
+	defer cancel()
+	mutex.FlushWebhooks(ctx)
+	os.Exit(code)
+}
+
+// doList prints ids of mutexes matching the -id pattern or glob (e.g. "*/nightly") and the filters
+// (-selector, -label, -min-age, -holder-host), with their state, if -l or in the -output format.
+// Mutexes are printed as they are found, so huge roots are listed without loading them all first,
+// in the order of the directory walk, unless sorted by -sort.
+func doList() int {
+	var iw *infoWriter
+	if out.Format != OutputText {
+		var err error
+		if iw, err = newInfoWriter(os.Stdout, out.Format); err != nil {
+			fatalf(cmn.Id, "Cannot list mutexes \"%s\": %v", cmn.Id, err)
+		}
+	}
+	var sorted []mutex.Info
+	err := newManager().WalkInfos(context.Background(), cmn.Id, func(info mutex.Info) error {
+		if !listed(info) {
+			return nil
+		} else if ls.Sort != "" {
+			sorted = append(sorted, info)
+			return nil
+		}
+		return printInfo(iw, info)
+	})
+	if err == nil && ls.Sort != "" {
+		sortInfos(sorted, ls.Sort)
+		for _, info := range sorted {
+			if err = printInfo(iw, info); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fatalf(cmn.Id, "Cannot list mutexes \"%s\": %v", cmn.Id, err)
+	}
+	return 0
+}
+
+// listed reports whether the state of a mutex passes filters of the list command. Only locked mutexes
+// pass the filters on their lock (-selector, -label, -min-age and -holder-host).
+func listed(info mutex.Info) bool {
+	if len(ls.Selector) == 0 && ls.MinAge <= 0 && ls.HolderHost == "" {
+		return true
+	}
+	return info.State != mutex.StateUnlocked && ls.Selector.selector().Matches(info.Labels) &&
+		info.Age >= ls.MinAge && (ls.HolderHost == "" || strings.EqualFold(info.Holder.Host, ls.HolderHost))
+}
+
+// sortInfos sorts states of mutexes by the -sort key: ids alphabetically, the oldest locks
+// or mutexes with the most waiters first. Ties are sorted by id.
+func sortInfos(infos []mutex.Info, key string) {
+	sort.Slice(infos, func(i, j int) bool {
+		switch {
+		case key == SortAge && infos[i].Age != infos[j].Age:
+			return infos[i].Age > infos[j].Age
+		case key == SortWaiters && infos[i].Waiters != infos[j].Waiters:
+			return infos[i].Waiters > infos[j].Waiters
+		}
+		return infos[i].Id < infos[j].Id
+	})
+}
+
+// printInfo prints the state of a listed mutex with the infoWriter, if the -output format is not text.
+func printInfo(iw *infoWriter, info mutex.Info) error {
+	if iw != nil {
+		return iw.write(info)
+	} else if !ls.Long {
+		fmt.Println(info.Id)
+	} else if info.State == mutex.StateUnlocked {
+		fmt.Printf("%s\t%s\t-\t-\t-\t%d\n", info.Id, info.State, info.Waiters)
+	} else {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%d\n", info.Id, info.State, info.Holder, ifEmptyStr(info.Owner, "-"),
+			info.Age.Round(time.Second), info.Waiters)
+	}
+	return nil
+}
+
+// doExport writes a JSON snapshot of locks of mutexes matching the -id pattern to w.
+func doExport(w io.Writer) int {
+	snapshot, err := newManager().Export(cmn.Id)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot export mutexes \"%s\": %v", cmn.Id, err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		fatalf(cmn.Id, "Cannot write snapshot of mutexes \"%s\": %v", cmn.Id, err)
+	}
+	return 0
+}
+
+// doImport restores locks of a JSON snapshot read from r, which match the -id pattern, under the root.
+func doImport(r io.Reader) int {
+	var snapshot mutex.Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		fatalf(cmn.Id, "Cannot read snapshot: %v", err)
+	}
+	mgr := newManager()
+	result := 0
+	for _, md := range snapshot.Locks {
+		id := md.SnapshotId()
+		if !matchesPattern(id, cmn.Id) {
+			continue
+		}
+		m, err := mgr.Mutex(id)
+		if err == nil {
+			err = m.Restore(md)
+		}
+		if err != nil {
+			errorf(id, "Cannot import mutex \"%s\": %v", id, err)
+			result = 1
+		} else if !cmn.Silent {
+			report(id, "IMPORTED", id)
+		}
+	}
+	return result
+}
+
+// doGc sweeps stale locks and orphaned candidates of mutexes matching the -id pattern every interval, forever.
+func doGc() int {
+	mgr := newManager()
+	for {
+		sweep(mgr)
+		time.Sleep(swp.Interval)
+	}
+}
+
+// sweep removes stale locks and orphaned candidates of mutexes matching the -id pattern once,
+// reporting each removed file. Returns the number of removed files.
+func sweep(mgr *mutex.Manager) int {
+	removed, err := mgr.SweepSelected(cmn.Id, swp.Selector.selector(), swp.OlderThan)
+	if err != nil {
+		errorf(cmn.Id, "Cannot sweep mutexes \"%s\": %v", cmn.Id, err)
+	}
+	for _, fileName := range removed {
+		if !cmn.Silent {
+			report(cmn.Id, "REMOVED", fileName)
+		}
+	}
+	infof(cmn.Id, "Swept mutexes \"%s\": %d file(s) removed", cmn.Id, len(removed))
+	return len(removed)
+}
+
+// doReconcile makes locks of mutexes matching the -id pattern under the -mirror root the same as under -root,
+// reporting each fixed mutex, see mutex.Manager.Reconcile.
+func doReconcile() int {
+	mirror, err := mutex.NewManagerExt(cmn.Mirror, lck.Pulse, lck.Refresh, lck.Limit, mutexOptions()...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot access mutexes root \"%s\": %v", cmn.Mirror, err)
+	}
+	fixed, err := newManager().Reconcile(cmn.Id, mirror)
+	for _, id := range fixed {
+		if !cmn.Silent {
+			report(id, "RECONCILED", mirror.Root())
+		}
+	}
+	if err != nil {
+		errorf(cmn.Id, "Cannot reconcile mutexes \"%s\" with mirror \"%s\": %v", cmn.Id, cmn.Mirror, err)
+		return 1
+	}
+	infof(cmn.Id, "Reconciled mutexes \"%s\" with mirror \"%s\": %d mutex(es) fixed", cmn.Id, cmn.Mirror, len(fixed))
+	return 0
+}
+
+// doMigrateRoot recreates the layout of mutexes of the -from root under the -to root, see mutex.Manager.Transplant.
+func doMigrateRoot() int {
+	src, err := mutex.NewManagerExt(ifEmptyStr(mr.From, mutexesRoot()), lck.Pulse, lck.Refresh, lck.Limit, mutexOptions()...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot access mutexes root \"%s\": %v", mr.From, err)
+	}
+	dstOptions := mutexOptions()
+	if mr.ToSharded {
+		dstOptions = append(dstOptions, mutex.WithShardedLayout())
+	}
+	dst, err := mutex.NewManagerExt(mr.To, lck.Pulse, lck.Refresh, lck.Limit, dstOptions...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot access mutexes root \"%s\": %v", mr.To, err)
+	}
+	if err := dst.Probe(); err != nil {
+		fatalf(cmn.Id, "Cannot migrate to root \"%s\": %v", dst.Root(), err)
+	}
+	ids, err := src.Transplant(dst, mr.CopyHeld)
+	if !cmn.Silent {
+		for _, id := range ids {
+			report(id, "MIGRATED", id)
+		}
+	}
+	if err != nil {
+		errorf(cmn.Id, "Cannot migrate root \"%s\" to \"%s\": %v", src.Root(), dst.Root(), err)
+		return 1
+	}
+	return 0
+}
+
+func doReaders() int {
+	mgr := newManager()
+	readers, err := mgr.Readers(cmn.Id)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot list readers of mutex \"%s\": %v", cmn.Id, err)
+	}
+	for _, r := range readers {
+		fmt.Printf("%s\t%s\t%s\n", r.Mode, r.Holder, time.Since(r.Since).Round(time.Second))
+	}
+	writers, err := mgr.PendingWriters(cmn.Id)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot list pending writers of mutex \"%s\": %v", cmn.Id, err)
+	}
+	for _, w := range writers {
+		fmt.Printf("%s\t%s\t%s\tpending\n", w.Mode, w.Holder, time.Since(w.Since).Round(time.Second))
+	}
+	return 0
+}
+
+func doInfo() int {
+	m := newMutex(mutex.WithLazyInit())
+	if out.Format != OutputText {
+		return writeInfo(m)
+	}
+	fmt.Printf("id:\t%s\n", m.Id())
+	if m.Key() != m.Id() {
+		fmt.Printf("key:\t%s\n", m.Key())
+	}
+	fmt.Printf("lock:\t%s\n", m.LockPath())
+	if md, err := m.Metadata(); err == nil || errors.Is(err, mutex.ErrInvalidSignature) {
+		fmt.Printf("locked:\t%s\n", md.Created.Local().Format(time.RFC3339))
+		fmt.Printf("holder:\t%s\n", md.Holder)
+		if md.Owner != "" {
+			fmt.Printf("owner:\t%s\n", md.Owner)
+		}
+		if md.Message != "" {
+			fmt.Printf("message:\t%s\n", md.Message)
+		}
+		if md.Trace != "" {
+			fmt.Printf("trace:\t%s\n", md.Trace)
+		}
+		if md.Request != "" {
+			fmt.Printf("request:\t%s\n", md.Request)
+		}
+		if len(md.Labels) > 0 {
+			fmt.Printf("labels:\t%s\n", mutex.LabelSelector(md.Labels))
+		}
+		if err != nil {
+			warnf(m.Id(), "%v", err)
+		}
+	} else {
+		fmt.Printf("locked:\tno\n")
+	}
+	state, result := "unlocked", 0
+	if m.Stale() {
+		state, result = "stale", testStale
+	} else if !m.When().IsZero() {
+		state = "locked"
+	}
+	fmt.Printf("state:\t%s\n", state)
+	n, err := m.Waiters()
+	if err != nil {
+		errorf(m.Id(), "Cannot count waiters of mutex \"%s\": %v", m.Key(), err)
+		return 1
+	}
+	fmt.Printf("waiters:\t%d\n", n)
+	return result
 }
 
+// writeInfo writes the state of the mutex in the -output format.
+func writeInfo(m *mutex.Mutex) int {
+	info, err := m.Info()
+	if err != nil {
+		errorf(m.Id(), "Cannot get state of mutex \"%s\": %v", m.Key(), err)
+		return 1
+	}
+	iw, err := newInfoWriter(os.Stdout, out.Format)
+	if err == nil {
+		err = iw.write(info)
+	}
+	if err != nil {
+		errorf(m.Id(), "Cannot write state of mutex \"%s\": %v", m.Key(), err)
+		return 1
+	}
+	if info.State == mutex.StateStale {
+		return testStale
+	}
+	return 0
+}
+
+func doWatchdog() int {
+	var mutexes []*mutex.Mutex
+	if isPattern(cmn.Id) {
+		mutexes = listMutexes()
+	} else {
+		mutexes = []*mutex.Mutex{newMutex(mutex.WithLazyInit())}
+	}
+	result := 0
+	for _, m := range mutexes {
+		if tm := m.When(); !tm.IsZero() && time.Since(tm) > wdg.MaxAge {
+			errorf(m.Id(), "Mutex \"%s\" (%s) is locked for too long: since %s", m.Key(), m.LockPath(),
+				tm.Format(time.RFC3339))
+			result = 1
+			if !isEmptyStr(cmn.Webhook) {
+				e := mutex.Event{Kind: mutex.EventHeldTooLong, Id: m.Id(), Time: time.Now(), Path: m.LockPath()}
+				if err := mutex.NewWebhook(cmn.Webhook).Notify(e); err != nil {
+					errorf(m.Id(), "Cannot notify webhook: %v", err)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func doMigrate() int {
+	var mutexes []*mutex.Mutex
+	if isPattern(cmn.Id) {
+		mutexes = listMutexes()
+	} else {
+		mutexes = []*mutex.Mutex{newMutex()}
+	}
+	result := 0
+	for _, m := range mutexes {
+		if migrated, err := m.Migrate(); err != nil {
+			errorf(m.Id(), "Cannot migrate mutex \"%s\": %v", m.Key(), err)
+			result = 1
+		} else if migrated && !cmn.Silent {
+			report(m.Id(), "MIGRATED", m.Id())
+		}
+	}
+	return result
+}
+
+// doHealthcheck verifies that the mutex is in the expected state, suitable for a liveness probe of a container:
+// returns 0 if it is, 1 otherwise, reporting the reason.
+func doHealthcheck() int {
+	m := newMutex(mutex.WithLazyInit())
+	md, err := m.Metadata()
+	if err != nil && !errors.Is(err, mutex.ErrInvalidSignature) {
+		md = nil
+	}
+	var problem string
+	switch {
+	case hc.Expect == ExpectFree:
+		if md != nil {
+			problem = fmt.Sprintf("locked by %s", md.Holder)
+		}
+	case md == nil:
+		problem = "unlocked"
+	case err != nil:
+		problem = err.Error()
+	case m.Stale():
+		problem = fmt.Sprintf("stale, last refreshed %s", md.Refreshed.Local().Format(time.RFC3339))
+	case hc.Expect == ExpectHeldByMe:
+		host, _ := os.Hostname()
+		if md.Holder.Host != host || (!isEmptyStr(cmn.Owner) && md.Owner != cmn.Owner) {
+			problem = fmt.Sprintf("locked by %s, owner \"%s\"", md.Holder, md.Owner)
+		}
+	}
+	if problem != "" {
+		errorf(m.Id(), "Mutex \"%s\" is not %s: %s", m.Key(), hc.Expect, problem)
+		return 1
+	}
+	if !cmn.Silent {
+		report(m.Id(), "HEALTHY", hc.Expect)
+	}
+	return 0
+}
+
+// Exit statuses of the test command
+const (
+	testLocked   = 0 // Locked and refreshed within its lease
+	testUnlocked = 1
+	testStale    = 2 // Locked, but not refreshed for longer than its lease, usually a crashed holder
+)
+
+// doTest tests the mutex, or all mutexes of the -id pattern. A pattern is reported stale, if any of its
+// mutexes is stale, otherwise locked, if any of them is locked.
 func doTest() int {
-	m := newMutex()
+	if isPattern(cmn.Id) {
+		result := testUnlocked
+		for _, m := range listMutexes() {
+			switch testMutex(m) {
+			case testStale:
+				result = testStale
+			case testLocked:
+				if result != testStale {
+					result = testLocked
+				}
+			}
+		}
+		return result
+	}
+	return testMutex(newMutex(mutex.WithLazyInit()))
+}
+
+// waitState waits until the mutex (any mutex of the -id pattern) is locked, or until it (every mutex
+// of the pattern) is unlocked, checking its state every pulse. Gives up after the test timeout, if set.
+func waitState(locked bool) {
+	var deadline time.Time
+	if tst.Timeout > 0 {
+		deadline = time.Now().Add(tst.Timeout)
+	}
+	for isLocked() != locked {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			warnf(cmn.Id, "Timeout waiting for mutex \"%s\" to get %s", cmn.Id, map[bool]string{true: "locked", false: "unlocked"}[locked])
+			return
+		}
+		time.Sleep(lck.Pulse)
+	}
+}
+
+// isLocked reports whether the mutex (any mutex of the -id pattern) is locked.
+func isLocked() bool {
+	if !isPattern(cmn.Id) {
+		return !newMutex(mutex.WithLazyInit()).When().IsZero()
+	}
+	for _, m := range listMutexes() {
+		if !m.When().IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func testMutex(m *mutex.Mutex) int {
 	lockPath := m.LockPath()
 	if tm := m.When(); tm.IsZero() {
-		log.Printf("Mutex \"%s\" (%s) is unlocked", m.Id(), lockPath)
-		return 1
+		infof(m.Id(), "Mutex \"%s\" (%s) is unlocked", m.Key(), lockPath)
+		return testUnlocked
 	} else {
-		log.Printf("Mutex \"%s\" (%s) is locked: %s", m.Id(), lockPath, tm.Format(time.RFC3339))
+		holder := "unknown"
+		if md, err := m.Metadata(); md != nil {
+			holder = md.Holder.String()
+			if md.Owner != "" {
+				holder = fmt.Sprintf("%s (%s)", md.Owner, holder)
+			}
+			if md.Trace != "" {
+				holder += " [" + md.Trace + "]"
+			}
+			if md.Request != "" {
+				holder += " request " + md.Request
+			}
+			if md.Message != "" {
+				holder += ": " + md.Message
+			}
+			if err != nil {
+				warnf(m.Id(), "%v", err)
+			}
+		}
+		if err := m.CheckClockSkew(); err != nil {
+			warnf(m.Id(), "%v", err)
+		}
+		if m.Stale() {
+			warnf(m.Id(), "Mutex \"%s\" (%s) is locked, but stale: %s by %s", m.Key(), lockPath, tm.Format(time.RFC3339), holder)
+			return testStale
+		}
+		infof(m.Id(), "Mutex \"%s\" (%s) is locked: %s by %s", m.Key(), lockPath, tm.Format(time.RFC3339), holder)
 	}
-	return 0
+	return testLocked
 }
 
 func doLock() {
-	m := newMutex()
+	lockMutex(newMutex())
+}
+
+func lockMutex(m *mutex.Mutex) {
 	if err := m.TryLock(lck.Timeout); err != nil {
-		log.Fatalf("Cannot lock mutex \"%s\": %v", m.Id(), err)
+		if errors.Is(err, mutex.ErrAccessDenied) {
+			fatalf(m.Id(), "Permission denied to lock mutex \"%s\" (see %s): %v", m.Key(), m.AclPath(), err)
+		}
+		if errors.Is(err, mutex.ErrReadOnlyRoot) {
+			fatalf(m.Id(), "Cannot lock mutex \"%s\", its root is read-only or not writable: %v", m.Key(), err)
+		}
+		if errors.Is(err, mutex.ErrStaleLock) {
+			fatalf(m.Id(), "Mutex \"%s\" is held by a stale lock, release it (see %s) once its holder is confirmed gone: %v",
+				m.Key(), CmdRelease, err)
+		}
+		fatalf(m.Id(), "Cannot lock mutex \"%s\" [%s]: %v", m.Key(), m.Trace(), err)
 	}
 }
 
-func doUnlock() {
+func doAdopt() {
+	m := newMutex()
+	if err := m.Adopt(cmn.Owner); err != nil {
+		if errors.Is(err, mutex.ErrAccessDenied) {
+			fatalf(m.Id(), "Permission denied to adopt mutex \"%s\" (see %s): %v", m.Key(), m.AclPath(), err)
+		}
+		fatalf(m.Id(), "Cannot adopt mutex \"%s\": %v", m.Key(), err)
+	}
+}
+
+// doRenew refreshes the timestamp of the current lock of the mutex, see mutex.Mutex.Touch.
+func doRenew() {
 	m := newMutex()
-	if err := m.TryUnlock(); err != nil {
-		log.Fatalf("Cannot unlock mutex \"%s\": %v", m.Id(), err)
+	if err := m.Touch(); err != nil {
+		if errors.Is(err, mutex.ErrAccessDenied) {
+			fatalf(m.Id(), "Permission denied to renew mutex \"%s\" (see %s): %v", m.Key(), m.AclPath(), err)
+		}
+		fatalf(m.Id(), "Cannot renew mutex \"%s\": %v", m.Key(), err)
+	}
+}
+
+func doUnlock() {
+	if isPattern(cmn.Id) {
+		for _, m := range listMutexes() {
+			unlockMutex(m)
+		}
+		return
+	}
+	unlockMutex(newMutex())
+}
+
+func unlockMutex(m *mutex.Mutex) {
+	unlock := m.TryUnlock
+	if !isEmptyStr(rl.IfOwner) {
+		unlock = func() error { return m.UnlockIfOwner(rl.IfOwner) }
+	}
+	if err := unlock(); err != nil {
+		if errors.Is(err, mutex.ErrNotOwner) && isPattern(cmn.Id) {
+			infof(m.Id(), "Skipping mutex \"%s\": %v", m.Key(), err)
+			return
+		}
+		if errors.Is(err, mutex.ErrAccessDenied) {
+			fatalf(m.Id(), "Permission denied to release mutex \"%s\" (see %s): %v", m.Key(), m.AclPath(), err)
+		}
+		fatalf(m.Id(), "Cannot unlock mutex \"%s\": %v", m.Key(), err)
 	}
 }
 
-func newMutex() *mutex.Mutex {
-	result, err := mutex.NewMutexExt(cmn.Root, cmn.Id, lck.Pulse, lck.Refresh, lck.Limit)
+// newMutex returns the mutex selected by -id or -dot-lock, configured by flags and extra options.
+func newMutex(extra ...mutex.Option) *mutex.Mutex {
+	if !isEmptyStr(cmn.DotLock) {
+		limit := lck.Limit
+		if !isFlagSet(cmdLock, FlagLimit) && !isFlagSet(cmdRun, FlagLimit) {
+			limit = mutex.DefaultDotLockTimeout
+		}
+		result, err := mutex.NewDotLockExt(cmn.DotLock, lck.Pulse, lck.Refresh, limit, append(mutexOptions(), extra...)...)
+		if err != nil {
+			fatalf(cmn.Id, "Cannot create dot-lock \"%s\": %v", cmn.DotLock, err)
+		}
+		return result
+	}
+	roots := filepath.SplitList(cmn.Root)
+	if len(roots) == 0 {
+		roots = []string{cmn.Root}
+	} else if len(roots) > 1 {
+		extra = append(extra, mutex.WithFallbackRoots(roots[1:]...))
+	}
+	result, err := mutex.NewMutexExt(roots[0], cmn.Id, lck.Pulse, lck.Refresh, lck.Limit, append(mutexOptions(), extra...)...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot create mutex \"%s\": %v", cmn.Id, err)
+	}
+	return result
+}
+
+func newManager(extra ...mutex.Option) *mutex.Manager {
+	result, err := mutex.NewManagerExt(mutexesRoot(), lck.Pulse, lck.Refresh, lck.Limit, append(mutexOptions(), extra...)...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot access mutexes root \"%s\": %v", cmn.Root, err)
+	}
+	return result
+}
+
+// mutexesRoot returns the first healthy root of the -root list.
+func mutexesRoot() string {
+	result, err := mutex.HealthyRoot(filepath.SplitList(cmn.Root)...)
+	if err != nil {
+		fatalf(cmn.Id, "Cannot access mutexes root \"%s\": %v", cmn.Root, err)
+	}
+	return result
+}
+
+// listMutexes returns all the mutexes matching the -id pattern.
+func listMutexes() []*mutex.Mutex {
+	mgr := newManager()
+	ids, err := mgr.List(cmn.Id)
 	if err != nil {
-		log.Fatalf("Cannot create mutex \"%s\": %v", cmn.Id, err)
+		fatalf(cmn.Id, "Cannot list mutexes \"%s\": %v", cmn.Id, err)
+	}
+	var result []*mutex.Mutex
+	for _, id := range ids {
+		m, err := mgr.Listed(id)
+		if err != nil {
+			fatalf(id, "Cannot create mutex \"%s\": %v", id, err)
+		}
+		result = append(result, m)
 	}
 	return result
 }
 
+func mutexOptions() []mutex.Option {
+	result := []mutex.Option{
+		mutex.WithDirMode(os.FileMode(cmn.DirMode)),
+		mutex.WithFileMode(os.FileMode(cmn.FileMode)),
+		mutex.WithClockSkewThreshold(cmn.Skew),
+	}
+	if lck.MaxPulse > 0 {
+		result = append(result, mutex.WithAdaptivePulse(lck.MaxPulse))
+	}
+	if lck.Verbose || lck.VVerbose {
+		result = append(result, mutex.WithAttemptEvents(), mutex.WithEventHandler(logEvent))
+	}
+	if !isEmptyStr(cmn.Mirror) {
+		result = append(result, mutex.WithMirror(cmn.Mirror))
+	}
+	if !isEmptyStr(cmn.Webhook) {
+		result = append(result, mutex.WithWebhook(cmn.Webhook))
+	}
+	if secret := os.Getenv(EnvSecret); secret != "" {
+		result = append(result, mutex.WithSecret([]byte(secret)))
+	}
+	if namespace := os.Getenv(EnvNamespace); namespace != "" {
+		result = append(result, mutex.WithNamespace(namespace))
+	}
+	if cmn.Shared {
+		result = append(result, mutex.WithSharedAccess())
+	}
+	if cmn.Xattr {
+		result = append(result, mutex.WithXattrMetadata())
+	}
+	if cmn.Durable {
+		result = append(result, mutex.WithDurableWrites())
+	}
+	if cmn.Mtime {
+		result = append(result, mutex.WithMtimeFreshness())
+	}
+	if cmn.TmpFile {
+		result = append(result, mutex.WithAnonymousCandidates())
+	}
+	if cmn.Cifs {
+		result = append(result, mutex.WithCifs())
+	}
+	if cmn.Sharded {
+		result = append(result, mutex.WithShardedLayout())
+	}
+	if !isEmptyStr(cmn.Owner) {
+		result = append(result, mutex.WithOwner(cmn.Owner))
+	}
+	if !isEmptyStr(cmn.Message) {
+		result = append(result, mutex.WithMessage(cmn.Message))
+	}
+	if lck.Steal > 0 {
+		result = append(result, mutex.WithStealThreshold(lck.Steal))
+	}
+	if len(lck.Labels) > 0 {
+		result = append(result, mutex.WithLabels(lck.Labels))
+	}
+	if !isEmptyStr(lck.ProbeDir) {
+		result = append(result, mutex.WithLocalProbing(lck.ProbeDir))
+	}
+	if lck.Strict {
+		result = append(result, mutex.WithNoRecovery())
+	}
+	if cmn.Hash {
+		result = append(result, mutex.WithHashedIds())
+	}
+	if rn.SdNotify {
+		result = append(result, mutex.WithRefreshCallback(func(m *mutex.Mutex) { notifySystemd(m, "WATCHDOG=1") }))
+	}
+	if !isEmptyStr(cmn.LockFile) {
+		result = append(result, mutex.WithLockFileName(cmn.LockFile))
+	}
+	if !isEmptyStr(cmn.Candidates) {
+		result = append(result, mutex.WithCandidatePattern(cmn.Candidates))
+	}
+	return result
+}
+
+// logEvent logs the mutex event in the verbose mode; details of competing locks are logged with -vv only.
+func logEvent(e mutex.Event) {
+	if e.Kind == mutex.EventStaleCheck && !lck.VVerbose {
+		return
+	}
+	logMutexEvent(e)
+}
+
+// isPattern reports whether the id denotes a group of mutexes, like "tenantA/...".
+func isPattern(id string) bool {
+	return strings.HasSuffix(id, mutex.AllIds)
+}
+
+// matchesPattern reports whether the id matches the pattern, see mutex.Manager.List.
+func matchesPattern(id string, pattern string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == mutex.AllIds {
+		return true
+	}
+	if prefix := strings.TrimSuffix(pattern, "/"+mutex.AllIds); prefix != pattern {
+		return id == prefix || strings.HasPrefix(id, prefix+"/")
+	}
+	return id == pattern
+}
+
+// fileMode is a flag.Value of permissions given in octal notation.
+type fileMode os.FileMode
+
+func (f *fileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(*f))
+}
+
+func (f *fileMode) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return err
+	}
+	*f = fileMode(os.FileMode(mode).Perm())
+	return nil
+}
+
 func ifEmptyStr(str string, defaultStr string) string {
 	if isEmptyStr(str) {
 		return defaultStr
@@ -171,6 +1253,16 @@ func getProg(args []string) string {
 	}
 }
 
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	result := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			result = true
+		}
+	})
+	return result
+}
+
 func mkCommands(cmds ...*flag.FlagSet) ([]*flag.FlagSet, []string) {
 	var result []string
 	for _, c := range cmds {
@@ -183,9 +1275,11 @@ func usage() {
 	prog := getProg(os.Args)
 	fmt.Fprintf(os.Stderr, "Program %s s designated to lock/unlock file-based mutexes.\n"+
 		"Usage:\n"+
-		"\t%s [options] {%s} [command-specific options]\n\n"+
+		"\t%s [options] {%s} [command-specific options]\n"+
+		"\t%s [options] %s [run options] command [arguments]\n\n"+
+		"%s runs a non-interactive command in its own process group, which cannot read from the terminal.\n\n"+
 		"options:\n",
-		prog, prog, strings.Join(cmdNames, ", "))
+		prog, prog, strings.Join(cmdNames, ", "), prog, CmdRun, CmdRun)
 	flag.PrintDefaults()
 
 	for _, c := range cmdAll {
@@ -198,3 +1292,29 @@ func usage() {
 	}
 	fmt.Fprintln(os.Stderr)
 }
+
+// labels is a flag of key=value labels, which may be repeated or comma separated.
+type labels map[string]string
+
+func (l *labels) String() string {
+	return mutex.LabelSelector(*l).String()
+}
+
+func (l *labels) Set(value string) error {
+	selector, err := mutex.ParseLabelSelector(value)
+	if err != nil {
+		return err
+	}
+	if *l == nil {
+		*l = labels{}
+	}
+	for k, v := range selector {
+		(*l)[k] = v
+	}
+	return nil
+}
+
+// selector returns the labels as a selector.
+func (l labels) selector() mutex.LabelSelector {
+	return mutex.LabelSelector(l)
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
 )
 
 func temporaryCatalog(t *testing.T) string {
@@ -95,3 +106,635 @@ func TestUnlock(t *testing.T) {
 		t.Fatalf("wrong result of doUnlock(): lock file still exists: %s", lockFile)
 	}
 }
+
+func TestUnlockIfOwner(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "tenant/jobs/nightly"
+	cmn.Owner = "nightly-etl"
+	doLock()
+	cmn.Id, cmn.Owner = "tenant/jobs/hourly", "hourly-etl"
+	doLock()
+	defer func() { cmn.Owner, rl.IfOwner = "", "" }()
+	cmn.Id, rl.IfOwner = "tenant/...", "nightly-etl"
+	doUnlock()
+	for id, locked := range map[string]bool{"tenant/jobs/nightly": false, "tenant/jobs/hourly": true} {
+		cmn.Id = id
+		if got := !newMutex().When().IsZero(); got != locked {
+			t.Fatalf("wrong state of %s after doUnlock(): locked %v instead of %v", id, got, locked)
+		}
+	}
+	cmn.Id, rl.IfOwner = "tenant/jobs/hourly", ""
+	doUnlock()
+}
+
+func TestTestPattern(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "tenant/jobs/nightly"
+	doLock()
+	cmn.Id = "tenant/..."
+	expected := 0
+	if got := doTest(); got != expected {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, expected)
+	}
+	doUnlock()
+	expected = 1
+	if got := doTest(); got != expected {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, expected)
+	}
+}
+
+func TestHashedPattern(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id, cmn.Hash = "https://x/y", true
+	defer func() { cmn.Id, cmn.Hash = "https://x/y", false }()
+	doLock()
+	cmn.Id = mutex.AllIds
+	expected := 0
+	if got := doTest(); got != expected {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, expected)
+	}
+	doUnlock()
+	expected = 1
+	if got := doTest(); got != expected {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, expected)
+	}
+	cmn.Id = "https://x/y"
+	if got := doTest(); got != expected {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, expected)
+	}
+	if entries, err := os.ReadDir(cmn.Root); err != nil || len(entries) != 1 {
+		t.Fatalf("wrong number of directories under the root: %d (%v) instead of %d", len(entries), err, 1)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-migrate"
+	if err := os.MkdirAll(path.Dir(lockName()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockName(), []byte(fmt.Sprintf("%d\n", time.Now().UnixNano()/int64(time.Millisecond))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmn.Id = "..."
+	expected := 0
+	if got := doMigrate(); got != expected {
+		t.Fatalf("wrong value of doMigrate() => %d instead of %d", got, expected)
+	}
+	cmn.Id = "test-migrate"
+	if b, err := os.ReadFile(lockName()); err != nil || !strings.HasPrefix(string(b), "{") {
+		t.Fatalf("lock file has not been migrated: \"%s\" (%v)", string(b), err)
+	}
+}
+
+func TestDotLock(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.DotLock = path.Join(cmn.Root, "mailbox")
+	defer func() { cmn.DotLock = "" }()
+	doLock()
+	if _, err := os.Stat(cmn.DotLock + ".lock"); err != nil {
+		t.Fatalf("wrong result of doLock(): %v", err)
+	}
+	doUnlock()
+	if _, err := os.Stat(cmn.DotLock + ".lock"); err == nil {
+		t.Fatal("wrong result of doUnlock(): lock file still exists")
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-adopt"
+	defer func() { cmn.Owner = "" }()
+	doLock()
+	defer doUnlock()
+	cmn.Owner = "new-owner"
+	doAdopt()
+	m := newMutex()
+	if md, err := m.Metadata(); err != nil || md.Owner != cmn.Owner {
+		t.Fatalf("wrong result of doAdopt(): %+v (%v)", md, err)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-readers"
+	lock, err := newManager().LockHierarchical(context.Background(), cmn.Id, mutex.Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+	if result := doReaders(); result != 0 {
+		t.Fatalf("wrong result of doReaders(): %d instead of 0", result)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-watchdog"
+	defer func() { wdg.MaxAge = time.Hour }()
+	doLock()
+	defer doUnlock()
+	cmn.Id = mutex.AllIds
+	if result := doWatchdog(); result != 0 {
+		t.Fatalf("wrong result of doWatchdog(): %d instead of 0", result)
+	}
+	wdg.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if result := doWatchdog(); result != 1 {
+		t.Fatalf("wrong result of doWatchdog(): %d instead of 1", result)
+	}
+	cmn.Id = "test-watchdog"
+}
+
+func TestInfo(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-info"
+	if result := doInfo(); result != 0 {
+		t.Fatalf("wrong result of doInfo(): %d instead of 0", result)
+	}
+	doLock()
+	defer doUnlock()
+	if result := doInfo(); result != 0 {
+		t.Fatalf("wrong result of doInfo(): %d instead of 0", result)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-run"
+	if got := doRun([]string{"sh", "-c", "test -f " + lockName() + " && exit 3"}); got != 3 {
+		t.Fatalf("wrong value of doRun() => %d instead of %d", got, 3)
+	}
+	if _, err := os.Stat(lockName()); !os.IsNotExist(err) {
+		t.Fatalf("lock file not released after run: %v", err)
+	}
+}
+
+func TestRunPidFile(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-run-pid-file"
+	defer func(pidFile string) { rn.PidFile = pidFile }(rn.PidFile)
+	rn.PidFile = path.Join(cmn.Root, "run.pid")
+	// The command exits with 0, only if the PID file names the command itself
+	script := "while [ ! -s " + rn.PidFile + " ]; do sleep 0.05; done; test \"$(cat " + rn.PidFile + ")\" = $$"
+	if got := doRun([]string{"sh", "-c", script}); got != 0 {
+		t.Fatalf("wrong value of doRun() => %d instead of %d", got, 0)
+	}
+	if _, err := os.Stat(rn.PidFile); !os.IsNotExist(err) {
+		t.Fatalf("PID file not removed after run: %v", err)
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-run-exit-code"
+	if got := doRun([]string{"sh", "-c", "kill -TERM $$"}); got != 128+15 {
+		t.Fatalf("wrong value of doRun() => %d instead of %d", got, 128+15)
+	}
+	marker := path.Join(cmn.Root, "marker")
+	if got := doRun([]string{"sh", "-c", "(sleep 0.2; touch " + marker + ") & exit 0"}); got != 0 {
+		t.Fatalf("wrong value of doRun() => %d instead of %d", got, 0)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("run finished before descendants of the command: %v", err)
+	}
+}
+
+func TestRunLostDescendants(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-run-lost-descendants"
+	defer func(refresh time.Duration) { lck.Refresh = refresh }(lck.Refresh)
+	lck.Refresh = 20 * time.Millisecond
+	done := make(chan struct{})
+	removed := make(chan struct{})
+	go func() {
+		defer close(removed)
+		time.Sleep(200 * time.Millisecond)
+		// Removed repeatedly, as a removal in the middle of a refresh may be undone by the refresh
+		for {
+			os.Remove(lockName())
+			select {
+			case <-done:
+				return
+			case <-time.After(15 * time.Millisecond):
+			}
+		}
+	}()
+	start := time.Now()
+	got := doRun([]string{"sh", "-c", "sleep 10 & exit 0"})
+	close(done)
+	<-removed
+	if got == 0 {
+		t.Fatal("wrong value of doRun() => 0 for a lost lock")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("descendants not terminated after the lock has been lost: %v", elapsed)
+	}
+}
+
+func TestRunLost(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command available")
+	}
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-run-lost"
+	defer func(refresh time.Duration) { lck.Refresh = refresh }(lck.Refresh)
+	lck.Refresh = 20 * time.Millisecond
+	done := make(chan struct{})
+	removed := make(chan struct{})
+	defer func() {
+		close(done)
+		<-removed
+	}()
+	go func() {
+		defer close(removed)
+		time.Sleep(200 * time.Millisecond)
+		// Removed repeatedly, as a removal in the middle of a refresh may be undone by the refresh
+		for {
+			os.Remove(lockName())
+			select {
+			case <-done:
+				return
+			case <-time.After(15 * time.Millisecond):
+			}
+		}
+	}()
+	start := time.Now()
+	if got := doRun([]string{"sleep", "10"}); got == 0 {
+		t.Fatal("wrong value of doRun() => 0 for a lost lock")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command not terminated after the lock has been lost: %v", elapsed)
+	}
+}
+
+func TestTestWait(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-test-wait"
+	defer func(pulse time.Duration) { lck.Pulse = pulse }(lck.Pulse)
+	lck.Pulse = 10 * time.Millisecond
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		time.Sleep(100 * time.Millisecond)
+		doLock()
+	}()
+	waitState(true)
+	<-locked
+	if !isLocked() {
+		t.Fatal("waitState(true) returned for an unlocked mutex")
+	}
+	unlocked := make(chan struct{})
+	go func() {
+		defer close(unlocked)
+		time.Sleep(100 * time.Millisecond)
+		doUnlock()
+	}()
+	waitState(false)
+	<-unlocked
+	if isLocked() {
+		t.Fatal("waitState(false) returned for a locked mutex")
+	}
+	defer func(timeout time.Duration) { tst.Timeout = timeout }(tst.Timeout)
+	tst.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	waitState(true)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waitState() did not time out: %v", elapsed)
+	}
+}
+
+func TestTestStale(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-test-stale"
+	defer func(limit time.Duration) { lck.Limit = limit }(lck.Limit)
+	lck.Limit = 50 * time.Millisecond
+	doLock()
+	defer doUnlock()
+	if got := doTest(); got != testLocked {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, testLocked)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := doTest(); got != testStale {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, testStale)
+	}
+	if got := doInfo(); got != testStale {
+		t.Fatalf("wrong value of doInfo() => %d instead of %d", got, testStale)
+	}
+	cmn.Id = "..."
+	if got := doTest(); got != testStale {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, testStale)
+	}
+	cmn.Id = "test-test-stale"
+}
+
+func TestRenew(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-renew"
+	defer func(limit time.Duration) { lck.Limit = limit }(lck.Limit)
+	lck.Limit = 100 * time.Millisecond
+	doLock()
+	defer doUnlock()
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		doRenew()
+	}
+	if got := doTest(); got != testLocked {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, testLocked)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "tenant/test-export"
+	defer func() { cmn.Owner = "" }()
+	cmn.Owner = "nightly"
+	doLock()
+	cmn.Id = mutex.AllIds
+	var snapshot bytes.Buffer
+	if got := doExport(&snapshot); got != 0 {
+		t.Fatalf("wrong value of doExport() => %d instead of %d", got, 0)
+	}
+	cmn.Root = temporaryCatalog(t)
+	if got := doImport(bytes.NewReader(snapshot.Bytes())); got != 0 {
+		t.Fatalf("wrong value of doImport() => %d instead of %d", got, 0)
+	}
+	cmn.Id = "tenant/test-export"
+	if md, err := newMutex().Metadata(); err != nil || md.Owner != "nightly" {
+		t.Fatalf("wrong result of doImport(): %+v (%v)", md, err)
+	}
+	// Locks cannot be imported over existing ones
+	cmn.Id = mutex.AllIds
+	if got := doImport(bytes.NewReader(snapshot.Bytes())); got != 1 {
+		t.Fatalf("wrong value of doImport() => %d instead of %d", got, 1)
+	}
+	cmn.Id = "tenant/test-export"
+}
+
+func TestMigrateRoot(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-migrate-root"
+	doLock()
+	defer func() { mr.To, mr.CopyHeld = "", false }()
+	mr.To, mr.CopyHeld = temporaryCatalog(t), true
+	if got := doMigrateRoot(); got != 0 {
+		t.Fatalf("wrong value of doMigrateRoot() => %d instead of %d", got, 0)
+	}
+	doUnlock()
+	cmn.Root = mr.To
+	if got := doTest(); got != testLocked {
+		t.Fatalf("wrong value of doTest() => %d instead of %d", got, testLocked)
+	}
+	doUnlock()
+}
+
+func TestExporter(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-exporter"
+	doLock()
+	defer doUnlock()
+	cmn.Id = mutex.AllIds
+	defer func() { cmn.Id = "test-exporter" }()
+	recorder := httptest.NewRecorder()
+	metricsHandler(newManager()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE fmutex_locked gauge\n",
+		"fmutex_locked{id=\"test-exporter\"} 1\n",
+		"fmutex_waiters{id=\"test-exporter\"} 0\n",
+		"fmutex_stale{id=\"test-exporter\"} 0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("metrics do not contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestExporterStatsd(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	sink := mutex.NewStatsd(server.LocalAddr().String(), mutex.DefaultStatsdPrefix, splitTags("env:test, team:batch")...)
+	defer sink.Close()
+	if err := sendMetrics(sink, []mutexSample{{id: "test-exporter", locked: true, waiters: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	for _, expected := range []string{
+		"fmutex.locked:1|g|#env:test,team:batch,id:test-exporter",
+		"fmutex.lock_age_seconds:0|g|#env:test,team:batch,id:test-exporter",
+		"fmutex.waiters:2|g|#env:test,team:batch,id:test-exporter",
+		"fmutex.stale:0|g|#env:test,team:batch,id:test-exporter",
+	} {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != expected {
+			t.Fatalf("wrong metric %q instead of %q", buf[:n], expected)
+		}
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-healthcheck"
+	defer func() { hc.Expect, cmn.Owner = ExpectHeldByMe, "" }()
+	cases := []struct {
+		expect string
+		locked int
+		free   int
+	}{
+		{ExpectHeldByMe, 0, 1},
+		{ExpectFresh, 0, 1},
+		{ExpectFree, 1, 0},
+	}
+	for _, c := range cases {
+		hc.Expect = c.expect
+		if got := doHealthcheck(); got != c.free {
+			t.Fatalf("wrong value of doHealthcheck() for %s and a free mutex => %d instead of %d", c.expect, got, c.free)
+		}
+		doLock()
+		if got := doHealthcheck(); got != c.locked {
+			t.Fatalf("wrong value of doHealthcheck() for %s and a locked mutex => %d instead of %d", c.expect, got, c.locked)
+		}
+		doUnlock()
+	}
+	cmn.Owner = "job"
+	doLock()
+	defer doUnlock()
+	hc.Expect = ExpectHeldByMe
+	cmn.Owner = "other-job"
+	if got := doHealthcheck(); got != 1 {
+		t.Fatalf("wrong value of doHealthcheck() for a mutex of another owner => %d instead of %d", got, 1)
+	}
+}
+
+func TestGc(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-gc"
+	defer func(olderThan time.Duration) { swp.OlderThan = olderThan }(swp.OlderThan)
+	// Advertised by the lock, so sweeping waits only briefly for the holder to veto the challenge
+	defer func(refresh time.Duration) { lck.Refresh = refresh }(lck.Refresh)
+	lck.Refresh = 10 * time.Millisecond
+	doLock()
+	cmn.Id = mutex.AllIds
+	defer func() { cmn.Id = "test-gc" }()
+	if got := sweep(newManager()); got != 0 {
+		t.Fatalf("wrong value of sweep() => %d instead of %d", got, 0)
+	}
+	swp.OlderThan = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	if got := sweep(newManager()); got != 1 {
+		t.Fatalf("wrong value of sweep() => %d instead of %d", got, 1)
+	}
+}
+
+func TestList(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "tenant/jobs/nightly"
+	doLock()
+	defer doUnlock()
+	defer func(long bool) { ls.Long = long }(ls.Long)
+	for _, long := range []bool{false, true} {
+		ls.Long = long
+		cmn.Id = "*/jobs/*"
+		if got := doList(); got != 0 {
+			t.Fatalf("wrong value of doList() => %d instead of %d", got, 0)
+		}
+	}
+	cmn.Id = "tenant/jobs/nightly"
+}
+
+func TestListFilters(t *testing.T) {
+	defer func() { ls.Selector, ls.MinAge, ls.HolderHost, ls.Sort = nil, 0, "", "" }()
+	infos := []mutex.Info{
+		{Id: "a", State: mutex.StateLocked, Holder: mutex.Holder{Host: "host-x"}, Age: time.Minute, Waiters: 3},
+		{Id: "b", State: mutex.StateLocked, Holder: mutex.Holder{Host: "host-y"}, Age: 2 * time.Hour, Waiters: 1,
+			Labels: map[string]string{"team": "etl"}},
+		{Id: "c", State: mutex.StateStale, Holder: mutex.Holder{Host: "Host-X"}, Age: 3 * time.Hour, Waiters: 1},
+		{Id: "d", State: mutex.StateUnlocked, Waiters: 5},
+	}
+	filtered := func() []string {
+		var result []string
+		for _, info := range infos {
+			if listed(info) {
+				result = append(result, info.Id)
+			}
+		}
+		return result
+	}
+	if got, want := filtered(), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong mutexes listed without filters: %v instead of %v", got, want)
+	}
+	ls.MinAge = time.Hour
+	if got, want := filtered(), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong mutexes listed by -%s: %v instead of %v", FlagMinAge, got, want)
+	}
+	ls.HolderHost = "host-x"
+	if got, want := filtered(), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong mutexes listed by -%s: %v instead of %v", FlagHolderHost, got, want)
+	}
+	ls.MinAge, ls.HolderHost = 0, ""
+	if err := ls.Selector.Set("team=etl"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filtered(), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong mutexes listed by -%s: %v instead of %v", FlagLabel, got, want)
+	}
+
+	for key, want := range map[string][]string{
+		SortId:      {"a", "b", "c", "d"},
+		SortAge:     {"c", "b", "a", "d"},
+		SortWaiters: {"d", "a", "b", "c"},
+	} {
+		sortInfos(infos, key)
+		var got []string
+		for _, info := range infos {
+			got = append(got, info.Id)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("wrong order of mutexes sorted by %s: %v instead of %v", key, got, want)
+		}
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-list-sorted"
+	doLock()
+	defer doUnlock()
+	defer func() { ls.Sort, ls.MinAge, cmn.Id = "", 0, "test-list-sorted" }()
+	cmn.Id = mutex.AllIds
+	ls.Sort, ls.MinAge = SortAge, time.Millisecond
+	if got := doList(); got != 0 {
+		t.Fatalf("wrong value of doList() => %d instead of %d", got, 0)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-labels"
+	defer func(olderThan time.Duration) { swp.OlderThan = olderThan }(swp.OlderThan)
+	// Advertised by the lock, so sweeping waits only briefly for the holder to veto the challenge
+	defer func(refresh time.Duration) { lck.Refresh = refresh }(lck.Refresh)
+	lck.Refresh = 10 * time.Millisecond
+	defer func() { lck.Labels, swp.Selector = nil, nil }()
+	if err := lck.Labels.Set("team=etl"); err != nil {
+		t.Fatal(err)
+	}
+	doLock()
+	cmn.Id = mutex.AllIds
+	defer func() { cmn.Id = "test-labels" }()
+	swp.OlderThan = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	if err := swp.Selector.Set("team=web"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sweep(newManager()); got != 0 {
+		t.Fatalf("wrong value of sweep() => %d instead of %d", got, 0)
+	}
+	swp.Selector = nil
+	if err := swp.Selector.Set("team=etl"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sweep(newManager()); got != 1 {
+		t.Fatalf("wrong value of sweep() => %d instead of %d", got, 1)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Mirror = temporaryCatalog(t)
+	cmn.Id = "test-reconcile"
+	defer func() { cmn.Mirror = "" }()
+	doLock()
+	defer doUnlock()
+	lockPath := path.Join(cmn.Mirror, strings.TrimPrefix(lockName(), cmn.Root))
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatalf("lock not mirrored: %v", err)
+	}
+	cmn.Id = mutex.AllIds
+	defer func() { cmn.Id = "test-reconcile" }()
+	if got := doReconcile(); got != 0 {
+		t.Fatalf("wrong value of doReconcile() => %d instead of %d", got, 0)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("lock not reconciled: %v", err)
+	}
+}
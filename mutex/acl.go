@@ -0,0 +1,131 @@
+package mutex
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+)
+
+// An aclFileName is the name of the optional file in the mutex directory listing users and groups
+// permitted to operate the mutex. Each non-empty line, except comments starting with "#", has the form:
+//
+//	user:<name or uid> [lock] [release]
+//	group:<name or gid> [lock] [release]
+//
+// If no operations are listed, the entry permits all of them.
+// Without the file, everybody having access to the directory may operate the mutex.
+const aclFileName = ".acl"
+
+// ACL operations.
+const (
+	AclLock    = "lock"
+	AclRelease = "release"
+)
+
+// ErrAccessDenied is returned when the mutex ACL does not permit the requested operation.
+var ErrAccessDenied = errors.New("access denied")
+
+type aclEntry struct {
+	kind       string
+	name       string
+	operations []string
+}
+
+// AclPath returns the path of the (optional) ACL file of the mutex.
+func (m *Mutex) AclPath() string {
+	return path.Join(m.directory, aclFileName)
+}
+
+// checkAccess verifies that the current user is permitted to perform the operation on the mutex.
+func (m *Mutex) checkAccess(operation string) error {
+	entries, err := readAcl(m.AclPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot read ACL of mutex %s: %w", m.id, err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("cannot determine current user: %w", err)
+	}
+	groups, _ := userGroups(u)
+	for _, e := range entries {
+		if !e.permits(operation) {
+			continue
+		}
+		switch e.kind {
+		case "user":
+			if e.name == u.Username || e.name == u.Uid {
+				return nil
+			}
+		case "group":
+			if groups[e.name] {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: user %s may not %s mutex %s", ErrAccessDenied, u.Username, operation, m.id)
+}
+
+func (e aclEntry) permits(operation string) bool {
+	if len(e.operations) == 0 {
+		return true
+	}
+	for _, op := range e.operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// userGroups returns names and ids of groups the user belongs to.
+func userGroups(u *user.User) (map[string]bool, error) {
+	gids, err := u.GroupIds()
+	if err != nil {
+		gids = []string{u.Gid}
+	}
+	result := make(map[string]bool)
+	for _, gid := range gids {
+		result[gid] = true
+		if g, err := user.LookupGroupId(gid); err == nil {
+			result[g.Name] = true
+		}
+	}
+	return result, err
+}
+
+func readAcl(fileName string) ([]aclEntry, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var result []aclEntry
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		parts := strings.SplitN(fields[0], ":", 2)
+		if len(parts) != 2 || (parts[0] != "user" && parts[0] != "group") || parts[1] == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry \"%s\"", fileName, lineNo, fields[0])
+		}
+		entry := aclEntry{kind: parts[0], name: parts[1]}
+		for _, op := range fields[1:] {
+			if op != AclLock && op != AclRelease {
+				return nil, fmt.Errorf("%s:%d: invalid operation \"%s\"", fileName, lineNo, op)
+			}
+			entry.operations = append(entry.operations, op)
+		}
+		result = append(result, entry)
+	}
+	return result, scanner.Err()
+}
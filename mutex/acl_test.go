@@ -0,0 +1,48 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"testing"
+)
+
+func writeAcl(t *testing.T, mx *Mutex, content string) {
+	if err := os.WriteFile(mx.AclPath(), []byte(content), 0600); err != nil {
+		t.Fatalf("cannot write ACL: %v", err)
+	}
+}
+
+func TestAcl(t *testing.T) {
+	const mutexId = "acl-test-mutex"
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+
+	writeAcl(t, mx, "# only locking\nuser:nobody-at-all\nuser:"+u.Username+" lock\n")
+	if err := mx.TryLock(0); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	if err := mx.TryUnlock(); !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("wrong result of TryUnlock(): %v instead of %v", err, ErrAccessDenied)
+	}
+
+	writeAcl(t, mx, fmt.Sprintf("group:%s\n", u.Gid))
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatalf("TryUnlock failed (%v), but should succeed.", err)
+	}
+
+	writeAcl(t, mx, "user:nobody-at-all\n")
+	if err := mx.TryLock(0); !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrAccessDenied)
+	}
+
+	writeAcl(t, mx, "someone\n")
+	if err := mx.TryLock(0); err == nil || errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("wrong result of TryLock() with invalid ACL: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package mutex
+
+import "time"
+
+// WithAdaptivePulse makes the Mutex adapt delays between locking attempts: starting with its pulse,
+// the delay doubles after each unsuccessful attempt up to maxPulse, while the lock stays held
+// by the same holder, and it is reset after a release of the lock has been observed.
+// This reduces load of the lock directory caused by many waiters. By default, the pulse is fixed.
+func WithAdaptivePulse(maxPulse time.Duration) Option {
+	return func(m *Mutex) {
+		m.maxPulse = maxPulse
+	}
+}
+
+// A pulseBackoff computes delays between locking attempts of a single acquisition.
+type pulseBackoff struct {
+	delay   time.Duration
+	created time.Time // Creation time of the last observed lock
+}
+
+// next returns the delay before the next locking attempt, after an unsuccessful one.
+// The competing lock is read by the reader, so it is actually read only after its change.
+func (b *pulseBackoff) next(m *Mutex, target string, reader *lockReader) time.Duration {
+	if m.maxPulse <= m.pulse {
+		return m.pulse
+	}
+	md, _ := reader.read(m, target)
+	switch {
+	case md == nil: // Released meanwhile
+		b.delay, b.created = m.pulse, time.Time{}
+	case b.delay > 0 && md.Created.Equal(b.created): // Still held by the same holder
+		b.grow(m)
+	default:
+		b.delay, b.created = m.pulse, md.Created
+	}
+	return b.delay
+}
+
+// grow doubles the delay up to the maximal pulse.
+func (b *pulseBackoff) grow(m *Mutex) {
+	if b.delay *= 2; b.delay > m.maxPulse || b.delay <= 0 {
+		b.delay = m.maxPulse
+	}
+}
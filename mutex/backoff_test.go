@@ -0,0 +1,49 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptivePulse(t *testing.T) {
+	const mutexId = "backoff-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder := newTestMutex(mutexRoot, mutexId)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithAdaptivePulse(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder.Lock()
+	var b pulseBackoff
+	var r lockReader
+	for _, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := b.next(mx, mx.LockPath(), &r); got != want*time.Millisecond {
+			t.Fatalf("wrong delay %v instead of %v", got, want*time.Millisecond)
+		}
+	}
+	// A refresh of the same holder keeps backing off
+	md, err := holder.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := holder.writeMetadata(holder.LockPath(), md); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.next(mx, mx.LockPath(), &r); got != 50*time.Millisecond {
+		t.Fatalf("wrong delay %v instead of %v after a refresh", got, 50*time.Millisecond)
+	}
+	holder.Unlock()
+	if got := b.next(mx, mx.LockPath(), &r); got != 10*time.Millisecond {
+		t.Fatalf("wrong delay %v instead of %v after a release", got, 10*time.Millisecond)
+	}
+
+	fixed := newTestMutex(mutexRoot, mutexId)
+	var f pulseBackoff
+	var fr lockReader
+	for i := 0; i < 3; i++ {
+		if got := f.next(fixed, fixed.LockPath(), &fr); got != DefaultPulse {
+			t.Fatalf("wrong delay %v instead of %v", got, DefaultPulse)
+		}
+	}
+}
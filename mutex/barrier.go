@@ -0,0 +1,156 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A barrierGenerationTemplate defines name template of the file keeping the current generation of a Barrier.
+const barrierGenerationTemplate = "%s-barrier.gen"
+
+// A barrierArrivalTemplate defines name template of arrival files of a Barrier generation.
+const barrierArrivalTemplate = "%s-barrier-%d-*.arrival"
+
+// A Barrier makes a fixed number of participating processes (possibly on different hosts) wait for each other:
+// Await returns only once all of them have arrived. Each arrival is recorded as a file in the directory
+// of the Barrier's Mutex, which guards transitions of the barrier. Once the last participant arrives,
+// the barrier moves to the next generation, so it can be reused for subsequent phases.
+// Like a Mutex, a Barrier instance is used by a single participant; each participant creates its own.
+type Barrier struct {
+	m *Mutex
+	n int
+}
+
+// NewBarrier creates a Barrier of n participants with given id under root.
+func NewBarrier(root string, id string, n int, opts ...Option) (*Barrier, error) {
+	m, err := NewMutex(root, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newBarrier(m, n)
+}
+
+// Barrier creates a Barrier of n participants with given id, using the Manager's configuration.
+func (mgr *Manager) Barrier(id string, n int) (*Barrier, error) {
+	m, err := mgr.Mutex(id)
+	if err != nil {
+		return nil, err
+	}
+	return newBarrier(m, n)
+}
+
+func newBarrier(m *Mutex, n int) (*Barrier, error) {
+	if n <= 0 {
+		return nil, errors.New("number of barrier participants must be positive")
+	}
+	return &Barrier{m: m, n: n}, nil
+}
+
+// Await records arrival of the current participant and waits until all the participants have arrived
+// or the context is done (ErrExpired, the arrival is withdrawn then). Returns the generation passed.
+func (b *Barrier) Await(ctx context.Context) (uint64, error) {
+	gen, arrival, err := b.arrive(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		current, err := b.generation()
+		if err != nil {
+			return 0, err
+		}
+		if current > gen {
+			return gen, nil
+		}
+		if sleepOrDone(ctx, b.m.pulse) {
+			return 0, b.withdraw(gen, arrival)
+		}
+	}
+}
+
+// arrive records arrival of the current participant in the current generation, which is advanced,
+// if the participant is the last one. Returns the generation and the arrival file.
+func (b *Barrier) arrive(ctx context.Context) (uint64, string, error) {
+	if err := b.m.LockWithContext(ctx); err != nil {
+		return 0, "", err
+	}
+	defer b.m.TryUnlock()
+	gen, err := b.generation()
+	if err != nil {
+		return 0, "", err
+	}
+	f, err := ioutil.TempFile(b.m.directory, fmt.Sprintf(barrierArrivalTemplate, b.m.name(), gen))
+	if err != nil {
+		return 0, "", fmt.Errorf("cannot record arrival at barrier %s: %w", b.m.id, err)
+	}
+	f.Close()
+	arrivals, err := b.arrivals(gen)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(arrivals) >= b.n {
+		if err := b.m.replaceFile(b.generationPath(), []byte(fmt.Sprintf("%d\n", gen+1))); err != nil {
+			return 0, "", fmt.Errorf("cannot advance barrier %s: %w", b.m.id, err)
+		}
+		for _, arrival := range arrivals {
+			removeIfPossible(arrival)
+		}
+	}
+	return gen, f.Name(), nil
+}
+
+// withdraw removes the arrival of the current participant, unless the generation has been passed meanwhile.
+func (b *Barrier) withdraw(gen uint64, arrival string) error {
+	if err := b.m.TryLock(0); err != nil {
+		return err
+	}
+	defer b.m.TryUnlock()
+	if current, err := b.generation(); err != nil {
+		return err
+	} else if current > gen {
+		return nil
+	}
+	removeIfPossible(arrival)
+	return ErrExpired
+}
+
+// Arrived returns the number of participants waiting at the barrier.
+func (b *Barrier) Arrived() (int, error) {
+	gen, err := b.generation()
+	if err != nil {
+		return 0, err
+	}
+	arrivals, err := b.arrivals(gen)
+	return len(arrivals), err
+}
+
+// generation returns the current generation of the barrier.
+func (b *Barrier) generation() (uint64, error) {
+	data, err := ioutil.ReadFile(b.generationPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	result, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupted generation file %s: %w", b.generationPath(), err)
+	}
+	return result, nil
+}
+
+// arrivals returns arrival files of the generation.
+func (b *Barrier) arrivals(gen uint64) ([]string, error) {
+	return filepath.Glob(path.Join(b.m.directory, fmt.Sprintf(barrierArrivalTemplate, b.m.name(), gen)))
+}
+
+func (b *Barrier) generationPath() string {
+	return path.Join(b.m.directory, expandTemplate(barrierGenerationTemplate, b.m.name()))
+}
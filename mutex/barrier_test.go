@@ -0,0 +1,62 @@
+package mutex
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBarrier(t *testing.T) {
+	const barrierId = "barrier-test"
+	const n = 3
+	mutexRoot := temporaryCatalog(t)
+	var arrived int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b, err := NewBarrier(mutexRoot, barrierId, n)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b.m.pulse = 10 * time.Millisecond
+			for phase := uint64(0); phase < 2; phase++ {
+				time.Sleep(time.Duration(i) * 20 * time.Millisecond)
+				atomic.AddInt32(&arrived, 1)
+				gen, err := b.Await(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if gen != phase {
+					t.Errorf("wrong generation %d instead of %d", gen, phase)
+				}
+				if got := atomic.LoadInt32(&arrived); got < int32(n*(phase+1)) {
+					t.Errorf("barrier passed after %d arrivals instead of %d", got, n*(phase+1))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestBarrierTimeout(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	b, err := NewBarrier(mutexRoot, "barrier-timeout-test", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.m.pulse = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.Await(ctx); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	if n, err := b.Arrived(); err != nil || n != 0 {
+		t.Fatalf("wrong number of arrivals %d (%v) instead of 0", n, err)
+	}
+}
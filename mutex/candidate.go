@@ -0,0 +1,85 @@
+package mutex
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// A candidatesDirectory is the subdirectory of a mutex directory keeping its candidate files,
+// so they do not clutter the mutex directory and can be told apart from lock files cheaply.
+const candidatesDirectory = ".candidates"
+
+// WithAnonymousCandidates makes the Mutex create candidate files without a name (O_TMPFILE) on Linux
+// and link them directly to the lock file, so a crashed waiter never leaves a candidate file behind.
+// Such waiters are not visible to Waiters. The option is ignored on other platforms, on filesystems
+// not supporting O_TMPFILE, and in the WithXattrMetadata, WithMtimeFreshness, WithCifs and dot-lock modes.
+func WithAnonymousCandidates() Option {
+	return func(m *Mutex) {
+		m.anonymousCandidates = true
+	}
+}
+
+// createCandidate creates the candidate file of a locking attempt; anonymous reports whether it has no name.
+func (m *Mutex) createCandidate() (f *os.File, anonymous bool, err error) {
+	dir := m.candidateDirectory()
+	if dir != m.directory {
+		if err := mkdirAll(m.directory, candidatesDirectory, m.dirMode); err != nil {
+			return nil, false, err
+		}
+	}
+	if m.anonymousCandidates && !m.xattrs && !m.mtime && !m.dotLock && !m.cifs {
+		if f, err := createAnonymousFile(dir, m.fileMode); err == nil {
+			return f, true, nil
+		}
+	}
+	if f, err = ioutil.TempFile(dir, m.candidatePattern()); err != nil {
+		return nil, false, err
+	}
+	if err := os.Chmod(f.Name(), m.fileMode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, false, err
+	}
+	return f, false, nil
+}
+
+// candidateDirectory returns the directory of candidate files of the Mutex.
+// Dot-locks keep the classic convention of candidates placed next to the lock file.
+func (m *Mutex) candidateDirectory() string {
+	if m.dotLock {
+		return m.directory
+	}
+	return path.Join(m.directory, candidatesDirectory)
+}
+
+// linkCandidate links the candidate file to the lock file, failing if the lock file exists.
+func linkCandidate(f *os.File, anonymous bool, target string) error {
+	if anonymous {
+		return linkAnonymousFile(f, target)
+	}
+	return os.Link(f.Name(), target)
+}
+
+// linkedCandidate reports whether the candidate file has become the lock file, whatever the result
+// of linking (linkErr). On network filesystems a reported link error may have actually succeeded
+// and vice versa, so the lock is acquired only if the lock file shares the inode of the candidate
+// and has the expected number of links: the lock file and the candidate, unless it is anonymous.
+func linkedCandidate(f *os.File, anonymous bool, target string, linkErr error) bool {
+	candidateInfo, err := f.Stat()
+	if err != nil {
+		return linkErr == nil
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil || !os.SameFile(candidateInfo, targetInfo) {
+		return false
+	}
+	expected := uint64(2)
+	if anonymous {
+		expected = 1
+	}
+	if count, ok := linkCount(targetInfo); ok && count != expected {
+		return false
+	}
+	return true
+}
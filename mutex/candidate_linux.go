@@ -0,0 +1,56 @@
+//go:build linux && (386 || amd64 || arm || arm64 || riscv64)
+// +build linux
+// +build 386 amd64 arm arm64 riscv64
+
+package mutex
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	oTmpfile        = 0x400000 | syscall.O_DIRECTORY // O_TMPFILE, missing in package syscall
+	atFdCwd         = -100                           // AT_FDCWD
+	atSymlinkFollow = 0x400                          // AT_SYMLINK_FOLLOW
+	procSelfFd      = "/proc/self/fd"
+)
+
+// createAnonymousFile creates a file without a name in the directory.
+func createAnonymousFile(dir string, mode os.FileMode) (*os.File, error) {
+	// The file can be linked only through /proc without extra privileges
+	if _, err := os.Stat(procSelfFd); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(dir, os.O_RDWR|oTmpfile, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// linkAnonymousFile gives the file created by createAnonymousFile the name, failing if it exists.
+func linkAnonymousFile(f *os.File, name string) error {
+	oldName := fmt.Sprintf("%s/%d", procSelfFd, f.Fd())
+	oldPtr, err := syscall.BytePtrFromString(oldName)
+	if err != nil {
+		return err
+	}
+	newPtr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	fdCwd := atFdCwd
+	_, _, errno := syscall.Syscall6(syscall.SYS_LINKAT, uintptr(fdCwd), uintptr(unsafe.Pointer(oldPtr)),
+		uintptr(fdCwd), uintptr(unsafe.Pointer(newPtr)), atSymlinkFollow, 0)
+	if errno != 0 {
+		return &os.LinkError{Op: "link", Old: oldName, New: name, Err: errno}
+	}
+	return nil
+}
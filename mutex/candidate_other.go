@@ -0,0 +1,21 @@
+//go:build !linux || !(386 || amd64 || arm || arm64 || riscv64)
+// +build !linux !386,!amd64,!arm,!arm64,!riscv64
+
+package mutex
+
+import (
+	"errors"
+	"os"
+)
+
+var errAnonymousUnsupported = errors.New("anonymous files not supported")
+
+// createAnonymousFile creates a file without a name in the directory. Not supported on this platform.
+func createAnonymousFile(dir string, mode os.FileMode) (*os.File, error) {
+	return nil, errAnonymousUnsupported
+}
+
+// linkAnonymousFile gives the file created by createAnonymousFile the name. Not supported on this platform.
+func linkAnonymousFile(f *os.File, name string) error {
+	return errAnonymousUnsupported
+}
@@ -0,0 +1,76 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAnonymousCandidates(t *testing.T) {
+	const mutexId = "anonymous-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithAnonymousCandidates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, anonymous, err := mx.createCandidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if !anonymous {
+		t.Skip("anonymous files not supported")
+	}
+	mx.Lock()
+	if md, err := mx.Metadata(); err != nil || md.Id != mutexId {
+		t.Fatalf("wrong metadata %+v (%v)", md, err)
+	}
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithAnonymousCandidates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.TryLock(30 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	mx.Unlock()
+	if err := waiter.TryLock(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waiter.Unlock()
+	if matches, _ := filepath.Glob(filepath.Join(mutexRoot, mutexId, candidatesDirectory, "*")); len(matches) != 0 {
+		t.Fatalf("unexpected files left: %v", matches)
+	}
+}
+
+func TestLinkedCandidate(t *testing.T) {
+	const mutexId = "linked-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	f, anonymous, err := mx.createCandidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	target := mx.LockPath()
+	if linkedCandidate(f, anonymous, target, nil) {
+		t.Fatal("missing lock file reported as linked")
+	}
+	if err := os.WriteFile(target, []byte("other\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if linkedCandidate(f, anonymous, target, nil) {
+		t.Fatal("lock file of another holder reported as linked")
+	}
+	os.Remove(target)
+	if err := linkCandidate(f, anonymous, target); err != nil {
+		t.Fatal(err)
+	}
+	// A link reported as failed, which has actually succeeded
+	if !linkedCandidate(f, anonymous, target, errors.New("stale NFS reply")) {
+		t.Fatal("linked candidate not recognized")
+	}
+}
@@ -0,0 +1,129 @@
+package mutex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// A challengeTemplate defines name template of the file announcing the intent to break a stale lock.
+const challengeTemplate = "%s-mutex.challenge"
+
+// challengeChecks determines how many times per refresh period KeepAlive checks for challenges.
+const challengeChecks = 4
+
+// A Challenge announces the intent of a waiter to break the lock of a Mutex, which looks stale.
+// The holder vetoes it by refreshing the lock within the grace period, see WithBreakGrace.
+type Challenge struct {
+	Breaker   Holder    `json:"breaker"`         // The waiter going to break the lock
+	Trace     string    `json:"trace,omitempty"` // Identifier of the challenged acquisition
+	Timestamp int64     `json:"timestamp"`       // Timestamp of the challenged lock, in milliseconds
+	Created   time.Time `json:"created"`         // When the challenge has been made
+	Deadline  time.Time `json:"deadline"`        // When the lock is going to be broken, unless refreshed
+}
+
+// WithBreakGrace sets the grace period of the two-phase breaking of stale locks: a waiter finding a lock
+// stale announces a Challenge first and breaks the lock only if it has not been refreshed for the grace
+// period, so slow but alive holders, or holders with a skewed clock, can veto it. By default the grace
+// period is the refresh period advertised by the holder (or of the Mutex, if unknown). If the grace is
+// negative, stale locks are broken immediately. Locks of dead holders, locks with an invalid signature
+// and locks broken by WithStealThreshold are broken immediately in any case, and so are dot-locks.
+func WithBreakGrace(grace time.Duration) Option {
+	return func(m *Mutex) {
+		m.breakGrace = grace
+	}
+}
+
+// challengePath returns the path of the challenge file of the Mutex.
+func (m *Mutex) challengePath() string {
+	return path.Join(m.directory, expandTemplate(challengeTemplate, m.name()))
+}
+
+// breakStale breaks the lock of the target file, which has been read by the reader with given timestamp.
+// If challenged is true, the lock is challenged first, see WithBreakGrace.
+// Returns true if the lock has been broken, false if it has been vetoed or released meanwhile.
+func (m *Mutex) breakStale(ctx context.Context, target string, reader *lockReader, timestamp int64,
+	challenged bool) bool {
+	info, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	md := reader.md
+	grace := m.breakGrace
+	if grace == 0 {
+		grace = reader.refresh(m)
+	}
+	if challenged && grace > 0 && !m.dotLock {
+		c := Challenge{Breaker: currentHolder(), Timestamp: timestamp, Created: time.Now().UTC()}
+		c.Deadline = c.Created.Add(grace)
+		if md != nil {
+			c.Trace = md.Trace
+		}
+		data, err := json.Marshal(&c)
+		if err != nil || m.replaceFile(m.challengePath(), data) != nil {
+			return false
+		}
+		defer m.removeChallenge(c.Breaker)
+		if sleepOrDone(ctx, grace) {
+			return false
+		}
+		// Vetoed, if the holder has refreshed the lock meanwhile
+		if current, err := os.Stat(target); err != nil || !os.SameFile(info, current) {
+			return false
+		}
+		if current, _ := reader.timestamp(m, target); current != timestamp {
+			return false
+		}
+	}
+	if os.Remove(target) != nil {
+		return false
+	}
+	m.syncDirectory()
+	details := ""
+	if md != nil {
+		details = fmt.Sprintf("held by %s", md.Holder)
+	}
+	if challenged && grace > 0 && !m.dotLock {
+		details += fmt.Sprintf(", not refreshed within grace period %v", grace)
+	}
+	m.emit(Event{Kind: EventStaleBroken, Path: target, Info: details})
+	return true
+}
+
+// Challenged returns the Challenge of the lock held by the Mutex, if a waiter is going to break it as stale
+// (see WithBreakGrace), so the holder can abort its work or refresh the lock (see Touch) to veto it.
+// Returns nil if the lock is not challenged. Holders using KeepAlive are notified by EventChallenged.
+func (m *Mutex) Challenged() (*Challenge, error) {
+	c, err := m.readChallenge()
+	if c == nil || c.Trace != m.Trace() {
+		return nil, err
+	}
+	return c, nil
+}
+
+// removeChallenge removes the challenge file of the Mutex, if made by the breaker.
+func (m *Mutex) removeChallenge(breaker Holder) {
+	if c, _ := m.readChallenge(); c != nil && c.Breaker == breaker {
+		os.Remove(m.challengePath())
+	}
+}
+
+// readChallenge returns the current Challenge of the lock of the Mutex, nil if there is none.
+func (m *Mutex) readChallenge() (*Challenge, error) {
+	data, err := ioutil.ReadFile(m.challengePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var c Challenge
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid challenge of lock %s: %w", m.id, err)
+	}
+	return &c, nil
+}
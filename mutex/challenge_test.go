@@ -0,0 +1,119 @@
+package mutex
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBreakChallenge(t *testing.T) {
+	const mutexId = "challenge-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	// A slow, but alive holder vetoes the first challenge
+	vetoed := make(chan error, 1)
+	go func() {
+		for {
+			if c, err := holder.readChallenge(); err != nil || c != nil {
+				if err == nil {
+					err = holder.Touch()
+				}
+				vetoed <- err
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 50*time.Millisecond,
+		WithBreakGrace(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.TryLock(350 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	select {
+	case err := <-vetoed:
+		if err != nil {
+			t.Fatalf("veto failed: %v", err)
+		}
+	default:
+		t.Fatal("the lock has not been challenged")
+	}
+	if holder.When().IsZero() {
+		t.Fatal("a vetoed lock has been broken")
+	}
+	start := time.Now()
+	if err := waiter.TryLock(2 * time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer waiter.Unlock()
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("the lock has been broken after %v, before the grace period", elapsed)
+	}
+	if _, err := os.Stat(waiter.challengePath()); !os.IsNotExist(err) {
+		t.Fatalf("the challenge has not been removed (%v)", err)
+	}
+}
+
+func TestChallengeNotification(t *testing.T) {
+	const mutexId = "challenged-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	events := make(chan Event, 10)
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 400*time.Millisecond, time.Hour,
+		WithEventHandler(func(e Event) {
+			if e.Kind == EventChallenged {
+				events <- e
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer holder.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := holder.KeepAlive(ctx)
+	if c, err := holder.Challenged(); err != nil || c != nil {
+		t.Fatalf("wrong challenge %v (%v) instead of none", c, err)
+	}
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, time.Hour,
+		WithBreakGrace(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reader lockReader
+	timestamp, err := reader.timestamp(waiter, waiter.LockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The holder is notified well before its next regular refresh and vetoes the challenge
+	if waiter.breakStale(context.Background(), waiter.LockPath(), &reader, timestamp, true) {
+		t.Fatal("the lock has been broken, but should be vetoed")
+	}
+	select {
+	case e := <-events:
+		if e.Path != holder.challengePath() {
+			t.Fatalf("wrong path %s instead of %s", e.Path, holder.challengePath())
+		}
+	default:
+		t.Fatal("the holder has not been notified of the challenge")
+	}
+	select {
+	case err := <-lost:
+		t.Fatalf("the lock has been lost: %v", err)
+	default:
+	}
+	if holder.When().IsZero() {
+		t.Fatal("a vetoed lock has been broken")
+	}
+}
@@ -0,0 +1,67 @@
+package mutex
+
+import (
+	"os"
+	"time"
+)
+
+// sharingRetries determines how many times an operation failed due to a sharing violation is retried.
+const sharingRetries = 5
+
+// sharingDelay determines delay before the first retry of an operation failed due to a sharing violation.
+// Delays of subsequent retries are doubled.
+const sharingDelay = 20 * time.Millisecond
+
+// WithCifs makes the Mutex compatible with SMB/CIFS (Windows) file shares, which do not support hard links:
+// the lock file is created exclusively (O_CREATE|O_EXCL) instead of linking a candidate to it,
+// and mutex directories are named in lower case, so ids differing only in case share the same mutex
+// on both case-sensitive and case-insensitive filesystems. All processes sharing the mutex have to use the option.
+func WithCifs() Option {
+	return func(m *Mutex) {
+		m.cifs = true
+	}
+}
+
+// claimLock tries to turn the candidate into the lock file and reports whether it has succeeded.
+func (m *Mutex) claimLock(candidate *os.File, anonymous bool, target string, md *Metadata) bool {
+	if m.cifs {
+		return m.createExclusive(target, md) == nil
+	}
+	return linkedCandidate(candidate, anonymous, target, linkCandidate(candidate, anonymous, target))
+}
+
+// createExclusive creates the lock file with the metadata, failing if the lock file exists.
+// The file is visible before its metadata is written, see unpublished.
+func (m *Mutex) createExclusive(target string, md *Metadata) error {
+	f, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_EXCL, m.fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := m.writeCandidate(f, md); err != nil {
+		f.Close()
+		os.Remove(target)
+		return err
+	}
+	return f.Close()
+}
+
+// unpublished reports whether the lock file last read by the reader, created exclusively in the CIFS mode,
+// has no metadata yet, i.e. it is being written by its creator (see createExclusive), unless it has stayed so
+// for longer than the dead timeout. Such a lock is not considered dead for a missing signature (see WithSecret).
+func (m *Mutex) unpublished(reader *lockReader) bool {
+	return m.cifs && reader.info != nil && reader.md != nil && reader.md.Version == LegacyVersion &&
+		time.Since(reader.info.ModTime()) < m.deadAgeRecovery
+}
+
+// retrySharing calls fn, retrying it with growing delays as long as it fails due to a sharing violation,
+// i.e. because another process has the file open on a Windows share.
+func retrySharing(fn func() error) error {
+	delay := sharingDelay
+	err := fn()
+	for i := 0; i < sharingRetries && sharingViolation(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package mutex
+
+// sharingViolation reports whether the error is caused by another process having the file open.
+// Sharing violations are specific to Windows.
+func sharingViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,65 @@
+package mutex
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCifs(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, "CIFS-Test-Mutex", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout, WithCifs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewMutexExt(mutexRoot, "cifs-test-mutex", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout, WithCifs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mx.LockPath() != other.LockPath() {
+		t.Fatalf("wrong lock path \"%s\" instead of \"%s\"", mx.LockPath(), other.LockPath())
+	}
+	mx.Lock()
+	if err := other.TryLock(50 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	if md, err := mx.Metadata(); err != nil || md.Token == 0 {
+		t.Fatalf("wrong metadata %+v (%v)", md, err)
+	}
+	mx.Unlock()
+	if err := other.TryLock(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	other.Unlock()
+}
+
+func TestCifsUnpublished(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	secret := WithSecret([]byte("secret"))
+	mx, err := NewMutexExt(mutexRoot, "cifs-test-mutex", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithCifs(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.init(); err != nil {
+		t.Fatal(err)
+	}
+	// Created exclusively, but its metadata not written yet
+	f, err := os.OpenFile(mx.LockPath(), os.O_RDWR|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := mx.TryLock(50 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	// Left empty longer than the dead timeout
+	old := time.Now().Add(-2 * DefaultDeadTimeout)
+	if err := os.Chtimes(mx.LockPath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	mx.Unlock()
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package mutex
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorSharingViolation syscall.Errno = 32 // ERROR_SHARING_VIOLATION
+	errorLockViolation    syscall.Errno = 33 // ERROR_LOCK_VIOLATION
+)
+
+// sharingViolation reports whether the error is caused by another process having the file open.
+func sharingViolation(err error) bool {
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == errorSharingViolation || errno == errorLockViolation)
+}
@@ -0,0 +1,161 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrDeadlock is returned when waiting for a Mutex would never end, because the holders of the awaited
+// locks wait (directly or transitively) for locks held by the waiting process, see WithDeadlockDetection.
+var ErrDeadlock = errors.New("deadlock detected")
+
+// waitsForDirectory is the directory under the root keeping "waits-for" edges of processes,
+// which wait for a Mutex while holding another one under the same root.
+const waitsForDirectory = ".waits-for"
+
+// maxDeadlockCycle limits length of followed chains of waiting processes.
+const maxDeadlockCycle = 64
+
+// WithDeadlockDetection makes a process waiting for the Mutex, while holding another mutex under the same root,
+// record a "waits-for" edge and check whether the chain of holders and waiters leads back to the process.
+// If it does, locking fails fast with an error wrapping ErrDeadlock and listing the cycle, instead of waiting
+// forever. All processes taking part in a potential cycle have to use the option.
+func WithDeadlockDetection() Option {
+	return func(m *Mutex) {
+		m.deadlockDetection = true
+	}
+}
+
+// heldMutexes tracks mutexes held by the process, by their root.
+var heldMutexes = struct {
+	sync.Mutex
+	roots map[string]map[*Mutex]bool
+}{roots: make(map[string]map[*Mutex]bool)}
+
+// registerHeld records the Mutex as held by the process.
+func registerHeld(m *Mutex) {
+	heldMutexes.Lock()
+	defer heldMutexes.Unlock()
+	held, ok := heldMutexes.roots[m.root]
+	if !ok {
+		held = make(map[*Mutex]bool)
+		heldMutexes.roots[m.root] = held
+	}
+	held[m] = true
+}
+
+// unregisterHeld records the Mutex as not held by the process anymore.
+func unregisterHeld(m *Mutex) {
+	heldMutexes.Lock()
+	defer heldMutexes.Unlock()
+	if held, ok := heldMutexes.roots[m.root]; ok {
+		delete(held, m)
+		if len(held) == 0 {
+			delete(heldMutexes.roots, m.root)
+		}
+	}
+}
+
+// holdsOther reports whether the process holds a mutex other than m under the root of m.
+func holdsOther(m *Mutex) bool {
+	if m.root == "" {
+		return false // Dot-locks have no root
+	}
+	heldMutexes.Lock()
+	defer heldMutexes.Unlock()
+	for other := range heldMutexes.roots[m.root] {
+		if other.id != m.id {
+			return true
+		}
+	}
+	return false
+}
+
+// waitsForPath returns the path of the "waits-for" edge of the acquisition of the trace by the process.
+// Each waiting acquisition has its own edge, so goroutines of a process waiting for different mutexes
+// do not overwrite edges of each other.
+func (m *Mutex) waitsForPath(h Holder, trace string) string {
+	return path.Join(m.root, waitsForDirectory, waitsForPrefix(h)+trace)
+}
+
+// waitsForPrefix returns the common prefix of names of "waits-for" edges of the process.
+func waitsForPrefix(h Holder) string {
+	return fmt.Sprintf("%s-%d.", strings.NewReplacer("/", "_", "\\", "_").Replace(h.Host), h.Pid)
+}
+
+// checkDeadlock refreshes the "waits-for" edge of the acquisition of the trace waiting for the Mutex and follows
+// the chains of holders of awaited locks and their edges. Edges not refreshed within three refresh periods are ignored.
+func (m *Mutex) checkDeadlock(trace string) error {
+	self := currentHolder()
+	edge := m.waitsForPath(self, trace)
+	if err := os.MkdirAll(path.Dir(edge), m.dirMode); err != nil {
+		return fmt.Errorf("cannot record waits-for edge of lock %s: %w", m.id, err)
+	}
+	if err := m.replaceFile(edge, []byte(m.id+"\n")); err != nil {
+		return fmt.Errorf("cannot record waits-for edge of lock %s: %w", m.id, err)
+	}
+	if cycle := m.waitsForCycle(self, m.id, nil, make(map[string]bool)); cycle != nil {
+		return fmt.Errorf("%w: %s", ErrDeadlock, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// waitsForCycle follows the holder of the lock id and locks awaited by the holder, depth first,
+// and returns the chain leading back to the process self, or nil if there is none.
+func (m *Mutex) waitsForCycle(self Holder, id string, chain []string, visited map[string]bool) []string {
+	if len(chain) >= maxDeadlockCycle || visited[id] {
+		return nil
+	}
+	visited[id] = true
+	md, _ := m.sibling(id).Metadata()
+	if md == nil {
+		return nil
+	}
+	chain = append(chain, fmt.Sprintf("%s (held by %s)", id, md.Holder))
+	if md.Holder.Host == self.Host && md.Holder.Pid == self.Pid {
+		if len(chain) == 1 {
+			return nil // Held by another goroutine of the process
+		}
+		return chain
+	}
+	for _, awaited := range m.awaitedBy(md.Holder) {
+		if cycle := m.waitsForCycle(self, awaited, chain, visited); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// awaitedBy returns ids of locks awaited by the process of the holder, according to its fresh "waits-for" edges.
+func (m *Mutex) awaitedBy(h Holder) []string {
+	dir := path.Join(m.root, waitsForDirectory)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	prefix := waitsForPrefix(h)
+	var result []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) || now()-nano2Millis(entry.ModTime().UnixNano()) > millis(3*m.refresh) {
+			continue
+		}
+		if b, err := ioutil.ReadFile(path.Join(dir, entry.Name())); err == nil {
+			result = append(result, strings.TrimSpace(string(b)))
+		}
+	}
+	return result
+}
+
+// sibling returns a Mutex of given id under the root of m, configured as m, for reading its lock.
+func (m *Mutex) sibling(id string) *Mutex {
+	result := newConfiguredMutex(nil)
+	result.id, result.key, result.root, result.directory = id, id, m.root, path.Join(m.root, m.idPath(id))
+	result.lockTemplate, result.candidateTemplate = m.lockTemplate, m.candidateTemplate
+	result.xattrs, result.secret, result.mtime = m.xattrs, m.secret, m.mtime
+	return result
+}
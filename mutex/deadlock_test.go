@@ -0,0 +1,104 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlockDetection(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	a, err := NewMutexExt(mutexRoot, "deadlock-a", 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout,
+		WithDeadlockDetection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewMutexExt(mutexRoot, "deadlock-b", 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout,
+		WithDeadlockDetection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer a.Unlock()
+	// Another process holds b and waits for a
+	other := Holder{Host: "other-host", Pid: 1}
+	md := b.newMetadata()
+	md.Holder = other
+	if _, err := b.writeMetadata(b.LockPath(), md); err != nil {
+		t.Fatal(err)
+	}
+	edge := a.waitsForPath(other, "trace")
+	if err := os.MkdirAll(path.Dir(edge), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(edge, []byte(a.Id()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = b.TryLock(time.Second)
+	if !errors.Is(err, ErrDeadlock) || !strings.Contains(err.Error(), "deadlock-b (held by other-host[1]") {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrDeadlock)
+	}
+	if edges := a.awaitedBy(currentHolder()); len(edges) != 0 {
+		t.Fatalf("waits-for edges not removed: %v", edges)
+	}
+	// Without the edge of the other process, the lock is just busy
+	if err := os.Remove(edge); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.TryLock(100 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrExpired)
+	}
+}
+
+func TestDeadlockEdges(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	newMutex := func(id string) *Mutex {
+		mx, err := NewMutexExt(mutexRoot, id, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout,
+			WithDeadlockDetection())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mx
+	}
+	a := newMutex("deadlock-a")
+	if err := a.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer a.Unlock()
+	// Another process holds b and c, waiting for nothing
+	other := Holder{Host: "other-host", Pid: 1}
+	for _, id := range []string{"deadlock-b", "deadlock-c"} {
+		mx := newMutex(id)
+		md := mx.newMetadata()
+		md.Holder = other
+		if _, err := mx.writeMetadata(mx.LockPath(), md); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Goroutines of the process wait for b and c at once
+	results := make(chan error, 2)
+	for _, id := range []string{"deadlock-b", "deadlock-c"} {
+		mx := newMutex(id)
+		go func() {
+			results <- mx.TryLock(300 * time.Millisecond)
+		}()
+	}
+	time.Sleep(150 * time.Millisecond)
+	edges := a.awaitedBy(currentHolder())
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != ErrExpired {
+			t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrExpired)
+		}
+	}
+	if len(edges) != 2 || edges[0] == edges[1] {
+		t.Fatalf("wrong waits-for edges %v of goroutines waiting for deadlock-b and deadlock-c", edges)
+	}
+	if edges := a.awaitedBy(currentHolder()); len(edges) != 0 {
+		t.Fatalf("waits-for edges not removed: %v", edges)
+	}
+}
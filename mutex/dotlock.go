@@ -0,0 +1,76 @@
+package mutex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDotLockTimeout determines how long a dot-lock file may stay untouched
+// before it is considered "dead", following the liblockfile convention.
+const DefaultDotLockTimeout = 5 * time.Minute
+
+// A dotLockSuffix is appended to the path of a locked resource to name its dot-lock file.
+const dotLockSuffix = ".lock"
+
+// A dotLockCandidateTemplate defines name template of dot-lock candidate files.
+const dotLockCandidateTemplate = ".%s.lk*"
+
+// NewDotLock creates a Mutex compatible with the classic dot-lock convention used by
+// procmail, mutt or liblockfile: the resource at targetPath is locked by creating the "targetPath.lock"
+// file containing PID of its holder. Such locks are refreshed by touching them and are considered
+// dead when they are untouched for DefaultDotLockTimeout, or when their holder process does not exist.
+func NewDotLock(targetPath string, opts ...Option) (*Mutex, error) {
+	return NewDotLockExt(targetPath, DefaultPulse, DefaultRefresh, DefaultDotLockTimeout, opts...)
+}
+
+// NewDotLockExt creates a dot-lock Mutex with explicit timings, see NewDotLock and NewMutexExt.
+func NewDotLockExt(targetPath string, pulse time.Duration, refresh time.Duration, deadTimeout time.Duration,
+	opts ...Option) (*Mutex, error) {
+	targetPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	if pulse <= 0 {
+		pulse = DefaultPulse
+	}
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	m := newConfiguredMutex(opts)
+	m.dotLock = true
+	m.mtime = true
+	m.hashedIds = false
+	m.key = targetPath
+	m.id = filepath.Base(targetPath)
+	m.directory = filepath.Dir(targetPath)
+	m.lockTemplate = m.id + dotLockSuffix
+	m.candidateTemplate = dotLockCandidateTemplate
+	m.deadAgeRecovery = deadTimeout
+	m.pulse = pulse
+	m.refresh = refresh
+	if _, err := ioutil.ReadDir(m.directory); err != nil {
+		return nil, fmt.Errorf("cannot access directory (%s): %w", m.directory, err)
+	}
+	return m, nil
+}
+
+// readDotLock returns metadata of a dot-lock file, which records just PID of its holder.
+func readDotLock(fileName string, modTime int64) *Metadata {
+	tm := millisToTime(modTime)
+	md := &Metadata{Version: LegacyVersion, Id: filepath.Base(fileName), Created: tm, Refreshed: tm}
+	if b, err := ioutil.ReadFile(fileName); err == nil {
+		md.Holder.Pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+	return md
+}
+
+// holderDead reports whether the dot-lock described by the metadata has been created by a process,
+// which does not exist anymore. Only dot-lock mutexes are checked this way, as their holders are assumed
+// to run on the local host.
+func (m *Mutex) holderDead(md *Metadata) bool {
+	return m.dotLock && md != nil && md.Holder.Pid > 0 && !processAlive(md.Holder.Pid)
+}
@@ -0,0 +1,57 @@
+package mutex
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDotLock(t *testing.T) {
+	target := filepath.Join(temporaryCatalog(t), "mailbox")
+	mx, err := NewDotLock(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := target + ".lock"; mx.LockPath() != want {
+		t.Fatalf("wrong value \"%s\" instead of \"%s\"", mx.LockPath(), want)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	b, err := os.ReadFile(mx.LockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(b)), strconv.Itoa(os.Getpid()); got != want {
+		t.Fatalf("wrong dot-lock contents \"%s\" instead of \"%s\"", got, want)
+	}
+	if md, err := mx.Metadata(); err != nil || md.Holder.Pid != os.Getpid() {
+		t.Fatalf("wrong metadata %+v (%v)", md, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(target), "*token*")); len(matches) > 0 {
+		t.Fatalf("unexpected files: %v", matches)
+	}
+}
+
+func TestDotLockDeadHolder(t *testing.T) {
+	target := filepath.Join(temporaryCatalog(t), "mailbox")
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	if err := os.WriteFile(target+".lock", []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mx, err := NewDotLockExt(target, 10*time.Millisecond, 0, DefaultDotLockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	mx.Unlock()
+}
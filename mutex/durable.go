@@ -0,0 +1,29 @@
+package mutex
+
+import "os"
+
+// syncFile flushes the file to stable storage, if the Mutex is configured for durable writes.
+func (m *Mutex) syncFile(fileName string) error {
+	if !m.durable {
+		return nil
+	}
+	return syncPath(fileName)
+}
+
+// syncDirectory flushes the Mutex directory (i.e. created links and removed files) to stable storage,
+// if the Mutex is configured for durable writes.
+func (m *Mutex) syncDirectory() error {
+	if !m.durable {
+		return nil
+	}
+	return syncPath(m.directory)
+}
+
+func syncPath(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,143 @@
+package mutex
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// An EventKind identifies kinds of events reported by a Mutex.
+type EventKind int
+
+const (
+	// EventStaleBroken is reported when a stale lock of another holder has been removed.
+	EventStaleBroken EventKind = iota + 1
+	// EventInvalidSignature is reported when a lock file with a missing or wrong signature has been found.
+	EventInvalidSignature
+	// EventClockSkew is reported when a lock timestamp is too far in the future, see ErrClockSkew.
+	EventClockSkew
+	// EventHeldTooLong is reported when the Mutex is held longer than configured, see WithMaxHoldWarning.
+	EventHeldTooLong
+	// EventAcquired is reported when the Mutex has been locked.
+	EventAcquired
+	// EventReleased is reported when the Mutex has been unlocked.
+	EventReleased
+	// EventAttempt is reported after each unsuccessful locking attempt, see WithAttemptEvents.
+	EventAttempt
+	// EventStaleCheck is reported when the lock of another holder has been checked for staleness,
+	// see WithAttemptEvents.
+	EventStaleCheck
+	// EventAutoReleased is reported when the Mutex has been released after the maximum hold time, see WithMaxHold.
+	EventAutoReleased
+	// EventReacquired is reported when the lost lock has been acquired again, see WithReacquireOnLoss.
+	EventReacquired
+	// EventFailover is reported when the Mutex has moved to another root, see WithFallbackRoots.
+	EventFailover
+	// EventMirrorFailed is reported when a lock could not be replicated to the mirror, see WithMirror.
+	EventMirrorFailed
+	// EventChallenged is reported to the holder when a waiter is going to break its lock as stale,
+	// see WithBreakGrace and KeepAlive.
+	EventChallenged
+	// EventWriterPending is reported when a writer starts waiting for a hierarchical lock held by others,
+	// see Manager.PendingWriters.
+	EventWriterPending
+	// EventStaleFound is reported when a stale lock of another holder has been found, but not broken,
+	// see WithNoRecovery.
+	EventStaleFound
+	// EventWebhookFailed is reported when an event could not be delivered to the webhook, see WithWebhook.
+	EventWebhookFailed
+)
+
+var eventNames = map[EventKind]string{
+	EventStaleBroken:      "stale-broken",
+	EventInvalidSignature: "invalid-signature",
+	EventClockSkew:        "clock-skew",
+	EventHeldTooLong:      "held-too-long",
+	EventAcquired:         "acquired",
+	EventReleased:         "released",
+	EventAttempt:          "attempt",
+	EventStaleCheck:       "stale-check",
+	EventAutoReleased:     "auto-released",
+	EventReacquired:       "reacquired",
+	EventFailover:         "failover",
+	EventMirrorFailed:     "mirror-failed",
+	EventChallenged:       "challenged",
+	EventWriterPending:    "writer-pending",
+	EventStaleFound:       "stale-found",
+	EventWebhookFailed:    "webhook-failed",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("event-%d", int(k))
+}
+
+// An Event describes something notable that happened to a Mutex.
+type Event struct {
+	Kind  EventKind
+	Id    string    // Mutex id
+	Time  time.Time // When the event happened
+	Path  string    // Related file, if any
+	Err   error     // Related error, if any
+	Trace string    // Identifier of the related acquisition, see Mutex.Trace
+	Info  string    // Human readable details, if any
+}
+
+func (e Event) String() string {
+	result := fmt.Sprintf("%s %s", e.Id, e.Kind)
+	if e.Trace != "" {
+		result += " [" + e.Trace + "]"
+	}
+	if e.Path != "" {
+		result += " " + e.Path
+	}
+	if e.Err != nil {
+		result += fmt.Sprintf(": %v", e.Err)
+	}
+	if e.Info != "" {
+		result += " - " + e.Info
+	}
+	return result
+}
+
+// MarshalJSON encodes the event as a JSON object with the kind and the error given as strings.
+func (e Event) MarshalJSON() ([]byte, error) {
+	result := struct {
+		Kind  string    `json:"kind"`
+		Id    string    `json:"id"`
+		Time  time.Time `json:"time"`
+		Path  string    `json:"path,omitempty"`
+		Error string    `json:"error,omitempty"`
+		Trace string    `json:"trace,omitempty"`
+		Info  string    `json:"info,omitempty"`
+	}{Kind: e.Kind.String(), Id: e.Id, Time: e.Time, Path: e.Path, Trace: e.Trace, Info: e.Info}
+	if e.Err != nil {
+		result.Error = e.Err.Error()
+	}
+	return json.Marshal(result)
+}
+
+// emit passes the event to the handler and the webhook of the Mutex, if any.
+func (m *Mutex) emit(e Event) {
+	if m.events == nil && m.webhook == nil && m.statsd == nil {
+		return
+	}
+	e.Id = m.id
+	if e.Trace == "" {
+		e.Trace = m.Trace()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if m.events != nil {
+		m.events(e)
+	}
+	if m.webhook != nil {
+		m.webhook.enqueue(e)
+	}
+	if m.statsd != nil {
+		m.statsd.Count("events", 1, "id:"+e.Id, "kind:"+e.Kind.String())
+	}
+}
@@ -0,0 +1,165 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// WithFallbackRoots sets roots to use, in order, when the root of the Mutex is not healthy, e.g. when
+// the primary NFS mount is briefly down. Each acquisition rechecks the roots and locks the Mutex
+// in the first healthy one, failing over to the next ones on I/O errors (reported as EventFailover).
+// The lock is granted only if none of the other roots, which are reachable, is locked by a live holder,
+// so holders, which have failed over, and holders returning to the recovered root exclude each other.
+// However, roots cannot be checked while unreachable: if hosts see different roots as unavailable
+// (e.g. a network partition), each may lock the Mutex in a different root at the same time.
+// Use fallback roots only where such a split brain is acceptable. Processes sharing the Mutex should use
+// the same roots. Ignored in the dot-lock mode.
+func WithFallbackRoots(roots ...string) Option {
+	return func(m *Mutex) {
+		m.fallbackRoots = append(m.fallbackRoots, roots...)
+	}
+}
+
+// HealthyRoot returns the first healthy one of the roots, with symbolic links resolved (see NewMutexExt).
+// A root is healthy, if it is an accessible directory or does not exist yet.
+func HealthyRoot(roots ...string) (string, error) {
+	var result error = fmt.Errorf("%w: no roots", ErrInvalidRoot)
+	for _, root := range roots {
+		root, err := resolveRoot(root)
+		if err != nil {
+			result = err
+			continue
+		}
+		if err := checkRoot(root); err != nil {
+			result = err
+			continue
+		}
+		return root, nil
+	}
+	return "", result
+}
+
+// checkRoot returns an error, if the root is not healthy, see HealthyRoot.
+func checkRoot(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidRoot, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrInvalidRoot, root)
+	}
+	return nil
+}
+
+// resolveRoots resolves the root and the fallback roots of the Mutex, if any, and switches the Mutex
+// to the first healthy one.
+func (m *Mutex) resolveRoots(root string) error {
+	if len(m.fallbackRoots) == 0 {
+		return nil
+	}
+	m.roots = []string{root}
+	for _, fallback := range m.fallbackRoots {
+		resolved, err := resolveRoot(fallback)
+		if err != nil {
+			return err
+		}
+		m.roots = append(m.roots, resolved)
+	}
+	for _, root := range m.roots {
+		if checkRoot(root) == nil {
+			return m.useRoot(root)
+		}
+	}
+	return nil
+}
+
+// useRoot moves the Mutex, which must not be held, to the root.
+func (m *Mutex) useRoot(root string) error {
+	rel, err := filepath.Rel(m.root, m.directory)
+	if err != nil {
+		return err
+	}
+	directory := path.Join(root, filepath.ToSlash(rel))
+	if err := checkContained(root, directory); err != nil {
+		return err
+	}
+	m.root, m.directory, m.uninitialized = root, directory, true
+	return nil
+}
+
+// lockRoots locks the Mutex in its root or, with fallback roots, in the first healthy one,
+// failing over to the next ones on I/O errors, see WithFallbackRoots. A lock is granted only if no other
+// reachable root is locked by a live holder, otherwise it is given up and locking is attempted again.
+func (m *Mutex) lockRoots(ctx context.Context, attempt *lockAttempt) error {
+	if len(m.roots) == 0 {
+		return m.lockRoot(ctx, attempt)
+	}
+	for {
+		var err error
+		tried := false
+		for _, root := range m.roots {
+			if checkRoot(root) != nil {
+				continue
+			}
+			tried = true
+			if root != m.root {
+				previous := m.root
+				if err := m.useRoot(root); err != nil {
+					return err
+				}
+				m.emit(Event{Kind: EventFailover, Path: root, Err: err, Info: fmt.Sprintf("from %s", previous)})
+			}
+			if err = m.lockRoot(ctx, attempt); err == nil || !isIOError(err) {
+				break
+			}
+		}
+		if !tried {
+			return fmt.Errorf("%w: no healthy root of mutex %s", ErrInvalidRoot, m.id)
+		}
+		if err != nil || !m.lockedElsewhere() {
+			return err
+		}
+		// Held in another root by a holder, which has failed over (or back) meanwhile
+		os.Remove(m.LockPath())
+		m.releaseFlock()
+		if attempt.once || sleepOrDone(ctx, m.pulse) {
+			return ErrExpired
+		}
+	}
+}
+
+// lockedElsewhere reports whether the Mutex is locked by a live holder in another of its roots, which is
+// reachable, e.g. by a holder, which has failed over while the root of the Mutex was unavailable.
+func (m *Mutex) lockedElsewhere() bool {
+	rel, err := filepath.Rel(m.root, m.directory)
+	if err != nil {
+		return false
+	}
+	for _, root := range m.roots {
+		if root == m.root || checkRoot(root) != nil {
+			continue
+		}
+		other := m.replica(root, filepath.ToSlash(rel))
+		other.deadAgeRecovery = m.deadAgeRecovery
+		if !other.When().IsZero() && !other.Stale() {
+			return true
+		}
+	}
+	return false
+}
+
+// isIOError reports whether the error has been caused by a failed filesystem operation.
+func isIOError(err error) bool {
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	return errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &syscallErr) ||
+		errors.Is(err, ErrReadOnlyRoot)
+}
@@ -0,0 +1,87 @@
+package mutex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFallbackRoots(t *testing.T) {
+	primary := temporaryCatalog(t)
+	fallback := temporaryCatalog(t)
+	var events []Event
+	onEvent := WithEventHandler(func(e Event) { events = append(events, e) })
+	// A file in place of the mutex directory makes the primary root fail
+	if err := ioutil.WriteFile(filepath.Join(primary, "jobs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mx, err := NewMutex(primary, "jobs/nightly", WithFallbackRoots(fallback), onEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if got, want := filepath.Dir(mx.LockPath()), filepath.Join(fallback, "jobs", "nightly"); got != want {
+		t.Fatalf("wrong lock directory %s instead of %s", got, want)
+	}
+	failover := false
+	for _, e := range events {
+		failover = failover || e.Kind == EventFailover
+	}
+	if !failover {
+		t.Fatalf("no %s event reported: %v", EventFailover, events)
+	}
+	other, err := NewMutex(primary, "jobs/nightly", WithFallbackRoots(fallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock(100 * time.Millisecond); err == nil {
+		other.Unlock()
+		t.Fatalf("TryLock succeeded, but should fail.")
+	}
+	if root, err := HealthyRoot(filepath.Join(primary, "jobs"), fallback); err != nil || root != fallback {
+		t.Fatalf("wrong value of HealthyRoot() => %s (%v) instead of %s", root, err, fallback)
+	}
+}
+
+func TestFallbackRootsRecovered(t *testing.T) {
+	primary := temporaryCatalog(t)
+	fallback := temporaryCatalog(t)
+	broken := filepath.Join(primary, "jobs")
+	if err := ioutil.WriteFile(broken, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mx, err := NewMutexExt(primary, "jobs/nightly", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithFallbackRoots(fallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	// The primary root recovers, while the lock is held in the fallback root
+	if err := os.Remove(broken); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewMutexExt(primary, "jobs/nightly", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithFallbackRoots(fallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TryLock(100 * time.Millisecond); err != ErrExpired {
+		other.Unlock()
+		t.Fatalf("wrong result of TryLock() %v instead of %v", err, ErrExpired)
+	}
+	mx.Unlock()
+	if err := other.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer other.Unlock()
+	if got, want := filepath.Dir(other.LockPath()), filepath.Join(primary, "jobs", "nightly"); got != want {
+		t.Fatalf("wrong lock directory %s instead of %s", got, want)
+	}
+}
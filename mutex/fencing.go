@@ -0,0 +1,85 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrStaleToken is returned when a fencing token is older than the token of the current lock of a Mutex.
+var ErrStaleToken = errors.New("stale fencing token")
+
+// FencingTokenHeader is the HTTP header carrying a fencing token checked by TokenValidator.
+const FencingTokenHeader = "X-Fencing-Token"
+
+// ValidateToken checks the fencing token presented by a client of a resource guarded by the Mutex with given id
+// under root, see Mutex.ValidateToken.
+func ValidateToken(root string, id string, token uint64, opts ...Option) error {
+	m, err := NewMutex(root, id, opts...)
+	if err != nil {
+		return err
+	}
+	return m.ValidateToken(token)
+}
+
+// ValidateToken checks the fencing token presented by a client of a resource guarded by the Mutex:
+// tokens older than the one issued by the last acquisition of the Mutex yield ErrStaleToken,
+// so the resource can reject requests of a holder, which has lost the lock meanwhile.
+func (m *Mutex) ValidateToken(token uint64) error {
+	current, err := m.currentToken()
+	if err != nil {
+		return err
+	}
+	if token < current {
+		return fmt.Errorf("%w %d of mutex %s, the current one is %d", ErrStaleToken, token, m.id, current)
+	}
+	return nil
+}
+
+// TokenValidator wraps the handler of a resource guarded by the Mutex, rejecting requests with a fencing token
+// (in FencingTokenHeader) older than the current one with 409 Conflict, and requests without a valid token
+// with 400 Bad Request.
+func TokenValidator(m *Mutex, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := strconv.ParseUint(r.Header.Get(FencingTokenHeader), 10, 64)
+		if err != nil {
+			http.Error(w, "missing or invalid "+FencingTokenHeader, http.StatusBadRequest)
+			return
+		}
+		if err := m.ValidateToken(token); errors.Is(err, ErrStaleToken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentToken returns the fencing token issued by the last acquisition of the Mutex, 0 if none.
+func (m *Mutex) currentToken() (uint64, error) {
+	fileName := m.tokenPath()
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	token, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupted token file %s: %w", fileName, err)
+	}
+	return token, nil
+}
+
+// tokenPath returns the path of the file keeping the last issued fencing token of the Mutex.
+func (m *Mutex) tokenPath() string {
+	return path.Join(m.directory, expandTemplate(tokenTemplate, m.name()))
+}
@@ -0,0 +1,47 @@
+package mutex
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestValidateToken(t *testing.T) {
+	const mutexId = "fencing-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	if err := ValidateToken(mutexRoot, mutexId, 0); err != nil {
+		t.Fatalf("token of a never locked mutex should be valid: %v", err)
+	}
+	mx := newTestMutex(mutexRoot, mutexId)
+	mx.Lock()
+	mx.Unlock()
+	mx.Lock()
+	defer mx.Unlock()
+	md, err := mx.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateToken(mutexRoot, mutexId, md.Token); err != nil {
+		t.Fatalf("current token should be valid: %v", err)
+	}
+	if err := ValidateToken(mutexRoot, mutexId, md.Token-1); !errors.Is(err, ErrStaleToken) {
+		t.Fatalf("wrong result %v instead of %v", err, ErrStaleToken)
+	}
+
+	handler := TokenValidator(mx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for token, status := range map[string]int{
+		"":                                 http.StatusBadRequest,
+		strconv.FormatUint(md.Token-1, 10): http.StatusConflict,
+		strconv.FormatUint(md.Token, 10):   http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/resource", nil)
+		r.Header.Set(FencingTokenHeader, token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Fatalf("wrong status %d instead of %d for token \"%s\"", w.Code, status, token)
+		}
+	}
+}
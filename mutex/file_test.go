@@ -0,0 +1,48 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithFile(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	counter := filepath.Join(temporaryCatalog(t), "counter.txt")
+	const workers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithFile(context.Background(), mutexRoot, counter, os.O_RDWR|os.O_CREATE, func(f *os.File) error {
+				b, err := io.ReadAll(f)
+				if err != nil {
+					return err
+				}
+				value, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+				if _, err := f.WriteAt([]byte(fmt.Sprintf("%d\n", value+1)), 0); err != nil {
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithFile failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	b, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != strconv.Itoa(workers) {
+		t.Fatalf("wrong value %s instead of %d", got, workers)
+	}
+}
@@ -0,0 +1,74 @@
+package mutex
+
+import (
+	"context"
+	"os"
+	"path"
+)
+
+// A flagTemplate defines name template of the marker file of a set Flag.
+const flagTemplate = "%s-flag.set"
+
+// A Flag is a boolean flag shared by processes (possibly on different hosts), like "maintenance mode on",
+// which is set, when its marker file exists. It is not named Event, which names events of mutexes. Besides Set and Clear, shell scripts can simply create
+// and remove the marker file (see Path).
+type Flag struct {
+	m *Mutex
+}
+
+// NewFlag creates a Flag with given id under root.
+func NewFlag(root string, id string, opts ...Option) (*Flag, error) {
+	m, err := NewMutex(root, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Flag{m: m}, nil
+}
+
+// Flag creates a Flag with given id, using the Manager's configuration.
+func (mgr *Manager) Flag(id string) (*Flag, error) {
+	m, err := mgr.Mutex(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Flag{m: m}, nil
+}
+
+// Path returns the path of the marker file of the Flag.
+func (f *Flag) Path() string {
+	return path.Join(f.m.directory, expandTemplate(flagTemplate, f.m.name()))
+}
+
+// Set sets the Flag.
+func (f *Flag) Set() error {
+	file, err := os.OpenFile(f.Path(), os.O_WRONLY|os.O_CREATE, f.m.fileMode)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return f.m.syncDirectory()
+}
+
+// Clear clears the Flag.
+func (f *Flag) Clear() error {
+	if err := os.Remove(f.Path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.m.syncDirectory()
+}
+
+// IsSet reports whether the Flag is set.
+func (f *Flag) IsSet() bool {
+	_, err := os.Stat(f.Path())
+	return err == nil
+}
+
+// Wait waits until the Flag is set or the context is done (ErrExpired). It wakes up as soon as the marker file
+// is created, where the file system notifies of changes, otherwise it checks the Flag every pulse.
+func (f *Flag) Wait(ctx context.Context) error {
+	return f.m.waitUntil(ctx, f.m.directory, func() (bool, error) {
+		return f.IsSet(), nil
+	})
+}
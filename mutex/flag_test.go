@@ -0,0 +1,83 @@
+package mutex
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFlag(t *testing.T) {
+	const flagId = "flag-test"
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter, err := mgr.Flag(flagId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setter, err := NewFlag(mutexRoot, flagId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waiter.IsSet() {
+		t.Fatal("new flag should not be set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := waiter.Wait(ctx); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- waiter.Wait(context.Background()) }()
+	if err := setter.Set(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flag not noticed")
+	}
+	if err := setter.Clear(); err != nil || waiter.IsSet() {
+		t.Fatalf("flag not cleared (%v)", err)
+	}
+	if err := setter.Clear(); err != nil {
+		t.Fatalf("clearing a clear flag failed: %v", err)
+	}
+}
+
+func TestFlagWatched(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("changes of files are notified on Linux only")
+	}
+	mutexRoot := temporaryCatalog(t)
+	// Checked every hour, unless notified
+	waiter, err := NewMutexExt(mutexRoot, "flag-watched-test", time.Hour, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flag := &Flag{m: waiter}
+	setter, err := NewFlag(mutexRoot, "flag-watched-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- flag.Wait(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := setter.Set(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("set flag not notified")
+	}
+}
@@ -0,0 +1,55 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ErrFlockUnsupported is returned when flock is not supported on given platform.
+var ErrFlockUnsupported = errors.New("flock is not supported")
+
+// FlockPath returns the path of the file locked with flock in the dual locking mode, see WithFlock.
+func (m *Mutex) FlockPath() string {
+	if m.flockPath != "" {
+		return m.flockPath
+	}
+	return path.Join(m.directory, expandTemplate(flockTemplate, m.name()))
+}
+
+// acquireFlock waits for the flock of the Mutex, if it is configured to use one.
+// If once is true, it is not waited for.
+func (m *Mutex) acquireFlock(ctx context.Context, once bool) error {
+	if !m.flock {
+		return nil
+	}
+	f, err := os.OpenFile(m.FlockPath(), os.O_RDWR|os.O_CREATE, m.fileMode)
+	if err != nil {
+		return fmt.Errorf("cannot open flock file of mutex %s: %w", m.id, err)
+	}
+	for {
+		locked, err := tryFlock(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("cannot flock mutex %s: %w", m.id, err)
+		}
+		if locked {
+			m.flockFile = f
+			return nil
+		}
+		if once || sleepOrDone(ctx, m.pulse) {
+			f.Close()
+			return ErrExpired
+		}
+	}
+}
+
+// releaseFlock releases the flock held by the Mutex, if any.
+func (m *Mutex) releaseFlock() {
+	if m.flockFile != nil {
+		m.flockFile.Close() // closing the descriptor releases the flock
+		m.flockFile = nil
+	}
+}
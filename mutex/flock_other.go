@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package mutex
+
+import "os"
+
+// tryFlock tries to take an exclusive flock on the file without blocking.
+func tryFlock(f *os.File) (bool, error) {
+	return false, ErrFlockUnsupported
+}
@@ -0,0 +1,42 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlock(t *testing.T) {
+	const mutexId = "flock-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	flockPath := filepath.Join(mutexRoot, "legacy.lock")
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 0, DefaultDeadTimeout, WithFlock(flockPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := os.OpenFile(flockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+
+	mx.Lock()
+	if locked, err := tryFlock(legacy); err != nil {
+		t.Skipf("flock not available: %v", err)
+	} else if locked {
+		t.Fatal("flock should be held by the mutex")
+	}
+	mx.Unlock()
+	if locked, err := tryFlock(legacy); err != nil || !locked {
+		t.Fatalf("flock should be released by the mutex (%v)", err)
+	}
+
+	if err := mx.TryLock(100 * time.Millisecond); !errors.Is(err, ErrExpired) {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrExpired)
+	}
+	if _, err := os.Stat(mx.LockPath()); err == nil {
+		t.Fatal("lock file should not be created while a legacy flock is held")
+	}
+}
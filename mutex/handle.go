@@ -0,0 +1,105 @@
+package mutex
+
+import (
+	"context"
+	"sync"
+)
+
+// A Handle represents a single acquisition of a Mutex, see Acquire. The lock is kept alive until
+// the Handle is released; Done is closed once it is released or lost, so goroutines doing the guarded
+// work can stop in time.
+type Handle struct {
+	m      *Mutex
+	md     *Metadata
+	done   chan struct{}
+	cancel context.CancelFunc
+	closed sync.Once
+	freed  sync.Once
+	mx     sync.Mutex
+	err    error
+}
+
+// Acquire locks the Mutex, waiting until the context is done (ErrExpired), and returns a Handle
+// of the acquisition. The lock is refreshed in the background (see KeepAlive) until Handle.Release.
+func (m *Mutex) Acquire(ctx context.Context) (*Handle, error) {
+	if err := m.LockWithContext(ctx); err != nil {
+		return nil, err
+	}
+	return m.newHandle(), nil
+}
+
+// newHandle returns a Handle of the acquisition of the just locked Mutex, keeping its lock alive.
+func (m *Mutex) newHandle() *Handle {
+	md, _ := m.Metadata()
+	keepCtx, cancel := context.WithCancel(context.Background())
+	h := &Handle{m: m, md: md, done: make(chan struct{}), cancel: cancel}
+	lost := m.KeepAlive(keepCtx)
+	go func() {
+		select {
+		case err := <-lost:
+			h.finish(err)
+		case <-keepCtx.Done():
+		}
+	}()
+	return h
+}
+
+// Mutex returns the acquired Mutex.
+func (h *Handle) Mutex() *Mutex {
+	return h.m
+}
+
+// Token returns the fencing token of the acquisition.
+func (h *Handle) Token() uint64 {
+	if h.md == nil {
+		return 0
+	}
+	return h.md.Token
+}
+
+// Metadata returns metadata of the lock, as of its acquisition.
+func (h *Handle) Metadata() *Metadata {
+	return h.md
+}
+
+// Done returns a channel closed once the lock has been released or lost.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns nil until Done is closed, then the reason the lock has been lost (e.g. ErrLockLost),
+// or nil if it has been released.
+func (h *Handle) Err() error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.err
+}
+
+// Release stops refreshing the lock and unlocks the Mutex. Only the first call has any effect.
+// A lost lock is not removed, as it may belong to another holder meanwhile; only resources of the Mutex
+// are freed and the reason of the loss is returned.
+func (h *Handle) Release() error {
+	var err error
+	h.freed.Do(func() {
+		h.cancel()
+		select {
+		case <-h.done:
+			h.m.forgetHeld()
+			err = h.Err()
+		default:
+			err = h.m.TryUnlock()
+			h.finish(nil)
+		}
+	})
+	return err
+}
+
+// finish closes Done, recording the reason the lock has been lost, if any.
+func (h *Handle) finish(err error) {
+	h.closed.Do(func() {
+		h.mx.Lock()
+		h.err = err
+		h.mx.Unlock()
+		close(h.done)
+	})
+}
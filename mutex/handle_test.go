@@ -0,0 +1,114 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandle(t *testing.T) {
+	const mutexId = "handle-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := mx.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Token() != 1 || h.Metadata() == nil || h.Mutex() != mx {
+		t.Fatalf("wrong handle: token %d, metadata %+v", h.Token(), h.Metadata())
+	}
+	if err := h.Release(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Done():
+	default:
+		t.Fatal("done channel not closed after release")
+	}
+	if h.Err() != nil || !mx.When().IsZero() {
+		t.Fatalf("wrong state after release: %v, locked %v", h.Err(), mx.When())
+	}
+
+	if h, err = mx.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Not in the middle of a refresh, which might replace the lock file
+	mx.releaseMx.Lock()
+	err = os.Remove(mx.LockPath())
+	mx.releaseMx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lost lock not reported")
+	}
+	if !errors.Is(h.Err(), ErrLockLost) {
+		t.Fatalf("wrong error %v instead of %v", h.Err(), ErrLockLost)
+	}
+	if err := h.Release(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("wrong result of Release() %v instead of %v", err, ErrLockLost)
+	}
+}
+
+// TestSharedHandle checks goroutines sharing a Mutex acquire it one at a time, run with -race.
+func TestSharedHandle(t *testing.T) {
+	const mutexId = "shared-handle-test-mutex"
+	const goroutines = 20
+	const rounds = 5
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, mutexId, time.Millisecond, 5*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	counter := 0
+	tokens := make(map[uint64]bool)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(handles bool) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				if !handles {
+					if err := mx.TryLock(10 * time.Second); err != nil {
+						t.Errorf("TryLock failed (%v), but should succeed.", err)
+						return
+					}
+					counter++
+					_, token := mx.acquisition()
+					tokens[token] = true
+					if err := mx.TryUnlock(); err != nil {
+						t.Errorf("TryUnlock failed (%v), but should succeed.", err)
+						return
+					}
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				h, err := mx.Acquire(ctx)
+				cancel()
+				if err != nil {
+					t.Errorf("Acquire failed (%v), but should succeed.", err)
+					return
+				}
+				counter++
+				tokens[h.Token()] = true
+				time.Sleep(2 * time.Millisecond) // Let KeepAlive refresh the lock
+				if err := h.Release(); err != nil {
+					t.Errorf("Release failed (%v), but should succeed.", err)
+					return
+				}
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	if want := goroutines * rounds; counter != want || len(tokens) != want {
+		t.Fatalf("wrong number of acquisitions %d (%d tokens) instead of %d", counter, len(tokens), want)
+	}
+}
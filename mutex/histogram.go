@@ -0,0 +1,106 @@
+package mutex
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// waitBuckets are upper bounds of buckets of a Histogram.
+var waitBuckets = [...]time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+}
+
+// A Histogram counts durations in buckets of fixed bounds (1ms to 1h), so its size does not grow
+// with the number of observations.
+type Histogram struct {
+	Counts [len(waitBuckets) + 1]uint64 // Counts of durations per bucket, the last one above all bounds
+	Count  uint64                       // Number of observed durations
+	Sum    time.Duration                // Sum of observed durations
+	Max    time.Duration                // Longest observed duration
+}
+
+// HistogramBounds returns upper bounds of buckets of a Histogram, except the last one, which is unbounded.
+func HistogramBounds() []time.Duration {
+	return append([]time.Duration{}, waitBuckets[:]...)
+}
+
+// observe counts the duration.
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(waitBuckets), func(i int) bool { return d <= waitBuckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Percentile returns an upper estimate of the q-quantile (0 < q <= 1, e.g. 0.99) of observed durations:
+// the upper bound of the bucket it falls into, but not more than the longest observed duration.
+// Returns 0, if there are no observations.
+func (h Histogram) Percentile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, count := range h.Counts[:len(waitBuckets)] {
+		if seen += count; seen >= rank {
+			if waitBuckets[i] < h.Max {
+				return waitBuckets[i]
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+// WriteMetrics writes statistics of mutexes created by the Manager in the Prometheus text format,
+// including histograms of their acquisition wait times, so applications can serve them with their metrics.
+func (mgr *Manager) WriteMetrics(w io.Writer) error {
+	stats := mgr.Stats()
+	ids := make([]string, 0, len(stats))
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var b strings.Builder
+	b.WriteString("# HELP fmutex_acquisitions_total Successful acquisitions of the mutex.\n")
+	b.WriteString("# TYPE fmutex_acquisitions_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "fmutex_acquisitions_total{id=\"%s\"} %d\n", escapeLabel(id), stats[id].Acquisitions)
+	}
+	b.WriteString("# HELP fmutex_stale_found_total Stale locks of other holders found, but not broken.\n")
+	b.WriteString("# TYPE fmutex_stale_found_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "fmutex_stale_found_total{id=\"%s\"} %d\n", escapeLabel(id), stats[id].StaleFound)
+	}
+	b.WriteString("# HELP fmutex_wait_seconds Time waited for successful acquisitions of the mutex.\n")
+	b.WriteString("# TYPE fmutex_wait_seconds histogram\n")
+	for _, id := range ids {
+		h, label := stats[id].WaitTimes, escapeLabel(id)
+		var cumulative uint64
+		for i, bound := range waitBuckets {
+			cumulative += h.Counts[i]
+			fmt.Fprintf(&b, "fmutex_wait_seconds_bucket{id=\"%s\",le=\"%g\"} %d\n", label, bound.Seconds(), cumulative)
+		}
+		fmt.Fprintf(&b, "fmutex_wait_seconds_bucket{id=\"%s\",le=\"+Inf\"} %d\n", label, h.Count)
+		fmt.Fprintf(&b, "fmutex_wait_seconds_sum{id=\"%s\"} %g\n", label, h.Sum.Seconds())
+		fmt.Fprintf(&b, "fmutex_wait_seconds_count{id=\"%s\"} %d\n", label, h.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeLabel escapes a label value of the Prometheus text format.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,126 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// States of a mutex reported by Info.
+const (
+	StateUnlocked = "unlocked"
+	StateLocked   = "locked"
+	StateStale    = "stale" // Locked, but not refreshed for longer than its lease, see Mutex.Stale
+)
+
+// An Info describes the state of a mutex, see List.
+type Info struct {
+	Id      string
+	State   string            // StateUnlocked, StateLocked or StateStale
+	Holder  Holder            // Holder of the lock, if locked
+	Owner   string            // Owner of the lock, if locked and set, see WithOwner
+	Message string            // Why the lock is held, if locked and set, see WithMessage
+	Labels  map[string]string // Labels of the lock, if locked, see WithLabels
+	Age     time.Duration     // How long the mutex has been locked
+	Waiters int
+}
+
+// List returns states of mutexes under root with ids matching the pattern, sorted by id. The pattern is
+// either a pattern of Manager.List, or a glob (see path.Match) like "tenantA/*/nightly".
+// The options should be the same the mutexes are used with.
+func List(root string, pattern string, opts ...Option) ([]Info, error) {
+	mgr, err := NewManager(root, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.Infos(pattern)
+}
+
+// ListFunc calls fn for states of mutexes under root with ids matching the pattern (see List) as they are
+// found, in the order of the directory walk, see Manager.WalkInfos.
+func ListFunc(ctx context.Context, root string, pattern string, fn func(info Info) error, opts ...Option) error {
+	mgr, err := NewManager(root, opts...)
+	if err != nil {
+		return err
+	}
+	return mgr.WalkInfos(ctx, pattern, fn)
+}
+
+// Infos returns states of mutexes of the Manager with ids matching the pattern, see List.
+func (mgr *Manager) Infos(pattern string) ([]Info, error) {
+	var result []Info
+	err := mgr.WalkInfos(context.Background(), pattern, func(info Info) error {
+		result = append(result, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result, nil
+}
+
+// WalkInfos calls fn for states of mutexes of the Manager with ids matching the pattern (see List)
+// as they are found, like Walk does for ids.
+func (mgr *Manager) WalkInfos(ctx context.Context, pattern string, fn func(info Info) error) error {
+	pattern = strings.Trim(pattern, namespaceSeparator)
+	glob := strings.ContainsAny(pattern, "*?[")
+	listed := pattern
+	if glob {
+		listed = AllIds
+	}
+	return mgr.Walk(ctx, listed, func(id string) error {
+		if glob {
+			if matched, err := path.Match(pattern, id); err != nil {
+				return err
+			} else if !matched {
+				return nil
+			}
+		}
+		m, err := mgr.peek(id)
+		if err != nil {
+			return err
+		}
+		info, err := m.info(id)
+		if err != nil {
+			return err
+		}
+		return fn(info)
+	})
+}
+
+// Peek returns the state of the mutex of given id under root, without creating any directory or file,
+// so it works on read-only mounts as well. The options should be the same the mutex is used with.
+func Peek(root string, id string, opts ...Option) (Info, error) {
+	m, err := NewMutex(root, id, append(opts, WithLazyInit())...)
+	if err != nil {
+		return Info{}, err
+	}
+	return m.info(strings.Trim(id, namespaceSeparator))
+}
+
+// Info returns the state of the Mutex, reported with its id (see Id).
+func (m *Mutex) Info() (Info, error) {
+	return m.info(m.id)
+}
+
+// info returns the state of the Mutex, reported with given id.
+func (m *Mutex) info(id string) (Info, error) {
+	result := Info{Id: id, State: StateUnlocked}
+	if md, err := m.Metadata(); md != nil && (err == nil || errors.Is(err, ErrInvalidSignature)) {
+		result.State = StateLocked
+		if m.Stale() {
+			result.State = StateStale
+		}
+		result.Holder, result.Owner, result.Message, result.Labels = md.Holder, md.Owner, md.Message, md.Labels
+		result.Age = time.Since(md.Created)
+	}
+	var err error
+	if result.Waiters, err = m.Waiters(); err != nil {
+		return Info{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package mutex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	for _, id := range []string{"tenantA/jobs/nightly", "tenantA/jobs/hourly", "tenantB/jobs/nightly"} {
+		mx, err := NewMutex(mutexRoot, id, WithOwner("owner-"+id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mx.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		defer mx.Unlock()
+	}
+	infos, err := List(mutexRoot, "*/jobs/nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Id != "tenantA/jobs/nightly" || infos[1].Id != "tenantB/jobs/nightly" {
+		t.Fatalf("wrong infos: %+v", infos)
+	}
+	info := infos[0]
+	if info.State != StateLocked || info.Owner != "owner-tenantA/jobs/nightly" || info.Holder != currentHolder() ||
+		info.Age <= 0 || info.Waiters != 0 {
+		t.Fatalf("wrong info: %+v", info)
+	}
+	if infos, err := List(mutexRoot, "tenantA/..."); err != nil || len(infos) != 2 {
+		t.Fatalf("wrong infos: %+v (%v)", infos, err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	const mutexId = "jobs/peek-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	info, err := Peek(mutexRoot, mutexId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Id != mutexId || info.State != StateUnlocked {
+		t.Fatalf("wrong info: %+v", info)
+	}
+	if _, err := os.Stat(filepath.Join(mutexRoot, "jobs")); !os.IsNotExist(err) {
+		t.Fatalf("Peek created directories (%v), but should not.", err)
+	}
+	mx, err := NewMutex(mutexRoot, mutexId, WithLazyInit(), WithOwner("peek"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if info, err := Peek(mutexRoot, mutexId); err != nil || info.State != StateLocked || info.Owner != "peek" {
+		t.Fatalf("wrong info: %+v (%v)", info, err)
+	}
+}
@@ -0,0 +1,498 @@
+package mutex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A LockMode is a mode of a hierarchical lock, see Manager.LockHierarchical.
+type LockMode int
+
+const (
+	// IntentShared (IS) announces shared locks on descendants of the locked id.
+	IntentShared LockMode = iota
+	// IntentExclusive (IX) announces exclusive locks on descendants of the locked id.
+	IntentExclusive
+	// Shared (S) locks the id together with all its descendants for reading.
+	Shared
+	// Exclusive (X) locks the id together with all its descendants for writing.
+	Exclusive
+)
+
+var lockModeNames = map[LockMode]string{
+	IntentShared:    "IS",
+	IntentExclusive: "IX",
+	Shared:          "S",
+	Exclusive:       "X",
+}
+
+func (mode LockMode) String() string {
+	if name, ok := lockModeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("LockMode(%d)", int(mode))
+}
+
+// lockModeCompatibility tells whether two modes may be held on the same id at once.
+var lockModeCompatibility = map[LockMode]map[LockMode]bool{
+	IntentShared:    {IntentShared: true, IntentExclusive: true, Shared: true},
+	IntentExclusive: {IntentShared: true, IntentExclusive: true},
+	Shared:          {IntentShared: true, Shared: true},
+	Exclusive:       {},
+}
+
+// An intentionTemplate defines name template of files recording holders of hierarchical locks;
+// the placeholders are replaced by the last component of the id and by the lock mode.
+const intentionTemplate = "%s-%s-*.hold"
+
+// A pendingTemplate defines name template of files announcing writers waiting for hierarchical locks;
+// the placeholders are replaced by the last component of the id and by the awaited lock mode.
+const pendingTemplate = "%s-%s-*.pending"
+
+// An intentionGuardTemplate defines name template of the lock file guarding changes of hierarchical locks.
+const intentionGuardTemplate = "%s-intention.guard"
+
+// An intentionCandidateTemplate defines name template of candidate files of the guard.
+const intentionCandidateTemplate = "%s-intention-candidate-*.tmp"
+
+// WithWriterPreference makes hierarchical locks prefer writers: while a writer (Exclusive or IntentExclusive)
+// waits for an id, new shared locks of the id conflicting with the awaited mode are not granted, so a steady
+// stream of readers cannot starve writers. Locks held already are not affected.
+// Writers waiting for an id are announced regardless of the preference, see Manager.PendingWriters.
+func WithWriterPreference() Option {
+	return func(m *Mutex) {
+		m.writerPreference = true
+	}
+}
+
+// A HierarchicalLock is held on an id and all its ancestors, see Manager.LockHierarchical.
+type HierarchicalLock struct {
+	mgr     *Manager
+	mode    LockMode
+	ids     []string
+	holds   []string
+	holdsMx sync.Mutex // Guards holds refreshed by keepAlive
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// LockHierarchical locks the id in given mode, waiting until the lock is compatible
+// with locks held by others or the context is done (ErrExpired).
+// Before that, all ancestors of the id are locked in the matching intention mode:
+// IntentShared for Shared and IntentShared, IntentExclusive for Exclusive and IntentExclusive.
+// For example, an Exclusive lock of "tenantA" ("freeze all of tenantA") conflicts with
+// an Exclusive lock of "tenantA/jobs/nightly", which holds "tenantA" in IntentExclusive mode.
+//
+// Hierarchical locks are independent of plain mutexes of the same ids. Files recording the holders
+// are refreshed every refresh period of the Manager until Unlock; holders, which have not refreshed them
+// for the dead timeout (at least two refresh periods), or found dead on the local host are discarded.
+func (mgr *Manager) LockHierarchical(ctx context.Context, id string, mode LockMode) (*HierarchicalLock, error) {
+	if _, ok := lockModeNames[mode]; !ok {
+		return nil, fmt.Errorf("invalid lock mode %v", mode)
+	}
+	parts := strings.Split(strings.Trim(id, namespaceSeparator), namespaceSeparator)
+	lock := &HierarchicalLock{mgr: mgr, mode: mode, stop: make(chan struct{}), stopped: make(chan struct{})}
+	go lock.keepAlive()
+	for i := range parts {
+		nodeId := strings.Join(parts[:i+1], namespaceSeparator)
+		hold, err := mgr.lockNode(ctx, nodeId, nodeMode(i, len(parts), mode))
+		if err != nil {
+			lock.Unlock()
+			return nil, err
+		}
+		lock.ids = append(lock.ids, nodeId)
+		lock.holdsMx.Lock()
+		lock.holds = append(lock.holds, hold)
+		lock.holdsMx.Unlock()
+	}
+	return lock, nil
+}
+
+// keepAlive refreshes modification times of files recording the lock every refresh period,
+// until the lock is released.
+func (lock *HierarchicalLock) keepAlive() {
+	defer close(lock.stopped)
+	ticker := time.NewTicker(lock.mgr.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+		}
+		lock.holdsMx.Lock()
+		for _, hold := range lock.holds {
+			touchHold(hold)
+		}
+		lock.holdsMx.Unlock()
+	}
+}
+
+// touchHold refreshes the modification time of the file recording a hierarchical lock (or a pending writer).
+func touchHold(hold string) error {
+	now := time.Now()
+	return os.Chtimes(hold, now, now)
+}
+
+// Unlock releases the lock of the id and all its ancestors.
+func (lock *HierarchicalLock) Unlock() error {
+	lock.once.Do(func() {
+		close(lock.stop)
+		<-lock.stopped
+	})
+	var result error
+	for i := len(lock.holds) - 1; i >= 0; i-- {
+		if err := removeFile(lock.holds[i]); err != nil && !os.IsNotExist(err) && result == nil {
+			result = err
+		}
+	}
+	lock.holds = nil
+	return result
+}
+
+// Mode returns the mode, in which the id is locked.
+func (lock *HierarchicalLock) Mode() LockMode {
+	return lock.mode
+}
+
+// WritersPending returns writers waiting for the locked id, see Manager.PendingWriters, so holders of
+// shared locks can finish their work early.
+func (lock *HierarchicalLock) WritersPending() ([]HolderInfo, error) {
+	if len(lock.ids) == 0 {
+		return nil, nil
+	}
+	return lock.mgr.PendingWriters(lock.ids[len(lock.ids)-1])
+}
+
+// Upgrade converts a Shared lock to Exclusive (or IntentShared to IntentExclusive) without releasing it,
+// waiting until other holders of the id and its ancestors allow that or the context is done (ErrExpired).
+// Two holders upgrading the same id at once wait for each other until their contexts are done.
+// In case of failure the id is still locked in its original mode (its ancestors may stay upgraded).
+func (lock *HierarchicalLock) Upgrade(ctx context.Context) error {
+	mode, ok := map[LockMode]LockMode{IntentShared: IntentExclusive, Shared: Exclusive}[lock.mode]
+	if !ok {
+		return fmt.Errorf("cannot upgrade %v lock", lock.mode)
+	}
+	for i := range lock.holds {
+		if err := lock.convert(ctx, i, nodeMode(i, len(lock.ids), mode)); err != nil {
+			return err
+		}
+	}
+	lock.mode = mode
+	return nil
+}
+
+// Downgrade converts an Exclusive lock to Shared (or IntentExclusive to IntentShared) without releasing it.
+func (lock *HierarchicalLock) Downgrade() error {
+	mode, ok := map[LockMode]LockMode{IntentExclusive: IntentShared, Exclusive: Shared}[lock.mode]
+	if !ok {
+		return fmt.Errorf("cannot downgrade %v lock", lock.mode)
+	}
+	for i := len(lock.holds) - 1; i >= 0; i-- {
+		if err := lock.convert(context.Background(), i, nodeMode(i, len(lock.ids), mode)); err != nil {
+			return err
+		}
+	}
+	lock.mode = mode
+	return nil
+}
+
+// nodeMode returns the mode of i-th id of a lock path of n ids (the ancestors first) for given mode of the lock.
+func nodeMode(i int, n int, mode LockMode) LockMode {
+	if i == n-1 {
+		return mode
+	}
+	if mode == IntentExclusive || mode == Exclusive {
+		return IntentExclusive
+	}
+	return IntentShared
+}
+
+// convert changes the mode of i-th id of the lock path.
+func (lock *HierarchicalLock) convert(ctx context.Context, i int, mode LockMode) error {
+	return lock.mgr.guarded(ctx, lock.ids[i], func(guard *Mutex) (bool, error) {
+		lock.holdsMx.Lock()
+		defer lock.holdsMx.Unlock()
+		hold, err := guard.convertHold(lock.holds[i], mode)
+		if hold != "" {
+			lock.holds[i] = hold
+		}
+		return hold != "", err
+	})
+}
+
+// lockNode locks a single id in given mode and returns the path of the file recording the lock.
+// Writers announce themselves while waiting, see Manager.PendingWriters.
+func (mgr *Manager) lockNode(ctx context.Context, id string, mode LockMode) (string, error) {
+	var hold, pending string
+	err := mgr.guarded(ctx, id, func(guard *Mutex) (bool, error) {
+		if pending != "" {
+			touchHold(pending)
+		}
+		var err error
+		hold, err = guard.tryHold(mode)
+		if hold == "" && err == nil && pending == "" && !isReader(mode) {
+			pending, err = guard.announceWriter(mode)
+		}
+		return hold != "", err
+	})
+	if pending != "" {
+		removeIfPossible(pending)
+	}
+	return hold, err
+}
+
+// isReader reports whether the mode is a shared one.
+func isReader(mode LockMode) bool {
+	return mode == Shared || mode == IntentShared
+}
+
+// guarded calls fn with the guard of hierarchical locks of the id locked, until fn reports success,
+// fails, or the context is done (ErrExpired).
+func (mgr *Manager) guarded(ctx context.Context, id string, fn func(guard *Mutex) (bool, error)) error {
+	guard, err := mgr.intentionGuard(id)
+	if err != nil {
+		return err
+	}
+	for {
+		if err := guard.LockWithContext(ctx); err != nil {
+			return err
+		}
+		done, err := fn(guard)
+		if unlockErr := guard.TryUnlock(); err == nil {
+			err = unlockErr
+		}
+		if err != nil || done {
+			return err
+		}
+		if sleepOrDone(ctx, mgr.pulse) {
+			return ErrExpired
+		}
+	}
+}
+
+// intentionGuard returns the Mutex guarding changes of hierarchical locks of the id.
+func (mgr *Manager) intentionGuard(id string) (*Mutex, error) {
+	opts := append(append([]Option{}, mgr.opts...),
+		WithLockFileName(intentionGuardTemplate), WithCandidatePattern(intentionCandidateTemplate))
+	return NewMutexExt(mgr.root, id, mgr.pulse, mgr.refresh, mgr.deadTimeout, opts...)
+}
+
+// A HolderInfo describes a holder of a hierarchical lock.
+type HolderInfo struct {
+	Mode   LockMode
+	Holder Holder
+	Since  time.Time
+}
+
+// Readers returns holders of shared (Shared and IntentShared) hierarchical locks of the id,
+// the longest holding first.
+func (mgr *Manager) Readers(id string) ([]HolderInfo, error) {
+	return mgr.holders(id, "-*.hold", isReader)
+}
+
+// PendingWriters returns writers waiting for hierarchical locks of the id, the longest waiting first.
+// Mode of each HolderInfo is the awaited mode and Since is the time the writer has started waiting.
+func (mgr *Manager) PendingWriters(id string) ([]HolderInfo, error) {
+	return mgr.holders(id, "-*.pending", func(LockMode) bool { return true })
+}
+
+// holders returns holders recorded in files of the id matching the pattern, with modes accepted by the filter.
+// Holders, which are gone, are skipped, see holdGone.
+func (mgr *Manager) holders(id string, pattern string, filter func(mode LockMode) bool) ([]HolderInfo, error) {
+	guard, err := mgr.intentionGuard(id)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := filepath.Glob(filepath.Join(guard.directory, guard.name()+pattern))
+	if err != nil {
+		return nil, err
+	}
+	var result []HolderInfo
+	for _, hold := range holds {
+		info := HolderInfo{}
+		if info.Mode, _ = guard.parseHold(hold); !filter(info.Mode) || guard.holdGone(hold) {
+			continue
+		}
+		stat, err := os.Stat(hold)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // released meanwhile
+			}
+			return nil, err
+		}
+		info.Since = stat.ModTime()
+		if b, err := ioutil.ReadFile(hold); err == nil {
+			json.Unmarshal(b, &info.Holder)
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Since.Before(result[j].Since) })
+	return result, nil
+}
+
+// compatible reports whether a lock in given mode is compatible with locks held by others,
+// i.e. all except the own one. Must be called with the guard locked.
+func (m *Mutex) compatible(mode LockMode, own string) (bool, error) {
+	holds, err := filepath.Glob(filepath.Join(m.directory, m.name()+"-*.hold"))
+	if err != nil {
+		return false, err
+	}
+	for _, hold := range holds {
+		if hold == own {
+			continue
+		}
+		if held, _ := m.parseHold(hold); lockModeCompatibility[mode][held] {
+			continue
+		}
+		if m.holdGone(hold) {
+			removeIfPossible(hold)
+			continue
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// writersPending reports whether writers waiting for the id conflict with a shared lock in given mode,
+// see WithWriterPreference. Must be called with the guard locked.
+func (m *Mutex) writersPending(mode LockMode) (bool, error) {
+	pending, err := filepath.Glob(filepath.Join(m.directory, m.name()+"-*.pending"))
+	if err != nil {
+		return false, err
+	}
+	for _, writer := range pending {
+		if awaited, _ := m.parseHold(writer); lockModeCompatibility[mode][awaited] {
+			continue
+		}
+		if m.holdGone(writer) {
+			removeIfPossible(writer)
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// tryHold records a lock in given mode, if compatible with locks held by others (and with pending writers,
+// see WithWriterPreference). Returns an empty path if the lock is not compatible.
+// Must be called with the guard locked.
+func (m *Mutex) tryHold(mode LockMode) (string, error) {
+	if ok, err := m.compatible(mode, ""); !ok || err != nil {
+		return "", err
+	}
+	if m.writerPreference && isReader(mode) {
+		if pending, err := m.writersPending(mode); pending || err != nil {
+			return "", err
+		}
+	}
+	hold, err := m.createHolderFile(intentionTemplate, mode)
+	if err != nil {
+		return "", fmt.Errorf("cannot create hierarchical lock %s: %w", m.id, err)
+	}
+	return hold, nil
+}
+
+// announceWriter records the current process as a writer waiting for a lock in given mode
+// and reports EventWriterPending. Returns the path of the announcement. Must be called with the guard locked.
+func (m *Mutex) announceWriter(mode LockMode) (string, error) {
+	pending, err := m.createHolderFile(pendingTemplate, mode)
+	if err != nil {
+		return "", fmt.Errorf("cannot announce writer of hierarchical lock %s: %w", m.id, err)
+	}
+	m.emit(Event{Kind: EventWriterPending, Path: pending, Info: fmt.Sprintf("%v by %s", mode, currentHolder())})
+	return pending, nil
+}
+
+// createHolderFile creates a file named by the template for given mode, recording the current process.
+func (m *Mutex) createHolderFile(template string, mode LockMode) (string, error) {
+	f, err := ioutil.TempFile(m.directory, fmt.Sprintf(template, m.name(), mode))
+	if err != nil {
+		return "", err
+	}
+	fileName := f.Name()
+	err = json.NewEncoder(f).Encode(currentHolder())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(fileName, m.fileMode)
+	}
+	if err != nil {
+		os.Remove(fileName)
+		return "", err
+	}
+	return fileName, nil
+}
+
+// convertHold changes the mode of the own lock, if compatible with locks held by others,
+// and returns the new path of the file recording the lock.
+// Returns an empty path if the mode is not compatible. Must be called with the guard locked.
+func (m *Mutex) convertHold(hold string, mode LockMode) (string, error) {
+	if ok, err := m.compatible(mode, hold); !ok || err != nil {
+		return "", err
+	}
+	_, suffix := m.parseHold(hold)
+	converted := filepath.Join(m.directory, fmt.Sprintf("%s-%s-%s", m.name(), mode, suffix))
+	if err := os.Rename(hold, converted); err != nil {
+		return "", fmt.Errorf("cannot convert hierarchical lock %s: %w", m.id, err)
+	}
+	return converted, nil
+}
+
+// parseHold returns the mode and the unique suffix of a file recording a hierarchical lock.
+func (m *Mutex) parseHold(hold string) (LockMode, string) {
+	parts := strings.SplitN(strings.TrimPrefix(filepath.Base(hold), m.name()+"-"), "-", 2)
+	if len(parts) < 2 {
+		return Exclusive, parts[0]
+	}
+	return parseLockMode(parts[0]), parts[1]
+}
+
+// parseLockMode returns the LockMode of given name; unknown names are treated as Exclusive.
+func parseLockMode(name string) LockMode {
+	for mode, modeName := range lockModeNames {
+		if modeName == name {
+			return mode
+		}
+	}
+	return Exclusive
+}
+
+// holdGone reports whether the holder of the hierarchical lock (or the pending writer) file is gone:
+// the file has not been refreshed for the dead timeout of the Mutex (at least two refresh periods),
+// or it has been created by a process of the local host, which does not exist anymore.
+func (m *Mutex) holdGone(hold string) bool {
+	limit := m.deadAgeRecovery
+	if limit >= 0 && limit < 2*m.refresh {
+		limit = 2 * m.refresh
+	}
+	if info, err := os.Stat(hold); err == nil && limit >= 0 && time.Since(info.ModTime()) > limit {
+		return true
+	}
+	return holderGone(hold)
+}
+
+// holderGone reports whether the hierarchical lock (or pending writer) file has been created by a process of the local host,
+// which does not exist anymore.
+func holderGone(hold string) bool {
+	b, err := ioutil.ReadFile(hold)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	var holder Holder
+	if json.Unmarshal(b, &holder) != nil || holder.Pid <= 0 {
+		return false
+	}
+	host, _ := os.Hostname()
+	return holder.Host == host && !processAlive(holder.Pid)
+}
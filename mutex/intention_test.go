@@ -0,0 +1,314 @@
+package mutex
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockHierarchical(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tryLock := func(id string, mode LockMode) (*HierarchicalLock, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return mgr.LockHierarchical(ctx, id, mode)
+	}
+
+	nightly, err := tryLock("tenantA/jobs/nightly", Exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hourly, err := tryLock("tenantA/jobs/hourly", Exclusive)
+	if err != nil {
+		t.Fatalf("sibling jobs should not conflict: %v", err)
+	}
+	if _, err := tryLock("tenantA/jobs/nightly", Shared); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a locked job", err)
+	}
+	if _, err := tryLock("tenantA", Exclusive); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for freezing a busy tenant", err)
+	}
+	other, err := tryLock("tenantB", Exclusive)
+	if err != nil {
+		t.Fatalf("other tenant should not conflict: %v", err)
+	}
+	other.Unlock()
+
+	if err := nightly.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hourly.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	freeze, err := tryLock("tenantA", Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer freeze.Unlock()
+	if _, err := tryLock("tenantA/jobs/nightly", Exclusive); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a job of a frozen tenant", err)
+	}
+	reader, err := tryLock("tenantA/jobs/nightly", Shared)
+	if err != nil {
+		t.Fatalf("shared locks should not conflict: %v", err)
+	}
+	reader.Unlock()
+}
+
+func TestLockModeString(t *testing.T) {
+	for mode, expected := range map[LockMode]string{IntentShared: "IS", IntentExclusive: "IX", Shared: "S", Exclusive: "X"} {
+		if mode.String() != expected {
+			t.Fatalf("wrong name \"%s\" instead of \"%s\"", mode.String(), expected)
+		}
+		if parseLockMode(expected) != mode {
+			t.Fatalf("wrong mode %v instead of %v", parseLockMode(expected), mode)
+		}
+	}
+}
+
+func TestHierarchicalDefaults(t *testing.T) {
+	mgr, err := NewManagerExt(temporaryCatalog(t), 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := mgr.LockHierarchical(context.Background(), "tenantA/jobs/nightly", Exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHierarchicalUpgrade(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	scan, err := mgr.LockHierarchical(timeout(), "tenantA/report", Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := mgr.LockHierarchical(timeout(), "tenantA/report", Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scan.Upgrade(timeout()); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for upgrade with another reader", err)
+	}
+	if scan.Mode() != Shared {
+		t.Fatalf("wrong mode %v instead of %v", scan.Mode(), Shared)
+	}
+	other.Unlock()
+	if err := scan.Upgrade(timeout()); err != nil {
+		t.Fatal(err)
+	}
+	if scan.Mode() != Exclusive {
+		t.Fatalf("wrong mode %v instead of %v", scan.Mode(), Exclusive)
+	}
+	if _, err := mgr.LockHierarchical(timeout(), "tenantA/report", Shared); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a reader of an upgraded lock", err)
+	}
+	if _, err := mgr.LockHierarchical(timeout(), "tenantA", Shared); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a reader of an upgraded parent", err)
+	}
+
+	if err := scan.Downgrade(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := mgr.LockHierarchical(timeout(), "tenantA/report", Shared)
+	if err != nil {
+		t.Fatalf("shared locks should not conflict after downgrade: %v", err)
+	}
+	reader.Unlock()
+	if err := scan.Downgrade(); err == nil {
+		t.Fatal("shared lock should not be downgraded")
+	}
+	if err := scan.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHierarchicalReaders(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readers, err := mgr.Readers("tenantA"); err != nil || len(readers) != 0 {
+		t.Fatalf("wrong readers %v, %v instead of none", readers, err)
+	}
+	for _, id := range []string{"tenantA", "tenantA/report"} {
+		lock, err := mgr.LockHierarchical(context.Background(), id, Shared)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Unlock()
+	}
+	readers, err := mgr.Readers("tenantA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readers) != 2 {
+		t.Fatalf("wrong number of readers %d instead of 2", len(readers))
+	}
+	if readers[0].Mode != Shared && readers[1].Mode != Shared {
+		t.Fatalf("missing %v reader in %v", Shared, readers)
+	}
+	if readers[0].Holder != currentHolder() {
+		t.Fatalf("wrong holder %v instead of %v", readers[0].Holder, currentHolder())
+	}
+}
+
+func TestWriterPreference(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	var events []Event
+	var mx sync.Mutex
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithWriterPreference(), WithEventHandler(func(e Event) {
+			mx.Lock()
+			defer mx.Unlock()
+			events = append(events, e)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tryLock := func(mgr *Manager, id string, mode LockMode) (*HierarchicalLock, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return mgr.LockHierarchical(ctx, id, mode)
+	}
+
+	reader, err := tryLock(mgr, "tenantA/report", Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		writer, err := mgr.LockHierarchical(ctx, "tenantA/report", Exclusive)
+		if err == nil {
+			writer.Unlock()
+		}
+		acquired <- err
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if writers, err := reader.WritersPending(); err != nil {
+			t.Fatal(err)
+		} else if len(writers) == 1 {
+			if writers[0].Mode != Exclusive {
+				t.Fatalf("wrong mode %v instead of %v", writers[0].Mode, Exclusive)
+			}
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("the writer has not been announced")
+		}
+	}
+	if _, err := tryLock(mgr, "tenantA/report", Shared); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a reader with a pending writer", err)
+	}
+	other, err := tryLock(plain, "tenantA/report", Shared)
+	if err != nil {
+		t.Fatalf("readers without writer preference should not wait: %v", err)
+	}
+	other.Unlock()
+	if err := reader.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acquired; err != nil {
+		t.Fatalf("the writer has not acquired the lock: %v", err)
+	}
+	if writers, err := mgr.PendingWriters("tenantA/report"); err != nil || len(writers) != 0 {
+		t.Fatalf("wrong pending writers %v (%v) instead of none", writers, err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	announced := 0
+	for _, e := range events {
+		if e.Kind == EventWriterPending {
+			announced++
+		}
+	}
+	if announced != 1 {
+		t.Fatalf("wrong number of %v events %d instead of 1", EventWriterPending, announced)
+	}
+}
+
+func TestHierarchicalExpired(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	const refresh = 10 * time.Millisecond
+	const deadTimeout = 50 * time.Millisecond
+	mgr, err := NewManagerExt(mutexRoot, time.Millisecond, refresh, deadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tryLock := func(id string, mode LockMode) (*HierarchicalLock, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*deadTimeout)
+		defer cancel()
+		return mgr.LockHierarchical(ctx, id, mode)
+	}
+	// Refreshed, so held longer than the dead timeout
+	held, err := tryLock("tenantA", Exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * deadTimeout)
+	if _, err := tryLock("tenantA", Shared); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired for a refreshed lock", err)
+	}
+	if err := held.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held by a process of another host, which has stopped refreshing it
+	guard, err := mgr.intentionGuard("tenantA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.init(); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := guard.createHolderFile(intentionTemplate, Shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(Holder{Host: "other-host", Pid: 1})
+	if err := os.WriteFile(hold, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if readers, err := mgr.Readers("tenantA"); err != nil || len(readers) != 1 {
+		t.Fatalf("wrong readers %v, %v instead of 1", readers, err)
+	}
+	old := time.Now().Add(-2 * deadTimeout)
+	if err := os.Chtimes(hold, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if readers, err := mgr.Readers("tenantA"); err != nil || len(readers) != 0 {
+		t.Fatalf("wrong readers %v, %v instead of none", readers, err)
+	}
+	lock, err := tryLock("tenantA", Exclusive)
+	if err != nil {
+		t.Fatalf("a lock of a gone holder should be discarded: %v", err)
+	}
+	lock.Unlock()
+}
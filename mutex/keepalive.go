@@ -0,0 +1,192 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLockLost is reported by KeepAlive, when the lock of the Mutex has been released or replaced by another process.
+var ErrLockLost = errors.New("lock lost")
+
+// KeepAlive refreshes the lock held by the Mutex every refresh period, until the context is done,
+// so the lock is not considered stale by other processes however long it is held.
+// If a refresh fails or the lock has been released or replaced meanwhile (ErrLockLost),
+// the error is sent to the returned channel and refreshing stops. The channel is never closed.
+// With WithReacquireOnLoss, the lost lock is acquired again instead, waiting until the context is done.
+// Note the lock file is replaced by each refresh, once checked to be still held, so a lock file removed
+// (or broken and taken by a waiter) only right before the replacement may still be overwritten.
+// KeepAlive also watches for challenges of waiters going to break the lock as stale (see WithBreakGrace):
+// a challenge is reported as EventChallenged and answered by an immediate refresh, which vetoes it.
+func (m *Mutex) KeepAlive(ctx context.Context) <-chan error {
+	lost := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(m.refresh)
+		defer ticker.Stop()
+		watch := time.NewTicker(m.refresh / challengeChecks)
+		defer watch.Stop()
+		var answered time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-watch.C:
+				c, _ := m.Challenged()
+				if c == nil || c.Created.Equal(answered) {
+					continue
+				}
+				answered = c.Created
+				m.emit(Event{Kind: EventChallenged, Path: m.challengePath(),
+					Info: fmt.Sprintf("by %s, to be broken at %s unless refreshed", c.Breaker, c.Deadline.Format(time.RFC3339Nano))})
+			case <-ticker.C:
+			}
+			err := m.refreshHeld()
+			if err != nil && m.reacquire && errors.Is(err, ErrLockLost) {
+				err = m.reacquireLost(ctx)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					lost <- err
+				}
+				return
+			}
+			if m.refreshed != nil {
+				m.refreshed(m)
+			}
+		}
+	}()
+	return lost
+}
+
+// Touch refreshes the timestamp of the current lock of the Mutex on demand, so it does not get stale.
+// Unlike KeepAlive, it refreshes a lock held by another process as well, e.g. a lock taken by a previous
+// step of a shell script. The holder keeps the lock alive as usual, as the lock stays with the same trace.
+// Returns an error wrapping ErrNotLocked, if the Mutex is not locked.
+func (m *Mutex) Touch() error {
+	if err := m.checkAccess(AclLock); err != nil {
+		return err
+	}
+	if m.isHeld() {
+		return m.refreshHeld()
+	}
+	target := m.LockPath()
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: lock %s does not exist", ErrNotLocked, m.id)
+	} else if err != nil {
+		return err
+	}
+	md, err := m.readMetadata(target)
+	if err != nil {
+		return fmt.Errorf("cannot refresh lock %s: %w", m.id, err)
+	}
+	// Make sure the lock has not been released or replaced meanwhile
+	unchanged := m.unchangedLock(target, info, "")
+	if err := unchanged(); err != nil {
+		return err
+	}
+	if _, err := m.writeMetadataIf(target, md, unchanged); errors.Is(err, ErrLockLost) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("cannot refresh lock %s: %w", m.id, err)
+	}
+	return nil
+}
+
+// refreshHeld refreshes the timestamp of the lock held by the Mutex.
+func (m *Mutex) refreshHeld() error {
+	m.releaseMx.Lock()
+	defer m.releaseMx.Unlock()
+	if m.held == nil {
+		return fmt.Errorf("%w: lock %s is not held", ErrLockLost, m.id)
+	}
+	fileName := m.LockPath()
+	current, err := os.Stat(fileName)
+	if err != nil {
+		return fmt.Errorf("%w: lock %s has been released", ErrLockLost, m.id)
+	}
+	md, err := m.readMetadata(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: lock %s has been released", ErrLockLost, m.id)
+	}
+	if md == nil || (err != nil && !errors.Is(err, ErrInvalidSignature)) {
+		return fmt.Errorf("cannot refresh lock %s: %w", m.id, err)
+	}
+	// A lock refreshed by Touch of another process is replaced, but still belongs to the same acquisition
+	trace := m.Trace()
+	if !os.SameFile(m.held, current) && (trace == "" || md.Trace != trace) {
+		return fmt.Errorf("%w: lock %s has been released or replaced", ErrLockLost, m.id)
+	}
+	// Checked again right before the lock file is replaced, as a waiter may have broken and taken it meanwhile
+	if _, err := m.writeMetadataIf(fileName, md, m.unchangedLock(fileName, m.held, trace)); errors.Is(err, ErrLockLost) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("cannot refresh lock %s: %w", m.id, err)
+	}
+	m.markHeld()
+	return nil
+}
+
+// unchangedLock returns a check, that the lock file is still the given one or it belongs
+// to the acquisition of the trace (if not empty), i.e. it has not been released or taken by another process.
+func (m *Mutex) unchangedLock(fileName string, lock os.FileInfo, trace string) func() error {
+	return func() error {
+		current, err := os.Stat(fileName)
+		if err != nil {
+			return fmt.Errorf("%w: lock %s has been released", ErrLockLost, m.id)
+		}
+		if os.SameFile(lock, current) {
+			return nil
+		}
+		if md, _ := m.readMetadata(fileName); trace != "" && md != nil && md.Trace == trace {
+			return nil
+		}
+		return fmt.Errorf("%w: lock %s has been released or replaced", ErrLockLost, m.id)
+	}
+}
+
+// WithRefreshCallback makes KeepAlive call the callback after each successful refresh of the lock,
+// e.g. to feed a watchdog, which restarts the application if refreshing stalls.
+func WithRefreshCallback(callback func(m *Mutex)) Option {
+	return func(m *Mutex) {
+		m.refreshed = callback
+	}
+}
+
+// WithReacquireOnLoss makes KeepAlive acquire the Mutex again, when its lock has been lost (ErrLockLost),
+// e.g. broken as stale or stolen by another process. Once the lock is reacquired, EventReacquired is reported
+// and the callback (if not nil) is called with fencing tokens of the lost and the new lock, so the application
+// can handle the gap, in which it has not held the Mutex.
+func WithReacquireOnLoss(callback func(m *Mutex, oldToken uint64, newToken uint64)) Option {
+	return func(m *Mutex) {
+		m.reacquire = true
+		m.reacquired = callback
+	}
+}
+
+// reacquireLost acquires the lost lock of the Mutex again.
+func (m *Mutex) reacquireLost(ctx context.Context) error {
+	_, oldToken := m.acquisition()
+	m.forgetHeld()
+	if err := m.LockWithContext(ctx); err != nil {
+		return fmt.Errorf("cannot reacquire lost lock %s: %w", m.id, err)
+	}
+	_, newToken := m.acquisition()
+	m.emit(Event{Kind: EventReacquired, Path: m.LockPath(), Info: fmt.Sprintf("token %d replaced by %d", oldToken, newToken)})
+	if m.reacquired != nil {
+		m.reacquired(m, oldToken, newToken)
+	}
+	return nil
+}
+
+// forgetHeld releases resources of the lost lock held by the Mutex, leaving the lock file intact.
+func (m *Mutex) forgetHeld() {
+	m.releaseMx.Lock()
+	defer m.releaseMx.Unlock()
+	m.stopHoldWatch()
+	m.checkStolen()
+	m.releaseFlock()
+	m.releaseLocal()
+}
@@ -0,0 +1,184 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	const mutexId = "keepalive-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	md, err := mx.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := mx.KeepAlive(ctx)
+	time.Sleep(100 * time.Millisecond)
+	if refreshed, err := mx.Metadata(); err != nil || !refreshed.Refreshed.After(md.Refreshed) {
+		t.Fatalf("lock not refreshed: %+v (%v)", refreshed, err)
+	}
+	if refreshed, _ := mx.Metadata(); refreshed.Token != md.Token || !refreshed.Created.Equal(md.Created) {
+		t.Fatalf("wrong refreshed metadata %+v instead of %+v", refreshed, md)
+	}
+	// Not in the middle of a refresh, which might replace the lock file
+	mx.releaseMx.Lock()
+	err = os.Remove(mx.LockPath())
+	mx.releaseMx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrLockLost) {
+			t.Fatalf("wrong error %v instead of %v", err, ErrLockLost)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lost lock not reported")
+	}
+}
+
+func TestReacquireOnLoss(t *testing.T) {
+	const mutexId = "reacquire-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	tokens := make(chan [2]uint64, 1)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout,
+		WithReacquireOnLoss(func(m *Mutex, oldToken uint64, newToken uint64) { tokens <- [2]uint64{oldToken, newToken} }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := mx.KeepAlive(ctx)
+	thief := newTestMutex(mutexRoot, mutexId)
+	mx.releaseMx.Lock()
+	err = os.Remove(mx.LockPath())
+	if err == nil {
+		err = thief.TryLock(time.Second)
+	}
+	mx.releaseMx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	thief.Unlock()
+	select {
+	case got := <-tokens:
+		if got[0] != 1 || got[1] != 3 {
+			t.Fatalf("wrong tokens %v instead of [1 3]", got)
+		}
+	case err := <-lost:
+		t.Fatalf("lock lost: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("lock not reacquired")
+	}
+	cancel()
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatalf("TryUnlock failed (%v), but should succeed.", err)
+	}
+}
+
+func TestRefreshCallback(t *testing.T) {
+	const mutexId = "refresh-callback-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	refreshed := make(chan struct{}, 1)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout,
+		WithRefreshCallback(func(m *Mutex) {
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mx.KeepAlive(ctx)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("refresh callback not called")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	const mutexId = "touch-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := step.Touch(); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("wrong result of Touch(): %v instead of %v", err, ErrNotLocked)
+	}
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer holder.Unlock()
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err := step.Touch(); err != nil {
+			t.Fatalf("Touch failed (%v), but should succeed.", err)
+		}
+	}
+	if holder.Stale() {
+		t.Fatal("a touched lock should not be stale")
+	}
+	if err := holder.Touch(); err != nil {
+		t.Fatalf("Touch of the held lock failed (%v), but should succeed.", err)
+	}
+}
+
+func TestRefreshRetaken(t *testing.T) {
+	const mutexId = "refresh-retaken-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	// The lock broken and taken by the waiter
+	if err := os.Remove(holder.LockPath()); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer waiter.Unlock()
+	md, err := waiter.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Touch(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("wrong result of Touch(): %v instead of %v", err, ErrLockLost)
+	}
+	if current, err := waiter.Metadata(); err != nil || current.Token != md.Token || current.Trace != md.Trace {
+		t.Fatalf("wrong metadata %+v (%v) instead of %+v", current, err, md)
+	}
+	if err := waiter.Touch(); err != nil {
+		t.Fatalf("Touch of the held lock failed (%v), but should succeed.", err)
+	}
+}
@@ -0,0 +1,67 @@
+package mutex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WithLabels attaches key=value labels (e.g. "team": "etl") to locks of the Mutex, recorded in their metadata,
+// so mutexes of large shared roots can be selected by them, see LabelSelector.
+func WithLabels(labels map[string]string) Option {
+	return func(m *Mutex) {
+		if m.labels == nil {
+			m.labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			m.labels[k] = v
+		}
+	}
+}
+
+// A LabelSelector selects locks with all its labels, see ParseLabelSelector. An empty selector selects all locks.
+type LabelSelector map[string]string
+
+// ParseLabelSelector parses a selector of comma separated key=value pairs, like "team=etl,app=loader".
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	result := LabelSelector{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		k, v, err := ParseLabel(pair)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// ParseLabel parses a label in the key=value form.
+func ParseLabel(s string) (string, string, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid label \"%s\", expected key=value", s)
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), nil
+}
+
+// Matches reports whether the labels have all labels of the selector.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for k, v := range s {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s LabelSelector) String() string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
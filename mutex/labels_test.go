@@ -0,0 +1,58 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLabels(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, team := range map[string]string{"jobs/etl": "etl", "jobs/web": "web"} {
+		mx, err := NewMutex(mutexRoot, id, WithLabels(map[string]string{"team": team, "env": "prod"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mx.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		defer mx.TryUnlock()
+	}
+	selector, err := ParseLabelSelector("team=etl, env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selector.String(); got != "env=prod,team=etl" {
+		t.Fatalf("wrong selector: \"%s\" instead of \"%s\"", got, "env=prod,team=etl")
+	}
+	if _, err := ParseLabelSelector("team"); err == nil {
+		t.Fatalf("ParseLabelSelector succeeded, but should fail.")
+	}
+	infos, err := mgr.Infos("jobs/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var selected []string
+	for _, info := range infos {
+		if selector.Matches(info.Labels) {
+			selected = append(selected, info.Id)
+		}
+	}
+	if len(selected) != 1 || selected[0] != "jobs/etl" {
+		t.Fatalf("wrong selected mutexes: %v instead of [jobs/etl]", selected)
+	}
+	time.Sleep(10 * time.Millisecond)
+	removed, err := mgr.SweepSelected(AllIds, selector, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("wrong removed files: %v", removed)
+	}
+	if infos, err := mgr.Infos("jobs/..."); err != nil || len(infos) != 1 || infos[0].Id != "jobs/web" {
+		t.Fatalf("wrong infos: %+v (%v)", infos, err)
+	}
+}
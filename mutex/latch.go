@@ -0,0 +1,112 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A latchCountTemplate defines name template of the file keeping the count of a Latch.
+const latchCountTemplate = "%s-latch.count"
+
+// A Latch is a countdown latch shared by processes (possibly on different hosts): processes call CountDown,
+// while others Wait until the count reaches zero. The count is kept in a file in the directory of the Latch's
+// Mutex, which guards its updates. Once it reaches zero, the Latch stays open.
+// Like a Mutex, a Latch instance is used by a single process; each process creates its own.
+type Latch struct {
+	m *Mutex
+}
+
+// NewLatch creates a Latch with given id under root. The count is set, unless the Latch already exists.
+func NewLatch(root string, id string, count uint64, opts ...Option) (*Latch, error) {
+	m, err := NewMutex(root, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newLatch(m, count)
+}
+
+// Latch creates a Latch with given id, using the Manager's configuration. The count is set,
+// unless the Latch already exists.
+func (mgr *Manager) Latch(id string, count uint64) (*Latch, error) {
+	m, err := mgr.Mutex(id)
+	if err != nil {
+		return nil, err
+	}
+	return newLatch(m, count)
+}
+
+func newLatch(m *Mutex, count uint64) (*Latch, error) {
+	l := &Latch{m: m}
+	if _, err := os.Stat(l.countPath()); err == nil {
+		return l, nil
+	}
+	if err := m.TryLock(0); err != nil {
+		return nil, err
+	}
+	defer m.TryUnlock()
+	if _, err := os.Stat(l.countPath()); os.IsNotExist(err) {
+		if err := l.store(count); err != nil {
+			return nil, fmt.Errorf("cannot create latch %s: %w", m.id, err)
+		}
+	}
+	return l, nil
+}
+
+// CountDown decrements the count of the Latch, unless it is already zero. Returns the new count.
+func (l *Latch) CountDown() (uint64, error) {
+	if err := l.m.TryLock(0); err != nil {
+		return 0, err
+	}
+	defer l.m.TryUnlock()
+	count, err := l.Count()
+	if err != nil || count == 0 {
+		return count, err
+	}
+	count--
+	if err := l.store(count); err != nil {
+		return 0, fmt.Errorf("cannot count down latch %s: %w", l.m.id, err)
+	}
+	return count, nil
+}
+
+// Count returns the current count of the Latch.
+func (l *Latch) Count() (uint64, error) {
+	data, err := ioutil.ReadFile(l.countPath())
+	if err != nil {
+		return 0, err
+	}
+	result, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupted count file %s: %w", l.countPath(), err)
+	}
+	return result, nil
+}
+
+// Wait waits until the count of the Latch reaches zero or the context is done (ErrExpired).
+func (l *Latch) Wait(ctx context.Context) error {
+	for {
+		count, err := l.Count()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if sleepOrDone(ctx, l.m.pulse) {
+			return ErrExpired
+		}
+	}
+}
+
+func (l *Latch) store(count uint64) error {
+	return l.m.replaceFile(l.countPath(), []byte(fmt.Sprintf("%d\n", count)))
+}
+
+func (l *Latch) countPath() string {
+	return path.Join(l.m.directory, expandTemplate(latchCountTemplate, l.m.name()))
+}
@@ -0,0 +1,45 @@
+package mutex
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatch(t *testing.T) {
+	const latchId = "latch-test"
+	mutexRoot := temporaryCatalog(t)
+	waiter, err := NewLatch(mutexRoot, latchId, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.m.pulse = 10 * time.Millisecond
+	done := make(chan error, 1)
+	go func() { done <- waiter.Wait(context.Background()) }()
+	for i := 2; i >= 0; i-- {
+		// Another process sees the existing count
+		l, err := NewLatch(mutexRoot, latchId, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-done:
+			t.Fatal("latch opened too early")
+		case <-time.After(30 * time.Millisecond):
+		}
+		if count, err := l.CountDown(); err != nil || count != uint64(i) {
+			t.Fatalf("wrong result of CountDown(): %d (%v) instead of %d", count, err, i)
+		}
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("latch not opened")
+	}
+	if count, err := waiter.CountDown(); err != nil || count != 0 {
+		t.Fatalf("wrong result of CountDown(): %d (%v) instead of 0", count, err)
+	}
+}
@@ -0,0 +1,42 @@
+package mutex
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockLevel(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	newLeveled := func(id string, level int) *Mutex {
+		m, err := NewMutex(mutexRoot, id, WithLockLevel(level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	low, high, unleveled := newLeveled("level-low", 1), newLeveled("level-high", 2), newTestMutex(mutexRoot, "level-none")
+	if err := low.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	if err := high.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	if err := unleveled.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	unleveled.Unlock()
+	high.Unlock()
+	low.Unlock()
+
+	if err := high.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer high.Unlock()
+	if err := low.TryLock(time.Second); !errors.Is(err, ErrLockOrder) {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrLockOrder)
+	}
+	if err := newLeveled("level-same", 2).TryLock(time.Second); !errors.Is(err, ErrLockOrder) {
+		t.Fatalf("wrong result of TryLock(): %v instead of %v", err, ErrLockOrder)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mutex
+
+import "os"
+
+// linkCount returns the number of hard links of the file described by info.
+// Not supported on this platform.
+func linkCount(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,66 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Operations reported by LockError.
+const (
+	OpLock   = "lock"
+	OpUnlock = "unlock"
+)
+
+// A LockError is the value of panics of MustLock, MustUnlock and lockers returned by Locker,
+// describing the failed operation and the Mutex. Use errors.Is or errors.As on it to examine the cause.
+type LockError struct {
+	Op  string // OpLock or OpUnlock
+	Id  string // Id of the Mutex
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("cannot %s mutex %s: %v", e.Op, e.Id, e.Err)
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// MustLock locks given Mutex, waiting indefinitely. Panics with a *LockError in case of any error.
+func (m *Mutex) MustLock() {
+	if err := m.TryLock(0); err != nil {
+		panic(&LockError{Op: OpLock, Id: m.id, Err: err})
+	}
+}
+
+// MustUnlock unlocks given Mutex. Panics with a *LockError in case of any error.
+func (m *Mutex) MustUnlock() {
+	if err := m.TryUnlock(); err != nil {
+		panic(&LockError{Op: OpUnlock, Id: m.id, Err: err})
+	}
+}
+
+// Locker returns a sync.Locker locking the Mutex with the context (see LockWithContext), e.g. for sync.Cond.
+// As sync.Locker cannot report errors, its Lock panics with a *LockError wrapping ErrExpired, once
+// the context is done before the Mutex is locked.
+func (m *Mutex) Locker(ctx context.Context) sync.Locker {
+	return &contextLocker{m: m, ctx: ctx}
+}
+
+// A contextLocker is a sync.Locker locking a Mutex with a context.
+type contextLocker struct {
+	m   *Mutex
+	ctx context.Context
+}
+
+func (l *contextLocker) Lock() {
+	if err := l.m.LockWithContext(l.ctx); err != nil {
+		panic(&LockError{Op: OpLock, Id: l.m.id, Err: err})
+	}
+}
+
+func (l *contextLocker) Unlock() {
+	l.m.MustUnlock()
+}
@@ -0,0 +1,47 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMustUnlock(t *testing.T) {
+	const mutexId = "must-unlock-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	defer func() {
+		var lockErr *LockError
+		if err, _ := recover().(error); !errors.As(err, &lockErr) || lockErr.Op != OpUnlock ||
+			lockErr.Id != mutexId || !errors.Is(err, ErrNotLocked) {
+			t.Fatalf("wrong panic of MustUnlock(): %v", err)
+		}
+	}()
+	mx.MustUnlock()
+}
+
+func TestLocker(t *testing.T) {
+	const mutexId = "locker-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	locker := mx.Locker(context.Background())
+	locker.Lock()
+	if mx.When().IsZero() {
+		t.Fatal("mutex not locked by its locker")
+	}
+	other := newTestMutex(mutexRoot, mutexId)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrExpired) {
+				t.Fatalf("wrong panic of Lock() with a done context: %v", err)
+			}
+		}()
+		other.Locker(ctx).Lock()
+	}()
+	locker.Unlock()
+	if !mx.When().IsZero() {
+		t.Fatal("mutex not unlocked by its locker")
+	}
+}
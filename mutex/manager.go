@@ -0,0 +1,262 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Manager creates and lists mutexes sharing a common root directory and configuration.
+type Manager struct {
+	root        string
+	base        string // Directory of the namespace of the Manager, see WithNamespace
+	pulse       time.Duration
+	refresh     time.Duration
+	deadTimeout time.Duration
+	sharded     bool // See WithShardedLayout
+	opts        []Option
+	statsMx     sync.Mutex
+	stats       map[string]*statsCounter
+	localMx     sync.Mutex
+	local       map[string]chan struct{}
+}
+
+// AllIds is a List pattern matching every mutex under the Manager's root.
+// A pattern ending with "/..." matches given id and all ids nested under it, e.g. "tenantA/...".
+const AllIds = "..."
+
+// NewManager creates a Manager of mutexes located under the root directory, using default timings.
+func NewManager(root string, opts ...Option) (*Manager, error) {
+	return NewManagerExt(root, DefaultPulse, DefaultRefresh, DefaultDeadTimeout, opts...)
+}
+
+// NewManagerExt creates a Manager of mutexes located under the root directory.
+// The timings and options are passed to every Mutex created by the Manager, see NewMutexExt;
+// non-positive pulse and refresh are replaced by defaults, as by NewMutexExt.
+func NewManagerExt(root string, pulse time.Duration, refresh time.Duration, deadTimeout time.Duration,
+	opts ...Option) (*Manager, error) {
+	root, err := resolveRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if pulse <= 0 {
+		pulse = DefaultPulse
+	}
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	m := newConfiguredMutex(opts)
+	return &Manager{
+		root:        root,
+		base:        path.Join(root, m.namespace),
+		pulse:       pulse,
+		refresh:     refresh,
+		deadTimeout: deadTimeout,
+		sharded:     m.sharded,
+		opts:        opts,
+	}, nil
+}
+
+// Root returns the root directory of the Manager.
+func (mgr *Manager) Root() string {
+	return mgr.root
+}
+
+// Mutex returns the Mutex of given id, configured as the Manager.
+// Mutexes of the same id created by the Manager exclude each other within the process first,
+// so only one goroutine per process at a time competes for the lock file, in order of arrival.
+func (mgr *Manager) Mutex(id string) (*Mutex, error) {
+	m, err := NewMutexExt(mgr.root, id, mgr.pulse, mgr.refresh, mgr.deadTimeout, mgr.opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.stats = mgr.statsCounter(m.id)
+	m.local = mgr.localLock(m.id)
+	return m, nil
+}
+
+// Listed returns the Mutex of an id returned by List or Walk, configured as the Manager, see Mutex.
+// Unlike Mutex, a hashed id (see WithHashedIds) is not hashed again, as it names the directory
+// of the mutex already; the original key is read from the file recording it.
+func (mgr *Manager) Listed(id string) (*Mutex, error) {
+	opts := append(append([]Option{}, mgr.opts...), withListedId())
+	m, err := NewMutexExt(mgr.root, id, mgr.pulse, mgr.refresh, mgr.deadTimeout, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.stats = mgr.statsCounter(m.id)
+	m.local = mgr.localLock(m.id)
+	return m, nil
+}
+
+// peek returns the Mutex of an id returned by List for reading its state only, so its directory
+// is not created and roots, which cannot be written to, can be inspected as well, see WithLazyInit.
+func (mgr *Manager) peek(id string) (*Mutex, error) {
+	opts := append(append([]Option{}, mgr.opts...), withListedId(), WithLazyInit())
+	return NewMutexExt(mgr.root, id, mgr.pulse, mgr.refresh, mgr.deadTimeout, opts...)
+}
+
+// withListedId makes the Mutex take its id as listed by Manager.List, see Manager.Listed.
+func withListedId() Option {
+	return func(m *Mutex) {
+		m.listedId = true
+	}
+}
+
+// localLock returns the process-local lock shared by mutexes of the id created by the Manager.
+func (mgr *Manager) localLock(id string) chan struct{} {
+	mgr.localMx.Lock()
+	defer mgr.localMx.Unlock()
+	if mgr.local == nil {
+		mgr.local = make(map[string]chan struct{})
+	}
+	c, ok := mgr.local[id]
+	if !ok {
+		c = make(chan struct{}, 1)
+		mgr.local[id] = c
+	}
+	return c
+}
+
+// List returns sorted ids of mutexes matching the pattern, which are currently locked or awaited.
+// The pattern is either an exact id, AllIds, or a prefix followed by "/...", like "tenantA/...".
+func (mgr *Manager) List(pattern string) ([]string, error) {
+	var result []string
+	err := mgr.Walk(context.Background(), pattern, func(id string) error {
+		result = append(result, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Walk calls fn for ids of mutexes matching the pattern (see List) as they are found, so huge roots
+// are listed without collecting all ids first. The ids are passed in the order of the directory walk,
+// which is not sorted. Stops when the context is done, returning its error, or when fn returns an error,
+// returning it as it is.
+func (mgr *Manager) Walk(ctx context.Context, pattern string, fn func(id string) error) error {
+	pattern = strings.Trim(pattern, namespaceSeparator)
+	start := mgr.base
+	exact := true
+	if pattern == AllIds {
+		exact = false
+	} else if strings.HasSuffix(pattern, namespaceSeparator+AllIds) {
+		exact = false
+		start = path.Join(mgr.base, mgr.relDir(strings.TrimSuffix(pattern, namespaceSeparator+AllIds)))
+	} else {
+		start = path.Join(mgr.base, mgr.relDir(pattern))
+	}
+
+	stopped := false // The error is returned by fn or the context
+	err := filepath.Walk(start, func(dir string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			stopped = true
+			return err
+		}
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				// Vanished meanwhile or belongs to another user - skip it
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == candidatesDirectory {
+			return filepath.SkipDir
+		}
+		if dir != mgr.base && mgr.isMutexDir(dir) {
+			rel, err := filepath.Rel(mgr.base, dir)
+			if err != nil {
+				return err
+			}
+			if id, ok := mgr.idOf(rel); ok {
+				if err := fn(id); err != nil {
+					stopped = true
+					return err
+				}
+			}
+		}
+		if exact {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && !stopped {
+		return fmt.Errorf("cannot list mutexes (%s): %w", pattern, err)
+	}
+	return err
+}
+
+// isMutexDir reports whether the directory holds the lock file or candidates of a mutex.
+func (mgr *Manager) isMutexDir(dir string) bool {
+	name := strings.ToLower(filepath.Base(dir))
+	m := newConfiguredMutex(mgr.opts)
+	patterns := []string{
+		filepath.Join(dir, expandTemplate(m.lockTemplate, name)),
+		filepath.Join(dir, candidatesDirectory, expandTemplate(m.candidateTemplate, name)),
+	}
+	for _, pattern := range patterns {
+		if matches, err := filepath.Glob(pattern); err == nil && len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TryLockAny locks the first free mutex of given ids and returns its id and a Handle of the acquisition
+// (see Acquire), waiting until one of them gets free or the context is done (ErrExpired). Each call starts
+// at a random position of ids, so workers competing for the same set of ids do not all fight over the first one.
+// Each mutex is tried once per round, but stale locks observed over the rounds are broken as usual.
+func (mgr *Manager) TryLockAny(ctx context.Context, ids []string) (string, *Handle, error) {
+	if len(ids) == 0 {
+		return "", nil, errors.New("no ids to lock")
+	}
+	mutexes := make([]*Mutex, len(ids))
+	for i, id := range ids {
+		m, err := mgr.Mutex(id)
+		if err != nil {
+			return "", nil, err
+		}
+		mutexes[i] = m
+	}
+	attempts := make([]lockAttempt, len(ids))
+	start := randomIndex(len(ids))
+	for {
+		for i := range ids {
+			k := (start + i) % len(ids)
+			if err := mutexes[k].lockOnce(ctx, &attempts[k]); err == nil {
+				return ids[k], mutexes[k].newHandle(), nil
+			} else if !errors.Is(err, ErrExpired) {
+				return "", nil, err
+			}
+		}
+		if sleepOrDone(ctx, mgr.pulse) {
+			return "", nil, ErrExpired
+		}
+	}
+}
+
+var (
+	randomMx  sync.Mutex
+	randomSrc = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randomIndex returns a random number in [0, n).
+func randomIndex(n int) int {
+	randomMx.Lock()
+	defer randomMx.Unlock()
+	return randomSrc.Intn(n)
+}
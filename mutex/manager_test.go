@@ -0,0 +1,290 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHierarchicalIds(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, "tenantA/jobs/nightly")
+	mx.Lock()
+	defer mx.Unlock()
+	if got := mx.When(); got.IsZero() {
+		t.Fatalf("mutex \"%s\" should be locked", mx.Id())
+	}
+}
+
+func TestManagerList(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"tenantA", "tenantA/jobs/nightly", "tenantA/jobs/hourly", "tenantB/jobs/nightly"} {
+		mx, err := mgr.Mutex(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mx.Lock()
+		defer mx.Unlock()
+	}
+	if _, err := mgr.Mutex("tenantA/idle"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{AllIds, []string{"tenantA", "tenantA/jobs/hourly", "tenantA/jobs/nightly", "tenantB/jobs/nightly"}},
+		{"tenantA/...", []string{"tenantA", "tenantA/jobs/hourly", "tenantA/jobs/nightly"}},
+		{"tenantA/jobs/...", []string{"tenantA/jobs/hourly", "tenantA/jobs/nightly"}},
+		{"tenantB/jobs/nightly", []string{"tenantB/jobs/nightly"}},
+		{"tenantA/idle", nil},
+		{"tenantC/...", nil},
+	}
+	for _, c := range cases {
+		got, err := mgr.List(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("wrong result of List(\"%s\"): %v instead of %v", c.pattern, got, c.want)
+		}
+	}
+}
+
+func TestManagerListed(t *testing.T) {
+	const key = "https://x/y"
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot, WithHashedIds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := mgr.Mutex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	ids, err := mgr.List(AllIds)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("wrong result of List: %v (%v)", ids, err)
+	}
+	listed, err := mgr.Listed(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed.LockPath() != mx.LockPath() || listed.Key() != key {
+		t.Fatalf("wrong listed mutex %s (%s) instead of %s (%s)", listed.LockPath(), listed.Key(), mx.LockPath(), key)
+	}
+}
+
+func TestManagerWalk(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"tenantA/jobs/hourly", "tenantA/jobs/nightly", "tenantB/jobs/nightly"}
+	for _, id := range ids {
+		mx, err := mgr.Mutex(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mx.Lock()
+		defer mx.Unlock()
+	}
+	var got []string
+	if err := mgr.Walk(context.Background(), AllIds, func(id string) error {
+		got = append(got, id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, ids) {
+		t.Fatalf("wrong ids walked: %v instead of %v", got, ids)
+	}
+
+	stop := errors.New("stop")
+	got = nil
+	if err := mgr.Walk(context.Background(), AllIds, func(id string) error {
+		got = append(got, id)
+		return stop
+	}); err != stop {
+		t.Fatalf("wrong result of Walk stopped by the callback: %v instead of %v", err, stop)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of ids walked after the callback failed: %d instead of %d", len(got), 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mgr.WalkInfos(ctx, AllIds, func(info Info) error {
+		t.Fatalf("mutex \"%s\" walked with a done context", info.Id)
+		return nil
+	}); err != context.Canceled {
+		t.Fatalf("wrong result of Walk with a done context: %v instead of %v", err, context.Canceled)
+	}
+}
+
+func TestManagerTryLockAny(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := []string{"shard-0", "shard-1", "shard-2"}
+	locked := make(map[string]bool)
+	for range shards {
+		id, h, err := mgr.TryLockAny(context.Background(), shards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked[id] {
+			t.Fatalf("shard \"%s\" locked twice", id)
+		}
+		locked[id] = true
+		defer h.Release()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if id, _, err := mgr.TryLockAny(ctx, shards); err != ErrExpired {
+		t.Fatalf("wrong result \"%s\", %v instead of ErrExpired", id, err)
+	}
+}
+
+func TestManagerDefaults(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := []string{"shard-0", "shard-1"}
+	for _, id := range shards {
+		m, err := holder.Mutex(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		defer m.Unlock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if id, _, err := mgr.TryLockAny(ctx, shards); err != ErrExpired {
+		t.Fatalf("wrong result \"%s\", %v instead of ErrExpired", id, err)
+	}
+	// Rounds paced by the default pulse rather than spinning
+	for id, stats := range mgr.Stats() {
+		if stats.Attempts > 2 {
+			t.Fatalf("wrong number of attempts %d to lock \"%s\" instead of at most %d", stats.Attempts, id, 2)
+		}
+	}
+}
+
+func TestManagerTryLockAnyStale(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	const deadTimeout = 50 * time.Millisecond
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, 10*time.Millisecond, deadTimeout, WithBreakGrace(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Never refreshed, as by a crashed holder
+	crashed, err := NewMutexExt(mutexRoot, "shard-0", 10*time.Millisecond, 10*time.Millisecond, deadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, h, err := mgr.TryLockAny(ctx, []string{"shard-0"})
+	if err != nil {
+		t.Fatalf("TryLockAny failed (%v), but should succeed.", err)
+	}
+	defer h.Release()
+	if id != "shard-0" || h.Token() != 2 {
+		t.Fatalf("wrong result \"%s\", token %d instead of \"shard-0\", token 2", id, h.Token())
+	}
+}
+
+func TestManagerLocalLock(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers = 10
+	value := 0
+	done := make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			mx, err := mgr.Mutex("local")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			value++
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+	if value != workers {
+		t.Fatalf("wrong value %d instead of %d", value, workers)
+	}
+	// Only the goroutine holding the process-local lock competes for the lock file
+	if stats := mgr.Stats()["local"]; stats.Attempts != workers {
+		t.Fatalf("wrong number of attempts %d instead of %d", stats.Attempts, workers)
+	}
+}
+
+func TestManagerNamespace(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	staging, err := NewManager(mutexRoot, WithNamespace("staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := NewManager(mutexRoot, WithNamespace("/prod/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mgr := range []*Manager{staging, prod} {
+		mx, err := mgr.Mutex("jobs/nightly")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mx.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock of mutex \"%s\" failed (%v), but should succeed.", mx.Id(), err)
+		}
+		defer mx.Unlock()
+	}
+	if mx, err := staging.Mutex("jobs/nightly"); err != nil || mx.Id() != "staging/jobs/nightly" {
+		t.Fatalf("wrong namespaced mutex %v (%v)", mx, err)
+	}
+	if ids, err := prod.List(AllIds); err != nil || !reflect.DeepEqual(ids, []string{"jobs/nightly"}) {
+		t.Fatalf("wrong ids of namespace: %v (%v)", ids, err)
+	}
+	all, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"prod/jobs/nightly", "staging/jobs/nightly"}
+	if ids, err := all.List(AllIds); err != nil || !reflect.DeepEqual(ids, want) {
+		t.Fatalf("wrong ids %v (%v) instead of %v", ids, err, want)
+	}
+}
@@ -0,0 +1,413 @@
+package mutex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetadataVersion is the version of the lock file format written by this package.
+const MetadataVersion = 1
+
+// LegacyVersion is the version reported for lock files holding a bare millisecond timestamp.
+const LegacyVersion = 0
+
+// Metadata describes a lock, as recorded in its lock file.
+type Metadata struct {
+	Version   int               `json:"version"`
+	Id        string            `json:"id,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Created   time.Time         `json:"created"`   // When the lock has been acquired
+	Refreshed time.Time         `json:"refreshed"` // When the lock has been refreshed for the last time
+	Holder    Holder            `json:"holder"`
+	Owner     string            `json:"owner,omitempty"`   // Application-defined owner of the lock, see WithOwner
+	Lease     Duration          `json:"lease,omitempty"`   // How long the lock is valid without being refreshed
+	Refresh   Duration          `json:"refresh,omitempty"` // How often the holder refreshes the lock
+	Token     uint64            `json:"token,omitempty"`   // Fencing token, increasing with each acquisition
+	Trace     string            `json:"trace,omitempty"`   // Identifier of the acquisition, see Mutex.Trace
+	Request   string            `json:"request,omitempty"` // Application request or job id, see WithRequestIdKey
+	Message   string            `json:"message,omitempty"` // Why the lock is held, see WithMessage
+	Labels    map[string]string `json:"labels,omitempty"`  // See WithLabels
+	Signature string            `json:"signature,omitempty"`
+}
+
+// A Holder identifies a process holding (or waiting for) a lock.
+type Holder struct {
+	Host string `json:"host,omitempty"`
+	Pid  int    `json:"pid,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+func (h Holder) String() string {
+	if h.Host == "" && h.Pid == 0 {
+		return "unknown"
+	}
+	result := fmt.Sprintf("%s[%d]", h.Host, h.Pid)
+	if h.User != "" {
+		result = h.User + "@" + result
+	}
+	return result
+}
+
+// A Duration is a time.Duration encoded in JSON as a string, like "1h0m0s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// currentHolder returns the Holder identifying the current process.
+func currentHolder() Holder {
+	result := Holder{Pid: os.Getpid()}
+	result.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		result.User = u.Username
+	}
+	return result
+}
+
+// newMetadata returns metadata of a new lock of the Mutex held by the current process.
+func (m *Mutex) newMetadata() *Metadata {
+	m.acquisitionMx.Lock()
+	defer m.acquisitionMx.Unlock()
+	md := &Metadata{
+		Version: MetadataVersion,
+		Id:      m.id,
+		Holder:  currentHolder(),
+		Lease:   Duration(m.deadAgeRecovery),
+		Refresh: Duration(m.refresh),
+		Owner:   m.owner,
+		Trace:   m.trace,
+		Request: m.request,
+		Message: m.message,
+		Labels:  m.labels,
+	}
+	if m.hashedIds {
+		md.Key = m.key
+	}
+	return md
+}
+
+// timestamp returns the time of the last refresh in milliseconds.
+func (md *Metadata) timestamp() int64 {
+	return nano2Millis(md.Refreshed.UnixNano())
+}
+
+// Metadata returns metadata of the current lock of the Mutex. If the Mutex is not locked,
+// the returned error satisfies errors.Is(err, os.ErrNotExist). Metadata with an invalid signature
+// (see WithSecret) are returned together with an error wrapping ErrInvalidSignature.
+func (m *Mutex) Metadata() (*Metadata, error) {
+	return m.readMetadata(m.LockPath())
+}
+
+// Migrate upgrades the lock file of the Mutex, if any, from the legacy format to the current one,
+// preserving its timestamp. Reports whether the lock file has been changed.
+func (m *Mutex) Migrate() (bool, error) {
+	fileName := m.LockPath()
+	info, err := os.Stat(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	md, err := parseMetadata(readRecord(fileName))
+	if err != nil {
+		return false, fmt.Errorf("cannot parse lock %s: %w", m.id, err)
+	}
+	if md == nil || md.Version >= MetadataVersion {
+		return false, nil
+	}
+	if m.secret != nil && !m.verify(md) {
+		return false, fmt.Errorf("%w of lock %s", ErrInvalidSignature, m.id)
+	}
+	md.Version = MetadataVersion
+	md.Id = m.id
+	if m.hashedIds {
+		md.Key = m.key
+	}
+	data, err := m.encodeMetadata(md)
+	if err != nil {
+		return false, err
+	}
+	// Make sure the lock has not been released or replaced meanwhile
+	if current, err := os.Stat(fileName); err != nil || !os.SameFile(info, current) {
+		return false, nil
+	}
+	if err := m.storeRecord(fileName, data, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Adopt takes over responsibility of the current lock of the Mutex, created by another process or tool,
+// e.g. after a controlled handoff. The lock metadata are updated to name the current process as the holder
+// and ownerToken as the owner, while the lock file is replaced atomically, so there is no gap in which
+// a third party could acquire the Mutex. The creation time and the fencing token of the lock are preserved.
+func (m *Mutex) Adopt(ownerToken string) error {
+	if err := m.checkAccess(AclLock); err != nil {
+		return err
+	}
+	fileName := m.LockPath()
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return fmt.Errorf("cannot adopt lock %s: %w", m.id, err)
+	}
+	md, err := m.readMetadata(fileName)
+	if err != nil {
+		return fmt.Errorf("cannot adopt lock %s: %w", m.id, err)
+	}
+	md.Version = MetadataVersion
+	md.Id = m.id
+	md.Holder = currentHolder()
+	md.Owner = ownerToken
+	md.Lease = Duration(m.deadAgeRecovery)
+	md.Refresh = Duration(m.refresh)
+	if m.hashedIds {
+		md.Key = m.key
+	}
+	// Make sure the lock has not been released or replaced meanwhile
+	if current, err := os.Stat(fileName); err != nil || !os.SameFile(info, current) {
+		return fmt.Errorf("cannot adopt lock %s: it has been released or replaced", m.id)
+	}
+	if _, err := m.writeMetadata(fileName, md); err != nil {
+		return fmt.Errorf("cannot adopt lock %s: %w", m.id, err)
+	}
+	m.owner = ownerToken
+	m.setAcquisition(md.Trace, md.Token)
+	m.markHeld()
+	return nil
+}
+
+// readMetadata reads metadata stored in the file and verifies its signature, if the Mutex has a secret.
+// Files not recording any metadata (e.g. created by touch) yield metadata based on their modification time;
+// in the WithMtimeFreshness mode, the modification time always determines time of the last refresh.
+func (m *Mutex) readMetadata(fileName string) (*Metadata, error) {
+	modTime := readModTime(fileName)
+	if modTime == 0 {
+		return nil, fmt.Errorf("lock %s: %w", m.id, os.ErrNotExist)
+	}
+	if m.dotLock {
+		return readDotLock(fileName, modTime), nil
+	}
+	record, err := readLiveRecord(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", m.id, err)
+	}
+	md, err := parseMetadata(record)
+	if err != nil || md == nil {
+		tm := millisToTime(modTime)
+		md = &Metadata{Version: LegacyVersion, Id: m.id, Created: tm, Refreshed: tm}
+		if m.secret != nil {
+			return md, fmt.Errorf("%w of lock %s: no signed metadata", ErrInvalidSignature, m.id)
+		}
+		return md, nil
+	}
+	if m.secret != nil && !m.verify(md) {
+		err = fmt.Errorf("%w of lock %s", ErrInvalidSignature, m.id)
+	}
+	if m.mtime {
+		md.Refreshed = millisToTime(modTime)
+	}
+	return md, err
+}
+
+// readVerifiedTimestamp reads time of the last refresh of the lock stored in the file and verifies
+// its signature, if the Mutex has a secret. Nonexistent files yield 0 without an error.
+func (m *Mutex) readVerifiedTimestamp(fileName string) (int64, error) {
+	md, err := m.readMetadata(fileName)
+	if md == nil {
+		return 0, nil
+	}
+	return md.timestamp(), err
+}
+
+// writeMetadata stores the metadata in the file, refreshing its timestamp.
+// Returns time of the refresh in milliseconds.
+func (m *Mutex) writeMetadata(fileName string, md *Metadata) (int64, error) {
+	return m.writeMetadataIf(fileName, md, nil)
+}
+
+// writeMetadataIf stores the metadata in the file like writeMetadata, if the check (unless nil) passes
+// right before the file is replaced, see replaceFileIf.
+func (m *Mutex) writeMetadataIf(fileName string, md *Metadata, check func() error) (int64, error) {
+	data, err := m.refreshRecord(md)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.storeRecord(fileName, data, check); err != nil {
+		return 0, err
+	}
+	return m.touchRecord(fileName, md)
+}
+
+// writeCandidate stores the metadata in the open candidate file, refreshing its timestamp.
+// Unlike lock files, candidates are not read by competitors, so they are rewritten in place,
+// saving creation and renaming of a temporary file per refresh.
+// Returns time of the refresh in milliseconds.
+func (m *Mutex) writeCandidate(f *os.File, md *Metadata) (int64, error) {
+	if m.xattrs {
+		return m.writeMetadata(f.Name(), md)
+	}
+	data, err := m.refreshRecord(md)
+	if err != nil {
+		return 0, err
+	}
+	data = append(data, '\n')
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return 0, err
+	}
+	if m.durable {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return m.touchRecord(f.Name(), md)
+}
+
+// refreshRecord refreshes the timestamp of the metadata and returns its lock record.
+func (m *Mutex) refreshRecord(md *Metadata) ([]byte, error) {
+	tm := time.Now().UTC()
+	md.Refreshed = tm
+	if md.Created.IsZero() {
+		md.Created = tm
+	}
+	if m.dotLock {
+		return []byte(strconv.Itoa(md.Holder.Pid)), nil
+	}
+	return m.encodeMetadata(md)
+}
+
+// touchRecord sets modification time of the file to the refresh time of the metadata in the
+// WithMtimeFreshness mode. Returns time of the refresh in milliseconds.
+func (m *Mutex) touchRecord(fileName string, md *Metadata) (int64, error) {
+	if m.mtime {
+		tm := md.Refreshed
+		if err := os.Chtimes(fileName, tm, tm); err != nil {
+			return 0, err
+		}
+		if err := m.syncFile(fileName); err != nil {
+			return 0, err
+		}
+	}
+	return md.timestamp(), nil
+}
+
+// storeRecord stores the lock record in the file, according to the configuration of the Mutex,
+// if the check (unless nil) passes right before.
+func (m *Mutex) storeRecord(fileName string, data []byte, check func() error) error {
+	if m.xattrs {
+		if check != nil {
+			if err := check(); err != nil {
+				return err
+			}
+		}
+		if err := setXattr(fileName, timestampXattr, data); err != nil {
+			return err
+		}
+		return m.syncFile(fileName)
+	}
+	return m.replaceFileIf(fileName, append(data, '\n'), check)
+}
+
+// nextToken issues the next fencing token of the Mutex. It must be called while holding the lock.
+func (m *Mutex) nextToken() (uint64, error) {
+	if m.dotLock {
+		return 0, nil
+	}
+	token, err := m.currentToken()
+	if err != nil {
+		return 0, err
+	}
+	token++
+	return token, m.replaceFile(m.tokenPath(), []byte(fmt.Sprintf("%d\n", token)))
+}
+
+// readRecord reads the lock record stored in the file, either in its contents or in its extended attribute.
+func readRecord(fileName string) string {
+	data, _ := readLiveRecord(fileName)
+	return data
+}
+
+// readLiveRecord reads the lock record like readRecord, but reports a file removed meanwhile,
+// also by another NFS client, as nonexistent.
+func readLiveRecord(fileName string) (string, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) || nfsGone(err) {
+		return "", os.ErrNotExist
+	} else if err != nil {
+		return "", nil
+	}
+	if data := strings.TrimSpace(string(b)); data != "" {
+		return data, nil
+	}
+	if b, err = getXattr(fileName, timestampXattr); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", nil
+}
+
+// parseMetadata parses the lock record, either a JSON document or a legacy bare timestamp
+// (optionally followed by its signature). Empty records yield nil.
+func parseMetadata(data string) (*Metadata, error) {
+	if data == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(data, "{") {
+		var md Metadata
+		if err := json.Unmarshal([]byte(data), &md); err != nil {
+			return nil, err
+		}
+		if md.Version < MetadataVersion {
+			return nil, fmt.Errorf("unsupported lock format version %d", md.Version)
+		}
+		return &md, nil
+	}
+	fields := strings.Fields(data)
+	value, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || value <= 0 {
+		return nil, errors.New("unrecognized lock format")
+	}
+	tm := millisToTime(value)
+	md := &Metadata{Version: LegacyVersion, Created: tm, Refreshed: tm}
+	if len(fields) > 1 {
+		md.Signature = fields[1]
+	}
+	return md, nil
+}
+
+// readTimestamp reads time of the last refresh stored in the file, regardless of its format.
+// For files not recording any timestamp, their modification time is returned.
+// Returns 0 if the file does not exist.
+func readTimestamp(fileName string) int64 {
+	if md, err := parseMetadata(readRecord(fileName)); err == nil && md != nil {
+		return md.timestamp()
+	}
+	return readModTime(fileName)
+}
+
+func millisToTime(value int64) time.Time {
+	return time.Unix(0, value*int64(time.Millisecond)).UTC()
+}
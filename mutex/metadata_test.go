@@ -0,0 +1,192 @@
+package mutex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	const mutexId = "metadata-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	if _, err := mx.Metadata(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong result of Metadata() for unlocked mutex: %v", err)
+	}
+	for token := uint64(1); token <= 3; token++ {
+		mx.Lock()
+		md, err := mx.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Version != MetadataVersion || md.Id != mutexId || md.Token != token {
+			t.Fatalf("wrong metadata: %+v", md)
+		}
+		if md.Holder != currentHolder() {
+			t.Fatalf("wrong holder %v instead of %v", md.Holder, currentHolder())
+		}
+		if time.Duration(md.Lease) != DefaultDeadTimeout {
+			t.Fatalf("wrong lease %v instead of %v", time.Duration(md.Lease), DefaultDeadTimeout)
+		}
+		mx.Unlock()
+	}
+}
+
+func TestMetadataFormat(t *testing.T) {
+	const mutexId = "format-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	mx.Lock()
+	defer mx.Unlock()
+	b, err := os.ReadFile(mx.LockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("lock file is not a JSON document: %v", err)
+	}
+	if _, err := time.Parse(time.RFC3339, fmt.Sprint(doc["created"])); err != nil {
+		t.Fatalf("wrong format of the creation time: %v", err)
+	}
+	if got := fmt.Sprint(doc["lease"]); got != DefaultDeadTimeout.String() {
+		t.Fatalf("wrong format of the lease: %s", got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	const mutexId = "migrate-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	f, err := os.Create(mx.LockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := writeCurrentTimestamp(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md, err := mx.Metadata(); err != nil || md.Version != LegacyVersion {
+		t.Fatalf("wrong metadata of a legacy lock: %+v (%v)", md, err)
+	}
+	if migrated, err := mx.Migrate(); err != nil || !migrated {
+		t.Fatalf("wrong result of Migrate(): %v, %v", migrated, err)
+	}
+	md, err := mx.Metadata()
+	if err != nil || md.Version != MetadataVersion || md.Id != mutexId {
+		t.Fatalf("wrong metadata of a migrated lock: %+v (%v)", md, err)
+	}
+	if got := md.timestamp(); got != want {
+		t.Fatalf("wrong timestamp %d instead of %d", got, want)
+	}
+	if migrated, err := mx.Migrate(); err != nil || migrated {
+		t.Fatalf("wrong result of repeated Migrate(): %v, %v", migrated, err)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	const mutexId = "adopt-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	first, err := NewMutex(mutexRoot, mutexId, WithOwner("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := newTestMutex(mutexRoot, mutexId)
+	if err := second.Adopt("second"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong result of Adopt() for unlocked mutex: %v", err)
+	}
+	first.Lock()
+	before, err := first.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Owner != "first" {
+		t.Fatalf("wrong owner \"%s\" instead of \"first\"", before.Owner)
+	}
+	if err := second.Adopt("second"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := second.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Owner != "second" || after.Token != before.Token || !after.Created.Equal(before.Created) {
+		t.Fatalf("wrong metadata after adoption: %+v (before: %+v)", after, before)
+	}
+	second.Unlock()
+}
+
+func TestTrace(t *testing.T) {
+	const mutexId = "trace-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	var events []Event
+	mx, err := NewMutex(mutexRoot, mutexId, WithEventHandler(func(e Event) { events = append(events, e) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	trace := mx.Trace()
+	if len(trace) != 16 {
+		t.Fatalf("wrong trace id \"%s\"", trace)
+	}
+	if md, err := mx.Metadata(); err != nil || md.Trace != trace {
+		t.Fatalf("wrong metadata %+v (%v), expected trace \"%s\"", md, err, trace)
+	}
+	mx.Unlock()
+	for _, e := range events {
+		if e.Trace != trace {
+			t.Fatalf("wrong trace of event %v instead of \"%s\"", e, trace)
+		}
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if mx.Trace() == trace {
+		t.Fatalf("trace id \"%s\" reused for another acquisition", trace)
+	}
+}
+
+type requestIdKey struct{}
+
+func TestRequestId(t *testing.T) {
+	const mutexId = "request-id-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithRequestIdKey(requestIdKey{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), requestIdKey{}, "req-42")
+	if err := mx.LockWithContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if md, err := mx.Metadata(); err != nil || md.Request != "req-42" {
+		t.Fatalf("wrong metadata %+v (%v), expected request \"%s\"", md, err, "req-42")
+	}
+	mx.Unlock()
+	mx.Lock()
+	defer mx.Unlock()
+	if md, err := mx.Metadata(); err != nil || md.Request != "" {
+		t.Fatalf("wrong metadata %+v (%v), expected no request", md, err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	const mutexId = "message-test-mutex"
+	const message = "loading warehouse, ticket OPS-123"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithMessage(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if md, err := mx.Metadata(); err != nil || md.Message != message {
+		t.Fatalf("wrong metadata %+v (%v), expected message \"%s\"", md, err, message)
+	}
+	if infos, err := List(mutexRoot, mutexId); err != nil || len(infos) != 1 || infos[0].Message != message {
+		t.Fatalf("wrong infos %+v (%v), expected message \"%s\"", infos, err, message)
+	}
+}
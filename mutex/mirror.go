@@ -0,0 +1,184 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WithMirror replicates locks of the Mutex to the same mutex under the secondary root, as a warm standby
+// in case the primary root is lost: acquisitions copy the lock with its metadata and advance the fencing
+// token counter of the mirror, releases remove the copy. Copies are not refreshed, so waiters at the mirror
+// consider them stale as usual. Replication is best-effort, done after the lock has been acquired or released;
+// failures are reported as EventMirrorFailed and divergence is fixed by Manager.Reconcile.
+// Ignored in the dot-lock and WithXattrMetadata modes.
+func WithMirror(secondaryRoot string) Option {
+	return func(m *Mutex) {
+		m.mirrorRoot = secondaryRoot
+	}
+}
+
+// mirror returns the Mutex of the mirror, if any.
+func (m *Mutex) mirror() (*Mutex, error) {
+	if m.mirrorRoot == "" || m.dotLock || m.xattrs {
+		return nil, nil
+	}
+	root, err := resolveRoot(m.mirrorRoot)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(m.root, m.directory)
+	if err != nil {
+		return nil, err
+	}
+	return m.replica(root, filepath.ToSlash(rel)), nil
+}
+
+// replica returns a Mutex under the root, configured as m, for copying locks to it.
+func (m *Mutex) replica(root string, rel string) *Mutex {
+	result := m.sibling(rel)
+	result.id, result.key, result.root, result.directory = m.id, m.key, root, path.Join(root, rel)
+	result.durable, result.fileMode, result.dirMode = m.durable, m.fileMode, m.dirMode
+	return result
+}
+
+// mirrorLock copies the just acquired lock of the Mutex to its mirror, if any. The copy is created exclusively,
+// so a lock taken at the mirror meanwhile (or a copy left by a failed release) is not overwritten.
+func (m *Mutex) mirrorLock() {
+	dst, err := m.mirror()
+	if dst == nil && err == nil {
+		return
+	}
+	if err == nil {
+		err = m.copyLockExclusive(dst)
+	}
+	if err != nil {
+		m.emit(Event{Kind: EventMirrorFailed, Path: m.mirrorRoot, Err: err})
+	}
+}
+
+// mirrorRelease removes the copy of the released lock of the Mutex from its mirror, if any.
+func (m *Mutex) mirrorRelease(trace string) {
+	dst, err := m.mirror()
+	if dst == nil && err == nil {
+		return
+	}
+	if err == nil {
+		// Only the copy of this acquisition, not a lock taken at the mirror meanwhile
+		if md, _ := dst.readMetadata(dst.LockPath()); md != nil && md.Trace == trace {
+			err = os.Remove(dst.LockPath())
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		m.emit(Event{Kind: EventMirrorFailed, Path: m.mirrorRoot, Err: err})
+	}
+}
+
+// copyLock copies the lock of the Mutex to dst, replacing the copy there, see Manager.Reconcile.
+func (m *Mutex) copyLock(dst *Mutex) error {
+	md, err := m.prepareCopy(dst)
+	if md == nil {
+		return err
+	}
+	_, err = dst.writeMetadata(dst.LockPath(), md)
+	return err
+}
+
+// copyLockExclusive copies the lock of the Mutex to dst, failing if dst is locked.
+func (m *Mutex) copyLockExclusive(dst *Mutex) error {
+	md, err := m.prepareCopy(dst)
+	if md == nil {
+		return err
+	}
+	if err := dst.createExclusive(dst.LockPath(), md); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("mirror of lock %s is locked already", m.id)
+		}
+		return err
+	}
+	return nil
+}
+
+// prepareCopy returns the metadata of the lock of the Mutex to copy to dst, creating the directory of dst
+// and advancing its token counter, if behind. Returns nil metadata, if the Mutex is not locked.
+func (m *Mutex) prepareCopy(dst *Mutex) (*Metadata, error) {
+	md, err := m.readMetadata(m.LockPath())
+	if md == nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(dst.root, dst.directory)
+	if err != nil {
+		return nil, err
+	}
+	if err := mkdirAll(dst.root, filepath.ToSlash(rel), dst.dirMode); err != nil {
+		return nil, err
+	}
+	if token, err := dst.currentToken(); err != nil {
+		return nil, err
+	} else if token < md.Token {
+		if err := dst.replaceFile(dst.tokenPath(), []byte(fmt.Sprintf("%d\n", md.Token))); err != nil {
+			return nil, err
+		}
+	}
+	return md, nil
+}
+
+// Reconcile makes locks of mutexes matching the pattern (see List) under the mirror root the same as under
+// the root of the Manager, fixing divergence left by failed replication (see WithMirror): missing or outdated
+// copies of locks are copied again, copies of released locks are removed. The mirror Manager should be
+// configured as the Manager. Returns ids of the fixed mutexes.
+func (mgr *Manager) Reconcile(pattern string, mirror *Manager) ([]string, error) {
+	ids, err := mgr.List(pattern)
+	if err != nil {
+		return nil, err
+	}
+	mirrored, err := mirror.List(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ids = union(ids, mirrored)
+	var result []string
+	for _, id := range ids {
+		// Not created with mgr.Mutex, as hashed ids are directory names already
+		src := newConfiguredMutex(mgr.opts)
+		src.id, src.key, src.root = strings.ToLower(path.Join(src.namespace, id)), id, mgr.base
+		src.directory = path.Join(mgr.base, mgr.relDir(id))
+		dst := src.replica(mirror.base, mirror.relDir(id))
+		md, err := src.readMetadata(src.LockPath())
+		if md == nil && !errors.Is(err, os.ErrNotExist) {
+			return result, fmt.Errorf("cannot reconcile mutex %s: %w", id, err)
+		}
+		copied, _ := dst.readMetadata(dst.LockPath())
+		switch {
+		case md != nil && (copied == nil || copied.Trace != md.Trace || copied.Token != md.Token):
+			err = src.copyLock(dst)
+		case md == nil && copied != nil:
+			err = os.Remove(dst.LockPath())
+		default:
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("cannot reconcile mutex %s: %w", id, err)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+// union returns sorted unique strings of both sorted slices.
+func union(a []string, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var result []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,87 @@
+package mutex
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	const mutexId = "jobs/mirror-test-mutex"
+	primary := temporaryCatalog(t)
+	secondary := temporaryCatalog(t)
+	mx, err := NewMutex(primary, mutexId, WithMirror(secondary), WithOwner("mirrored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	standby, err := NewMutex(secondary, mutexId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := standby.Metadata()
+	if err != nil || md.Owner != "mirrored" || md.Trace != mx.Trace() || md.Token != mx.token {
+		t.Fatalf("wrong mirrored metadata %+v (%v)", md, err)
+	}
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if !standby.When().IsZero() {
+		t.Fatalf("mirrored lock not released")
+	}
+
+	// A lock taken at the mirror meanwhile is not overwritten
+	if err := standby.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	standbyTrace := standby.Trace()
+	var events []Event
+	mx.events = func(e Event) { events = append(events, e) }
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	if md, err := standby.Metadata(); err != nil || md.Trace != standbyTrace {
+		t.Fatalf("lock at the mirror overwritten: %+v (%v)", md, err)
+	}
+	if len(events) != 2 || events[1].Kind != EventMirrorFailed {
+		t.Fatalf("wrong events %v instead of [acquired mirror-failed]", events)
+	}
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if md, err := standby.Metadata(); err != nil || md.Trace != standbyTrace {
+		t.Fatalf("lock at the mirror released: %+v (%v)", md, err)
+	}
+	mx.events = nil
+	if err := standby.TryUnlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Divergence left by failed replication
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if err := os.Remove(standby.LockPath()); err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := NewManager(primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror, err := NewManager(secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed, err := mgr.Reconcile(AllIds, mirror); err != nil || len(fixed) != 1 || fixed[0] != mutexId {
+		t.Fatalf("wrong value of Reconcile() => %v (%v) instead of [%s]", fixed, err, mutexId)
+	}
+	if md, err := standby.Metadata(); err != nil || md.Trace != mx.Trace() {
+		t.Fatalf("wrong reconciled metadata %+v (%v)", md, err)
+	}
+	if fixed, err := mgr.Reconcile(AllIds, mirror); err != nil || len(fixed) != 0 {
+		t.Fatalf("wrong value of Reconcile() => %v (%v) instead of []", fixed, err)
+	}
+}
@@ -6,59 +6,170 @@ package mutex
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // A Mutex is a mutual exclusion lock based on filesystem primitives.
+// It may be shared by goroutines of a process, which then acquire it one at a time.
 type Mutex struct {
-	id              string
-	directory       string
-	deadAgeRecovery time.Duration
-	pulse           time.Duration
-	refresh         time.Duration
+	id                  string
+	key                 string
+	hashedIds           bool
+	listedId            bool // The id is listed by Manager.List, so it is hashed already, see withListedId
+	lockTemplate        string
+	candidateTemplate   string
+	dirMode             os.FileMode
+	fileMode            os.FileMode
+	xattrs              bool
+	secret              []byte
+	durable             bool
+	mtime               bool
+	skewThreshold       time.Duration
+	dotLock             bool
+	flock               bool
+	flockPath           string
+	flockFile           *os.File
+	owner               string
+	events              func(Event)
+	webhook             *Webhook
+	statsd              *Statsd
+	attemptEvents       bool
+	maxPulse            time.Duration
+	anonymousCandidates bool
+	cifs                bool
+	local               chan struct{}
+	localHeld           bool
+	maxHold             time.Duration
+	maxHoldCallback     func(m *Mutex, held time.Duration)
+	holdTimer           *time.Timer
+	maxHoldRelease      time.Duration
+	maxHoldReleased     func(m *Mutex)
+	releaseTimer        *time.Timer
+	autoReleased        bool
+	releaseMx           sync.Mutex
+	stats               *statsCounter
+	held                os.FileInfo
+	acquisitionMx       sync.Mutex // Guards trace, request and token, which change with each acquisition
+	trace               string
+	token               uint64
+	reacquire           bool
+	reacquired          func(m *Mutex, oldToken uint64, newToken uint64)
+	refreshed           func(m *Mutex)
+	idempotentUnlock    bool
+	deadlockDetection   bool
+	level               int
+	requestKey          interface{}
+	namespace           string
+	labels              map[string]string
+	message             string
+	lazyInit            bool
+	uninitialized       bool // Directory not created yet, see WithLazyInit
+	fallbackRoots       []string
+	roots               []string // Resolved root and fallback roots, see WithFallbackRoots
+	mirrorRoot          string
+	stealThreshold      time.Duration
+	breakGrace          time.Duration
+	writerPreference    bool
+	probeDirectory      string
+	noRecovery          bool
+	sharded             bool
+	request             string
+	leveled             bool
+	root                string
+	directory           string
+	deadAgeRecovery     time.Duration
+	pulse               time.Duration
+	refresh             time.Duration
 }
 
+// ErrExpired is returned when a Mutex could not be locked before the locking timeout.
+var ErrExpired = errors.New("expired")
+
+// ErrNotOwner is returned by UnlockIfOwner, when the lock has a different owner.
+var ErrNotOwner = errors.New("lock has a different owner")
+
+// ErrNotLocked is returned when a Mutex being unlocked is not locked, unless WithIdempotentUnlock is used.
+var ErrNotLocked = errors.New("not locked")
+
 // DefaultPulse determines default frequency of locking attempts, i.e. defines delay between subsequent locking attempts.
 const DefaultPulse = 500 * time.Millisecond
 
 // DefaultRefresh determines default frequency of saving current timestamp in a locking file.
 const DefaultRefresh = 10 * time.Second
 
-// DefaultDeadTimeout determines how long takes to consider given mutex as "dead".
+// DefaultDeadTimeout determines how long takes to consider given mutex as "dead",
+// i.e. how long its lock file has to stay unchanged, as observed by a waiter using its local clock.
 // "Dead" mutexes are removed during locking attempts.
 const DefaultDeadTimeout = 60 * time.Minute
 
+// DefaultDirMode determines default permissions of mutex directories.
+const DefaultDirMode os.FileMode = 0700
+
+// DefaultFileMode determines default permissions of lock and candidate files.
+const DefaultFileMode os.FileMode = 0600
+
+// SharedDirMode determines permissions of mutex directories shared by users of a common group.
+const SharedDirMode = 0770 | os.ModeSetgid
+
+// SharedFileMode determines permissions of lock and candidate files shared by users of a common group.
+const SharedFileMode os.FileMode = 0660
+
 // A lockCandidateTemplate defines locking candidate file name template.
 const lockCandidateTemplate = "%s-candidate-*.tmp"
 
 // A lockTemplate defines locking file name template.
 const lockTemplate = "%s-mutex.lck"
 
-// Id return given Mutex id.
+// A replacementTemplate defines name template of temporary files used to atomically replace lock files.
+const replacementTemplate = ".%s-*.tmp"
+
+// A tokenTemplate defines name template of the file keeping the last issued fencing token of a Mutex.
+const tokenTemplate = "%s-mutex.token"
+
+// A flockTemplate defines name template of the file locked with flock in the dual locking mode, see WithFlock.
+const flockTemplate = "%s-mutex.flock"
+
+// A keyTemplate defines name template of the file recording the original key of a hashed Mutex.
+const keyTemplate = "%s-mutex.key"
+
+// hashedIdLength determines length of ids derived from hashed keys.
+const hashedIdLength = 32
+
+// A namespaceSeparator separates components of hierarchical mutex ids, like "tenantA/jobs/nightly".
+// Each component maps to a nested directory under the mutex root.
+const namespaceSeparator = "/"
+
+// Id return given Mutex id, prefixed by its namespace, if any (see WithNamespace).
 func (m *Mutex) Id() string {
 	return m.id
 }
 
-// Lock locks given Mutex. Panics in case of any error. Conforms to the sync.Locker interface.
+// Key returns the key given Mutex was created for. Unless the Mutex uses hashed ids, it is the same as Id.
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Lock locks given Mutex. Panics with a *LockError in case of any error. Conforms to the sync.Locker interface.
+// It is the same as MustLock.
 func (m *Mutex) Lock() {
-	if err := m.TryLock(0); err != nil {
-		panic(err)
-	}
+	m.MustLock()
 }
 
-// Unlock unlocks given Mutex. Panics in case of any error. Conforms to the sync.Locker interface.
+// Unlock unlocks given Mutex. Panics with a *LockError in case of any error. Conforms to the sync.Locker interface.
+// It is the same as MustUnlock.
 func (m *Mutex) Unlock() {
-	if err := m.TryUnlock(); err != nil {
-		panic(err)
-	}
+	m.MustUnlock()
 }
 
 // TryLock tries to lock given Mutex and returns error in case of failure.
@@ -75,70 +186,331 @@ func (m *Mutex) TryLock(timeout time.Duration) error {
 
 // TryUnlock unlocks given Mutex or returns error in case of failure.
 func (m *Mutex) TryUnlock() error {
-	return os.Remove(m.LockPath())
+	if err := m.checkAccess(AclRelease); err != nil {
+		return err
+	}
+	m.releaseMx.Lock()
+	if m.autoReleased {
+		m.autoReleased = false
+		m.releaseMx.Unlock()
+		return ErrAutoReleased
+	}
+	trace := m.Trace()
+	err := m.release()
+	m.releaseMx.Unlock()
+	m.released(trace, err)
+	return err
+}
+
+// UnlockIfOwner unlocks the Mutex, only if its lock has the owner (see WithOwner), so automation never
+// releases a lock another job has acquired meanwhile. Returns an error wrapping ErrNotOwner otherwise.
+// Like TryUnlock, it releases the lock held by another process as well.
+func (m *Mutex) UnlockIfOwner(owner string) error {
+	target := m.LockPath()
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return m.TryUnlock() // ErrNotLocked, unless WithIdempotentUnlock
+	} else if err != nil {
+		return err
+	}
+	md, err := m.readMetadata(target)
+	if err != nil {
+		return fmt.Errorf("cannot read owner of lock %s: %w", m.id, err)
+	}
+	if md.Owner != owner {
+		return fmt.Errorf("%w: lock %s is owned by \"%s\"", ErrNotOwner, m.id, md.Owner)
+	}
+	// Make sure the lock has not been released or replaced meanwhile
+	if current, err := os.Stat(target); err != nil || !os.SameFile(info, current) {
+		return fmt.Errorf("%w: lock %s has been released or replaced", ErrNotOwner, m.id)
+	}
+	return m.TryUnlock()
+}
+
+// release unlocks the Mutex. The caller has to hold releaseMx and call released, once it has released it.
+func (m *Mutex) release() error {
+	defer m.releaseFlock()
+	m.stopHoldWatch()
+	m.checkStolen()
+	if err := retrySharing(func() error { return removeFile(m.LockPath()) }); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if m.idempotentUnlock {
+			return nil
+		}
+		return fmt.Errorf("%w: lock %s does not exist", ErrNotLocked, m.id)
+	}
+	if err := m.syncDirectory(); err != nil {
+		return err
+	}
+	m.emit(Event{Kind: EventReleased, Path: m.LockPath()})
+	return nil
+}
+
+// released completes the release of the acquisition with the trace outside releaseMx, see release:
+// removes the copy of the lock from the mirror (see WithMirror), unless the release has failed,
+// and only then releases the process-local lock, so the next local acquisition is not mirrored meanwhile.
+func (m *Mutex) released(trace string, err error) {
+	if err == nil {
+		m.mirrorRelease(trace)
+	}
+	m.releaseLocal()
 }
 
 // LockWithContext waits indefinitely to acquire given Mutex with timeout governed by passed context
 // or returns error in case of failure.
 func (m *Mutex) LockWithContext(ctx context.Context) error {
-	candidateLock, err := ioutil.TempFile(m.directory, fmt.Sprintf(lockCandidateTemplate, m.id))
+	return m.lock(ctx, &lockAttempt{})
+}
+
+// lockOnce makes a single attempt to lock the Mutex, returning ErrExpired if it is locked by another holder.
+// The attempt keeps what has been observed of the competing lock, so a stale lock observed by repeated
+// attempts still gets broken; a challenged lock (see WithBreakGrace) is broken waiting until the context is done.
+func (m *Mutex) lockOnce(ctx context.Context, attempt *lockAttempt) error {
+	attempt.once = true
+	return m.lock(ctx, attempt)
+}
+
+// lock locks the Mutex, observing the competing lock by the attempt.
+func (m *Mutex) lock(ctx context.Context, attempt *lockAttempt) error {
+	if err := m.checkLevel(); err != nil {
+		return err
+	}
+	start := time.Now()
+	defer func() {
+		m.stats.update(func(s *Stats) { s.Wait += time.Since(start) })
+	}()
+	if err := m.acquireLocal(ctx, attempt.once); err != nil {
+		return err
+	}
+	m.acquisitionMx.Lock()
+	m.trace = newTraceId()
+	m.request = m.requestId(ctx)
+	m.acquisitionMx.Unlock()
+	if err := m.lockRoots(ctx, attempt); err != nil {
+		m.releaseLocal()
+		return err
+	}
+	m.stats.update(func(s *Stats) {
+		s.Acquisitions++
+		s.WaitTimes.observe(time.Since(start))
+	})
+	if m.statsd != nil {
+		m.statsd.Count("acquisitions", 1, "id:"+m.id)
+		m.statsd.Timing("wait", time.Since(start), "id:"+m.id)
+	}
+	m.releaseMx.Lock()
+	m.autoReleased = false
+	m.markHeld()
+	m.startHoldWatch()
+	m.releaseMx.Unlock()
+	m.emit(Event{Kind: EventAcquired, Path: m.LockPath()})
+	m.mirrorLock()
+	return nil
+}
+
+// lockRoot locks the Mutex in its current root.
+func (m *Mutex) lockRoot(ctx context.Context, attempt *lockAttempt) error {
+	if err := m.checkAccess(AclLock); err != nil {
+		return err
+	}
+	if err := m.init(); err != nil {
+		return err
+	}
+	if err := m.acquireFlock(ctx, attempt.once); err != nil {
+		return err
+	}
+	if err := m.lockFile(ctx, attempt); err != nil {
+		m.releaseFlock()
+		return err
+	}
+	return nil
+}
+
+// acquireLocal acquires the process-local lock of the Mutex, so goroutines sharing the Mutex
+// (or mutexes of the same id created by a Manager, see Manager.Mutex) compete for the lock file one at a time.
+// If once is true, it is not waited for.
+func (m *Mutex) acquireLocal(ctx context.Context, once bool) error {
+	if m.local == nil {
+		return nil
+	}
+	select {
+	case m.local <- struct{}{}:
+	default:
+		if once {
+			return ErrExpired
+		}
+		select {
+		case m.local <- struct{}{}:
+		case <-ctx.Done():
+			return ErrExpired
+		}
+	}
+	m.localHeld = true
+	return nil
+}
+
+// releaseLocal releases the process-local lock of the Mutex, if held.
+func (m *Mutex) releaseLocal() {
+	if m.localHeld {
+		m.localHeld = false
+		<-m.local
+	}
+}
+
+// A lockAttempt keeps what a waiter has observed of the competing lock of a Mutex. Locking keeps it
+// while waiting; single attempts (see lockOnce) keep it across attempts.
+type lockAttempt struct {
+	once         bool // Give up after an unsuccessful attempt (ErrExpired) instead of waiting
+	lastCheck    time.Time
+	observer     progressObserver
+	other        lockReader
+	backoff      pulseBackoff
+	skewReported bool
+}
+
+// lockFile acquires the lock file of the Mutex.
+func (m *Mutex) lockFile(ctx context.Context, attempt *lockAttempt) error {
+	candidateLock, anonymous, err := m.createCandidate()
 	if err != nil {
 		return fmt.Errorf("cannot create candidate lock %s: %w", m.id, err)
 	}
-	candidateLock.Close()
-	candidate := candidateLock.Name()
-	defer os.Remove(candidate) // clean up
+	defer func() {
+		// Closed before removal, as NFS clients silly-rename removed files, which are still open
+		candidateLock.Close()
+		if !anonymous {
+			removeIfPossible(candidateLock.Name())
+		}
+	}()
 
 	target := m.LockPath()
+	md := m.newMetadata()
+	waiting := m.deadlockDetection && holdsOther(m)
+	if waiting {
+		defer os.Remove(m.waitsForPath(currentHolder(), md.Trace))
+	}
 
 	var lastTimestamp int64 = 0
+	prober := m.newLocalProber()
+	defer prober.close(m)
 	for {
+		probe := prober.probing(m)
 		if lastTimestamp == 0 || now()-lastTimestamp > millis(m.refresh) {
-			if f, err := os.Create(candidateLock.Name()); err == nil {
-				if lastTimestamp, err = writeCurrentTimestamp(f); err != nil {
-					return fmt.Errorf("cannot write current timestamp for candidate lock %s: %w", m.id, err)
+			probe = true
+			if lastTimestamp, err = m.writeCandidate(candidateLock, md); err != nil {
+				return fmt.Errorf("cannot write current timestamp for candidate lock %s: %w", m.id, err)
+			}
+			// Checked roughly once per refresh of the holder, as the lock cannot change more often
+			if m.deadAgeRecovery >= 0 && (attempt.lastCheck.IsZero() ||
+				time.Since(attempt.lastCheck) >= attempt.other.refresh(m)) {
+				attempt.lastCheck = time.Now()
+				otherTimestamp, err := attempt.other.timestamp(m, target)
+				if err != nil {
+					m.emit(Event{Kind: EventInvalidSignature, Path: target, Err: err})
+				} else if skewErr := m.clockSkew(otherTimestamp); skewErr != nil && !attempt.skewReported {
+					attempt.skewReported = true
+					m.emit(Event{Kind: EventClockSkew, Path: target, Err: skewErr})
+				}
+				dead := (err != nil && !m.unpublished(&attempt.other)) || m.holderDead(attempt.other.md) ||
+					m.tooOld(attempt.other.md)
+				stale := dead || attempt.observer.stale(otherTimestamp, attempt.other.staleLimit(m))
+				if m.attemptEvents && otherTimestamp != 0 {
+					m.emitStaleCheck(target, attempt.other.md, &attempt.observer, stale)
+				}
+				if stale && m.noRecovery {
+					return m.staleFound(target, attempt.other.md)
+				}
+				if stale {
+					m.breakStale(ctx, target, &attempt.other, otherTimestamp, !dead)
+					time.Sleep(m.pulse * 2)
 				}
 			}
-			if m.deadAgeRecovery >= 0 {
-				if otherTimestamp := readTimestamp(target); otherTimestamp > 0 {
-					if now()-otherTimestamp > millis(m.deadAgeRecovery) {
-						os.Remove(target)
-						time.Sleep(m.pulse * 2)
-					}
+			if waiting {
+				if err := m.checkDeadlock(md.Trace); err != nil {
+					return err
 				}
 			}
 		}
-		if err := os.Link(candidate, target); err == nil {
-			if now()-lastTimestamp > millis(m.refresh) {
-				if f, err := os.Create(target); err == nil {
-					_, err = writeCurrentTimestamp(f)
-				}
-				if err != nil {
-					return fmt.Errorf("cannot write current timestamp for target lock %s: %w", m.id, err)
-				}
+		if !probe {
+			// Another local waiter probes the lock, see WithLocalProbing
+			if attempt.once || sleepOrDone(ctx, m.pulse) {
+				return ErrExpired
 			}
+			continue
+		}
+		m.stats.update(func(s *Stats) { s.Attempts++ })
+		if m.claimLock(candidateLock, anonymous, target, md) {
+			if err := m.syncDirectory(); err != nil {
+				os.Remove(target)
+				return fmt.Errorf("cannot sync directory of lock %s: %w", m.id, err)
+			}
+			if md.Token, err = m.nextToken(); err != nil {
+				os.Remove(target)
+				return fmt.Errorf("cannot issue token for lock %s: %w", m.id, err)
+			}
+			md.Created = time.Now().UTC()
+			if _, err := m.writeMetadata(target, md); err != nil {
+				return fmt.Errorf("cannot write current timestamp for target lock %s: %w", m.id, err)
+			}
+			m.setAcquisition(md.Trace, md.Token)
 			return nil
 		}
-		if sleepOrDone(ctx, m.pulse) {
-			return errors.New("expired")
+		if attempt.once {
+			return ErrExpired
+		}
+		delay := attempt.backoff.next(m, target, &attempt.other)
+		if m.attemptEvents {
+			m.emit(Event{Kind: EventAttempt, Path: target, Info: fmt.Sprintf("lock busy, next attempt in %v", delay)})
+		}
+		if sleepOrDone(ctx, delay) {
+			return ErrExpired
 		}
 	}
 }
 
-func NewMutex(root string, lockId string) (*Mutex, error) {
-	return NewMutexExt(root, lockId, DefaultPulse, DefaultRefresh, DefaultDeadTimeout)
+// emitStaleCheck reports EventStaleCheck with details of the competing lock.
+func (m *Mutex) emitStaleCheck(target string, md *Metadata, observer *progressObserver, stale bool) {
+	info := fmt.Sprintf("unchanged for %v", time.Since(observer.since).Round(time.Millisecond))
+	if md != nil {
+		info = fmt.Sprintf("held by %s for %v, %s", md.Holder, time.Since(md.Created).Round(time.Millisecond), info)
+	}
+	m.emit(Event{Kind: EventStaleCheck, Path: target, Info: fmt.Sprintf("%s, stale: %v", info, stale)})
 }
 
-func NewMutexExt(root string, lockId string, pulse time.Duration, refresh time.Duration, deadTimeout time.Duration) (*Mutex, error) {
-	if !filepath.IsAbs(root) {
-		var err error
-		if root, err = filepath.Abs(root); err != nil {
-			return nil, err
-		}
+func NewMutex(root string, lockId string, opts ...Option) (*Mutex, error) {
+	return NewMutexExt(root, lockId, DefaultPulse, DefaultRefresh, DefaultDeadTimeout, opts...)
+}
+
+// NewMutexForKey creates a Mutex for an arbitrary key (URL, file path, UTF-8 name),
+// hashing it into a filesystem-safe id. See WithHashedIds.
+func NewMutexForKey(root string, key string, opts ...Option) (*Mutex, error) {
+	return NewMutex(root, key, append(opts, WithHashedIds())...)
+}
+
+// NewMutexForPath creates a Mutex guarding the file or directory at targetPath, with an id derived
+// from a hash of the target's absolute, cleaned path (with symbolic links resolved, if it exists),
+// so different spellings of the same path share the Mutex. See NewMutexForKey.
+func NewMutexForPath(root string, targetPath string, opts ...Option) (*Mutex, error) {
+	key, err := filepath.Abs(targetPath)
+	if err != nil {
+		return nil, err
 	}
-	dir := path.Join(root, lockId)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, fmt.Errorf("cannot create directory (%s): %w", root, err)
+	if resolved, err := evalSymlinks(key); err == nil {
+		key = resolved
+	}
+	return NewMutexForKey(root, key, opts...)
+}
+
+// NewMutexExt creates a Mutex with given pulse (delay between locking attempts), refresh period and dead timeout
+// (how long the lock of another holder has to stay unchanged to be broken as stale, see DefaultDeadTimeout).
+// A non-positive pulse or refresh stands for its default. A negative dead timeout disables checks for staleness,
+// so stale locks are neither broken nor reported, see WithNoRecovery for the latter.
+func NewMutexExt(root string, lockId string, pulse time.Duration, refresh time.Duration, deadTimeout time.Duration,
+	opts ...Option) (*Mutex, error) {
+	root, err := resolveRoot(root)
+	if err != nil {
+		return nil, err
 	}
 	if pulse <= 0 {
 		pulse = DefaultPulse
@@ -146,28 +518,224 @@ func NewMutexExt(root string, lockId string, pulse time.Duration, refresh time.D
 	if refresh <= 0 {
 		refresh = DefaultRefresh
 	}
-	return &Mutex{
-		id:              strings.ToLower(lockId),
-		directory:       dir,
-		deadAgeRecovery: deadTimeout,
-		pulse:           pulse,
-		refresh:         refresh,
-	}, nil
+	m := newConfiguredMutex(opts)
+	m.key = lockId
+	m.deadAgeRecovery = deadTimeout
+	m.pulse = pulse
+	m.refresh = refresh
+	if m.hashedIds && !m.listedId {
+		lockId = hashKey(lockId)
+	} else {
+		lockId = strings.Trim(lockId, namespaceSeparator)
+	}
+	if m.namespace != "" {
+		lockId = m.namespace + namespaceSeparator + lockId
+	}
+	if m.cifs {
+		lockId = strings.ToLower(lockId)
+	}
+	if err := validateId(lockId); err != nil {
+		return nil, err
+	}
+	if m.cifs || windowsNames {
+		if err := validateWindowsId(lockId); err != nil {
+			return nil, err
+		}
+	}
+	m.id = strings.ToLower(lockId)
+	m.root = root
+	m.directory = path.Join(root, m.idPath(lockId))
+	if err := checkContained(root, m.directory); err != nil {
+		return nil, err
+	}
+	if err := checkPathLength(m); err != nil {
+		return nil, err
+	}
+	if m.hashedIds && m.listedId {
+		if b, err := ioutil.ReadFile(m.keyPath()); err == nil {
+			m.key = strings.TrimSpace(string(b))
+		}
+	}
+	m.uninitialized = true
+	if err := m.resolveRoots(root); err != nil {
+		return nil, err
+	}
+	if !m.lazyInit {
+		// With fallback roots, a failure is retried in another root when locking
+		if err := m.init(); err != nil && len(m.roots) == 0 {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// init creates the directory of the Mutex and records its key, if hashed, unless done already.
+// Fails with an error wrapping ErrReadOnlyRoot, if the directory cannot be written to.
+func (m *Mutex) init() error {
+	if !m.uninitialized {
+		return nil
+	}
+	rel, err := filepath.Rel(m.root, m.directory)
+	if err != nil {
+		return err
+	}
+	if err := mkdirAll(m.root, filepath.ToSlash(rel), m.dirMode); err != nil {
+		if readOnly(err) {
+			return fmt.Errorf("%w: cannot create directory (%s): %v", ErrReadOnlyRoot, m.root, err)
+		}
+		return fmt.Errorf("cannot create directory (%s): %w", m.root, err)
+	}
+	if err := checkWritable(m.directory); err != nil {
+		return fmt.Errorf("%w: cannot write to directory (%s): %v", ErrReadOnlyRoot, m.directory, err)
+	}
+	if m.hashedIds && !m.listedId {
+		if err := m.writeKey(); err != nil {
+			return fmt.Errorf("cannot record key of mutex %s: %w", m.id, err)
+		}
+	}
+	m.uninitialized = false
+	return nil
+}
+
+// newConfiguredMutex returns a Mutex with default file naming, to which passed options are applied.
+func newConfiguredMutex(opts []Option) *Mutex {
+	m := &Mutex{
+		lockTemplate:      lockTemplate,
+		candidateTemplate: lockCandidateTemplate,
+		skewThreshold:     DefaultClockSkewThreshold,
+		dirMode:           DefaultDirMode,
+		fileMode:          DefaultFileMode,
+		stats:             &statsCounter{},
+		local:             make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Trace returns the identifier of the current (or the last) acquisition of the Mutex.
+// It is recorded in candidate and lock metadata and reported in events, so a single acquisition
+// can be correlated across logs of the waiter, the holder and observers.
+func (m *Mutex) Trace() string {
+	m.acquisitionMx.Lock()
+	defer m.acquisitionMx.Unlock()
+	return m.trace
+}
+
+// acquisition returns the trace and the fencing token of the current (or the last) acquisition of the Mutex.
+func (m *Mutex) acquisition() (string, uint64) {
+	m.acquisitionMx.Lock()
+	defer m.acquisitionMx.Unlock()
+	return m.trace, m.token
+}
+
+// setAcquisition records the trace and the fencing token of the lock held by the Mutex.
+func (m *Mutex) setAcquisition(trace string, token uint64) {
+	m.acquisitionMx.Lock()
+	defer m.acquisitionMx.Unlock()
+	m.trace, m.token = trace, token
+}
+
+// newTraceId returns a random identifier of an acquisition.
+func newTraceId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// candidatePattern returns the name pattern of a candidate file of the current process,
+// identifying its host and PID like "<id>-candidate-<host>-<pid>-*.tmp".
+func (m *Mutex) candidatePattern() string {
+	pattern := expandTemplate(m.candidateTemplate, m.name())
+	host, _ := os.Hostname()
+	tag := fmt.Sprintf("%s-%d-", strings.NewReplacer("/", "_", "*", "_").Replace(host), os.Getpid())
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		return pattern[:i] + tag + pattern[i:]
+	}
+	return pattern + tag
 }
 
 // LockPath returns the path of the lock file
 func (m *Mutex) LockPath() string {
-	return path.Join(m.directory, fmt.Sprintf(lockTemplate, m.id))
+	return path.Join(m.directory, expandTemplate(m.lockTemplate, m.name()))
 }
 
 // When returns time of when a given mutex has been created or "zero time" if mutext is in unlocked state
 func (m *Mutex) When() time.Time {
-	if tm := readTimestamp(m.LockPath()); tm != 0 {
-		return time.Unix(0, tm*int64(time.Millisecond))
+	if md, err := m.readMetadata(m.LockPath()); md != nil && (err == nil || errors.Is(err, ErrInvalidSignature)) {
+		return md.Created.Local()
 	}
 	return time.Time{}
 }
 
+// name returns the last component of a (possibly hierarchical) Mutex id, used to name its files.
+func (m *Mutex) name() string {
+	return path.Base(m.id)
+}
+
+// keyPath returns the path of the file recording the original key of a hashed Mutex.
+func (m *Mutex) keyPath() string {
+	return path.Join(m.directory, fmt.Sprintf(keyTemplate, m.name()))
+}
+
+func (m *Mutex) writeKey() error {
+	if _, err := os.Stat(m.keyPath()); err == nil {
+		return nil
+	}
+	if err := ioutil.WriteFile(m.keyPath(), []byte(m.key+"\n"), m.fileMode); err != nil {
+		return err
+	}
+	return os.Chmod(m.keyPath(), m.fileMode)
+}
+
+// mkdirAll creates the directory rel (with all its parents) under root.
+// Directories created by the call get exactly the mode permissions, regardless of umask.
+func mkdirAll(root string, rel string, mode os.FileMode) error {
+	if err := os.MkdirAll(root, mode); err != nil {
+		return err
+	}
+	dir := root
+	for _, component := range strings.Split(rel, namespaceSeparator) {
+		dir = path.Join(dir, component)
+		if err := os.Mkdir(dir, mode); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandTemplate builds a file name from the template, replacing "%s" with the mutex name.
+// Templates without "%s" are used literally.
+func expandTemplate(template string, name string) string {
+	if strings.Contains(template, "%s") {
+		return fmt.Sprintf(template, name)
+	}
+	return template
+}
+
+// removeIfPossible removes the file, tolerating it is already gone
+// or cannot be removed because of insufficient permissions (e.g. it belongs to another user).
+func removeIfPossible(fileName string) error {
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:hashedIdLength]
+}
+
 func sleepOrDone(ctx context.Context, delay time.Duration) bool {
 	select {
 	case <-ctx.Done():
@@ -189,15 +757,51 @@ func now() int64 {
 	return nano2Millis(time.Now().UnixNano())
 }
 
-func readTimestamp(fileName string) int64 {
-	if b, err := ioutil.ReadFile(fileName); err == nil {
-		if value, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err == nil {
-			return value
-		}
+// readModTime returns modification time of the file or 0 if the file does not exist.
+func readModTime(fileName string) int64 {
+	if info, err := os.Stat(fileName); err == nil {
+		return nano2Millis(info.ModTime().UnixNano())
 	}
 	return 0
 }
 
+// replaceFile atomically replaces contents of the file: the data is written to a temporary file,
+// which is then renamed over the original, so concurrent readers never see partially written data.
+func (m *Mutex) replaceFile(fileName string, data []byte) error {
+	return m.replaceFileIf(fileName, data, nil)
+}
+
+// replaceFileIf replaces contents of the file like replaceFile, if the check (unless nil) passes right
+// before the rename, so the file replaced is the one checked, save for a very short window.
+func (m *Mutex) replaceFileIf(fileName string, data []byte, check func() error) error {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), fmt.Sprintf(replacementTemplate, filepath.Base(fileName)))
+	if err != nil {
+		return err
+	}
+	defer removeIfPossible(f.Name())
+	_, err = f.Write(data)
+	if err == nil && m.durable {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), m.fileMode)
+	}
+	if err == nil && check != nil {
+		err = check()
+	}
+	if err == nil {
+		err = retrySharing(func() error { return os.Rename(f.Name(), fileName) })
+	}
+	if err != nil {
+		return err
+	}
+	return m.syncDirectory()
+}
+
+// writeCurrentTimestamp writes current timestamp to the file in the legacy format.
 func writeCurrentTimestamp(f *os.File) (int64, error) {
 	defer f.Close()
 	timestamp := now()
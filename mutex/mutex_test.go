@@ -1,11 +1,13 @@
 package mutex
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -43,7 +45,7 @@ func TestSimpleMutex(t *testing.T) {
 		defer mx.Unlock()
 		want := 33
 		if *v != want {
-			t.Fatalf("wrong value %d instead of %d", *v, want)
+			t.Errorf("wrong value %d instead of %d", *v, want)
 		}
 	}(&value)
 	value = 33
@@ -68,7 +70,8 @@ func TestSimpleMutexN(t *testing.T) {
 			defer wg.Done()
 			lmx, err := NewMutex(mutexRoot, mutexId)
 			if err != nil {
-				t.Fatalf("cannot create the mutex: %v", err)
+				t.Errorf("cannot create the mutex: %v", err)
+				return
 			}
 			lmx.Lock()
 			defer lmx.Unlock()
@@ -153,13 +156,18 @@ func TestTry2(t *testing.T) {
 	mutexRoot := temporaryCatalog(t)
 	mx1 := newTestMutex(mutexRoot, mutexId)
 	mx1.Lock()
+	released := make(chan struct{})
 	go func() {
+		defer close(released)
 		defer mx1.Unlock()
 		time.Sleep(3 * time.Second)
 	}()
+	// Unlocking a lock, which does not exist, fails with ErrNotLocked, so mx2 does not unlock
+	// what it has not locked, and mx1 is unlocked before its directory is removed with the catalog
+	defer func() { <-released }()
 	mx2 := newTestMutex(mutexRoot, mutexId)
-	defer mx2.Unlock()
 	if err := mx2.TryLock(1 * time.Second); err == nil {
+		mx2.Unlock()
 		t.Fatal("TryLock succeed but should failed.")
 	}
 }
@@ -202,3 +210,381 @@ func TestMutexRoot(t *testing.T) {
 		}
 	}
 }
+
+func TestHashedIds(t *testing.T) {
+	const mutexKey = "https://example.com/Some Resource/ĄĘ"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexForKey(mutexRoot, mutexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mx.Key(); got != mutexKey {
+		t.Fatalf("wrong key \"%s\" instead of \"%s\"", got, mutexKey)
+	}
+	if got := mx.Id(); len(got) != hashedIdLength || strings.ContainsAny(got, "/: ") {
+		t.Fatalf("wrong hashed id \"%s\"", got)
+	}
+	if got := filepath.Dir(mx.LockPath()); got != filepath.Join(mutexRoot, mx.Id()) {
+		t.Fatalf("wrong lock directory \"%s\"", got)
+	}
+	if b, err := os.ReadFile(mx.keyPath()); err != nil {
+		t.Fatalf("cannot read the key file: %v", err)
+	} else if got := strings.TrimSpace(string(b)); got != mutexKey {
+		t.Fatalf("wrong recorded key \"%s\" instead of \"%s\"", got, mutexKey)
+	}
+	mx.Lock()
+	mx.Unlock()
+}
+
+func TestFileNaming(t *testing.T) {
+	const mutexId = "naming-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	opts := []Option{WithLockFileName("%s.lock"), WithCandidatePattern("waiting-*.%s")}
+	mx, err := NewMutex(mutexRoot, mutexId, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(mutexRoot, mutexId, mutexId+".lock")
+	if got := mx.LockPath(); got != want {
+		t.Fatalf("wrong value \"%s\" instead of \"%s\"", got, want)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("missing lock file: %v", err)
+	}
+	mgr, err := NewManager(mutexRoot, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := mgr.List(AllIds); err != nil || len(ids) != 1 || ids[0] != mutexId {
+		t.Fatalf("wrong result of List(): %v (%v)", ids, err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	const mutexId = "perm-test/mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithDirMode(0770), WithFileMode(0660))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	cases := []struct {
+		path string
+		want os.FileMode
+	}{
+		{filepath.Join(mutexRoot, "perm-test"), 0770},
+		{filepath.Join(mutexRoot, mutexId), 0770},
+		{mx.LockPath(), 0660},
+	}
+	for _, c := range cases {
+		if info, err := os.Stat(c.path); err != nil {
+			t.Fatal(err)
+		} else if got := info.Mode().Perm(); got != c.want {
+			t.Fatalf("wrong permissions of %s: %#o instead of %#o", c.path, got, c.want)
+		}
+	}
+}
+
+func TestSharedAccess(t *testing.T) {
+	const mutexId = "shared-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithSharedAccess())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if info, err := os.Stat(filepath.Join(mutexRoot, mutexId)); err != nil {
+		t.Fatal(err)
+	} else if got := info.Mode() & (os.ModePerm | os.ModeSetgid); got != SharedDirMode {
+		t.Fatalf("wrong directory mode: %v instead of %v", got, SharedDirMode)
+	}
+	if info, err := os.Stat(mx.LockPath()); err != nil {
+		t.Fatal(err)
+	} else if got := info.Mode().Perm(); got != SharedFileMode {
+		t.Fatalf("wrong lock file mode: %v instead of %v", got, SharedFileMode)
+	}
+}
+
+func TestXattrMetadata(t *testing.T) {
+	const mutexId = "xattr-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithXattrMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Skipf("extended attributes not available: %v", err)
+	}
+	defer mx.Unlock()
+	if info, err := os.Stat(mx.LockPath()); err != nil {
+		t.Fatal(err)
+	} else if info.Size() != 0 {
+		t.Fatalf("lock file should be empty, but has %d bytes", info.Size())
+	}
+	if mx.When().IsZero() {
+		t.Fatal("mutex should be locked")
+	}
+}
+
+func TestDurableWrites(t *testing.T) {
+	const mutexId = "durable-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithDurableWrites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	if mx.When().IsZero() {
+		t.Fatal("mutex should be locked")
+	}
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatalf("TryUnlock failed (%v), but should succeed.", err)
+	}
+}
+
+func TestAtomicTimestamp(t *testing.T) {
+	const mutexId = "atomic-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	if _, err := mx.writeMetadata(mx.LockPath(), mx.newMetadata()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if _, err := mx.writeMetadata(mx.LockPath(), mx.newMetadata()); err != nil {
+				t.Errorf("cannot write the timestamp: %v", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			if readTimestamp(mx.LockPath()) == 0 {
+				<-done
+				t.Fatal("torn timestamp read")
+			}
+		}
+	}
+}
+
+func TestMtimeFreshness(t *testing.T) {
+	const mutexId = "mtime-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 50*time.Millisecond, 200*time.Millisecond,
+		WithMtimeFreshness())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A lock "touched" by a foreign holder
+	if err := os.WriteFile(mx.LockPath(), []byte("garbage\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(100 * time.Millisecond); err == nil {
+		t.Fatal("TryLock succeed but should failed.")
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(mx.LockPath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got := mx.When(); !got.Equal(old.Truncate(time.Millisecond)) {
+		t.Fatalf("wrong value %v instead of %v", got, old)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if got := mx.When(); time.Since(got) > 200*time.Millisecond {
+		t.Fatalf("lock should be refreshed, but its time is %v", got)
+	}
+}
+
+func TestMutexForPath(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	dataDir := temporaryCatalog(t)
+	if err := os.Mkdir(filepath.Join(dataDir, "exports"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dataDir, "exports"), filepath.Join(dataDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range []string{
+		filepath.Join(dataDir, "exports", "today"),
+		filepath.Join(dataDir, "exports", "..", "exports", "today"),
+		filepath.Join(dataDir, "exports") + "/",
+	} {
+		mx, err := NewMutexForPath(mutexRoot, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, mx.Id())
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("different ids for the same path: %s, %s", ids[0], ids[1])
+	}
+	if ids[0] == ids[2] {
+		t.Fatalf("the same id for different paths: %s", ids[0])
+	}
+	linked, err := NewMutexForPath(mutexRoot, filepath.Join(dataDir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.Id() != ids[2] {
+		t.Fatalf("different ids for a path and its symbolic link: %s, %s", linked.Id(), ids[2])
+	}
+}
+
+func TestCandidatePattern(t *testing.T) {
+	mx := newTestMutex(temporaryCatalog(t), "candidate-test")
+	host, _ := os.Hostname()
+	expected := fmt.Sprintf("candidate-test-candidate-%s-%d-*.tmp", host, os.Getpid())
+	if pattern := mx.candidatePattern(); pattern != expected {
+		t.Fatalf("wrong candidate pattern \"%s\" instead of \"%s\"", pattern, expected)
+	}
+}
+
+func TestAttemptEvents(t *testing.T) {
+	const mutexId = "attempt-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder := newTestMutex(mutexRoot, mutexId)
+	holder.Lock()
+	defer holder.Unlock()
+	kinds := make(map[EventKind]int)
+	var info string
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithAttemptEvents(), WithEventHandler(func(e Event) {
+			kinds[e.Kind]++
+			if e.Kind == EventStaleCheck {
+				info = e.Info
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(50 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	if kinds[EventAttempt] < 2 {
+		t.Fatalf("wrong number of attempt events %d", kinds[EventAttempt])
+	}
+	if kinds[EventStaleCheck] != 1 || !strings.Contains(info, currentHolder().String()) ||
+		!strings.HasSuffix(info, "stale: false") {
+		t.Fatalf("wrong stale check events %d: \"%s\"", kinds[EventStaleCheck], info)
+	}
+}
+
+func TestCandidateRewrittenInPlace(t *testing.T) {
+	const mutexId = "in-place-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder := newTestMutex(mutexRoot, mutexId)
+	holder.Lock()
+	defer holder.Unlock()
+	mx, err := NewMutexExt(mutexRoot, mutexId, 5*time.Millisecond, 10*time.Millisecond, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := mx.TryLock(100 * time.Millisecond); err != ErrExpired {
+			t.Errorf("wrong result %v instead of ErrExpired", err)
+		}
+	}()
+	var first os.FileInfo
+	refreshed := false
+	pattern := filepath.Join(mutexRoot, mutexId, candidatesDirectory, "*-candidate-*.tmp")
+	for i := 0; i < 8; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if matches, _ := filepath.Glob(pattern); len(matches) == 1 {
+			if info, err := os.Stat(matches[0]); err != nil {
+				continue
+			} else if first == nil {
+				first = info
+			} else if !os.SameFile(first, info) {
+				t.Errorf("candidate file %s replaced during refresh", matches[0])
+			} else if !info.ModTime().Equal(first.ModTime()) {
+				refreshed = true
+			}
+		}
+	}
+	<-done
+	if !refreshed {
+		t.Fatal("candidate file not refreshed")
+	}
+}
+
+func TestCandidateDirectory(t *testing.T) {
+	const mutexId = "candidate-dir-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder := newTestMutex(mutexRoot, mutexId)
+	holder.Lock()
+	defer holder.Unlock()
+	mx := newTestMutex(mutexRoot, mutexId)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mx.TryLock(200 * time.Millisecond)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if matches, _ := filepath.Glob(filepath.Join(mutexRoot, mutexId, candidatesDirectory, "*-candidate-*.tmp")); len(matches) != 1 {
+		t.Errorf("wrong candidate files %v in the candidates directory", matches)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(mutexRoot, mutexId, "*-candidate-*.tmp")); len(matches) != 0 {
+		t.Errorf("unexpected candidate files %v in the mutex directory", matches)
+	}
+	<-done
+}
+
+func TestUnlockNotLocked(t *testing.T) {
+	const mutexId = "not-locked-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	mx.Lock()
+	mx.Unlock()
+	if err := mx.TryUnlock(); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("wrong result of TryUnlock(): %v instead of %v", err, ErrNotLocked)
+	}
+	mx, err := NewMutex(mutexRoot, mutexId, WithIdempotentUnlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	mx.Unlock()
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatalf("wrong result of idempotent TryUnlock(): %v", err)
+	}
+}
+
+func TestUnlockIfOwner(t *testing.T) {
+	const mutexId = "if-owner-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithOwner("nightly-etl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	other := newTestMutex(mutexRoot, mutexId)
+	if err := other.UnlockIfOwner("hourly-etl"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("wrong result of UnlockIfOwner(): %v instead of %v", err, ErrNotOwner)
+	}
+	if mx.When().IsZero() {
+		t.Fatal("lock of another owner has been released")
+	}
+	if err := other.UnlockIfOwner("nightly-etl"); err != nil {
+		t.Fatalf("UnlockIfOwner failed (%v), but should succeed.", err)
+	}
+	if err := other.UnlockIfOwner("nightly-etl"); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("wrong result of UnlockIfOwner(): %v instead of %v", err, ErrNotLocked)
+	}
+}
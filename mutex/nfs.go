@@ -0,0 +1,33 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// NFS clients remove a file, which is still open on the client, by renaming it to ".nfsXXXX" (so called
+// silly rename); the file is removed once closed. Such files never match names of lock or candidate
+// files, but show through errors: removing a file still open on another client may fail with EBUSY,
+// and accessing a file removed by another client fails with ESTALE.
+
+// nfsBusy reports whether the file cannot be removed, as it is still open on an NFS client (EBUSY).
+// The file is removed by NFS, once closed.
+func nfsBusy(err error) bool {
+	return errors.Is(err, syscall.EBUSY)
+}
+
+// nfsGone reports whether the file has been removed by another NFS client, while being accessed (ESTALE).
+func nfsGone(err error) bool {
+	return errors.Is(err, syscall.ESTALE)
+}
+
+// removeFile removes the file like os.Remove, except a file removed by another NFS client meanwhile
+// is reported as nonexistent.
+func removeFile(fileName string) error {
+	err := os.Remove(fileName)
+	if nfsGone(err) {
+		return &os.PathError{Op: "remove", Path: fileName, Err: os.ErrNotExist}
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package mutex
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSillyRenamed(t *testing.T) {
+	const mutexId = "nfs-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := mgr.Mutex(mutexId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.init(); err != nil {
+		t.Fatal(err)
+	}
+	// Lock and candidate files removed while still open on an NFS client
+	for _, dir := range []string{filepath.Dir(mx.LockPath()), mx.candidateDirectory()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".nfs000000000001a2b300000001"), []byte("1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids, err := mgr.List(AllIds); err != nil || len(ids) != 0 {
+		t.Fatalf("wrong result of List(): %v (%v)", ids, err)
+	}
+	if waiters, err := mx.Waiters(); err != nil || waiters != 0 {
+		t.Fatalf("wrong result of Waiters(): %d (%v)", waiters, err)
+	}
+	if removed, err := mgr.Sweep(AllIds, time.Nanosecond); err != nil || len(removed) != 0 {
+		t.Fatalf("wrong result of Sweep(): %v (%v)", removed, err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if ids, err := mgr.List(AllIds); err != nil || len(ids) != 1 || ids[0] != mutexId {
+		t.Fatalf("wrong result of List(): %v (%v)", ids, err)
+	}
+}
+
+func TestNfsErrors(t *testing.T) {
+	stale := &os.PathError{Op: "read", Path: "lock", Err: syscall.ESTALE}
+	busy := &os.PathError{Op: "remove", Path: ".nfs000000000001a2b300000001", Err: syscall.EBUSY}
+	if !nfsGone(stale) || nfsGone(busy) || nfsGone(nil) {
+		t.Fatal("wrong result of nfsGone()")
+	}
+	if !nfsBusy(busy) || nfsBusy(stale) || nfsBusy(nil) {
+		t.Fatal("wrong result of nfsBusy()")
+	}
+	if err := removeFile(filepath.Join(temporaryCatalog(t), "missing")); !os.IsNotExist(err) {
+		t.Fatalf("wrong result of removeFile(): %v", err)
+	}
+}
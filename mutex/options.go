@@ -0,0 +1,197 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// An Option configures optional behaviour of a Mutex created by NewMutex or NewMutexExt.
+type Option func(m *Mutex)
+
+// WithHashedIds makes the Mutex derive its id from a hash of the passed key,
+// so arbitrary strings (URLs, file paths, UTF-8 names) can be used as mutex keys.
+// The original key is recorded next to the lock file and is available via Key.
+func WithHashedIds() Option {
+	return func(m *Mutex) {
+		m.hashedIds = true
+	}
+}
+
+// WithLockFileName sets the name template of the lock file, e.g. "%s.lock".
+// The "%s" placeholder is replaced by the last component of the mutex id;
+// a template without the placeholder is used literally.
+func WithLockFileName(template string) Option {
+	return func(m *Mutex) {
+		m.lockTemplate = template
+	}
+}
+
+// WithCandidatePattern sets the name pattern of locking candidate files, e.g. "%s.*.candidate".
+// The "%s" placeholder is replaced by the last component of the mutex id,
+// the last "*" is replaced by a random string (see ioutil.TempFile).
+func WithCandidatePattern(pattern string) Option {
+	return func(m *Mutex) {
+		m.candidateTemplate = pattern
+	}
+}
+
+// WithDirMode sets permissions of directories created for the mutex (DefaultDirMode by default).
+// Use e.g. 0770 to share mutexes between users of a common group. Besides permission bits,
+// only os.ModeSetgid is honoured.
+func WithDirMode(mode os.FileMode) Option {
+	return func(m *Mutex) {
+		m.dirMode = mode & (os.ModePerm | os.ModeSetgid)
+	}
+}
+
+// WithFileMode sets permissions of lock and candidate files (DefaultFileMode by default).
+func WithFileMode(mode os.FileMode) Option {
+	return func(m *Mutex) {
+		m.fileMode = mode.Perm()
+	}
+}
+
+// WithSharedAccess configures the mutex to be shared by different UNIX users of a common group:
+// directories are created group-writable with the setgid bit set (so files inherit the directory's group),
+// lock and candidate files are group-writable.
+func WithSharedAccess() Option {
+	return func(m *Mutex) {
+		m.dirMode = SharedDirMode
+		m.fileMode = SharedFileMode
+	}
+}
+
+// WithXattrMetadata makes the Mutex keep its timestamp in an extended attribute of the lock file
+// rather than in the file contents, leaving lock files empty. Supported on Linux only,
+// on other platforms locking fails with ErrXattrUnsupported.
+// Readers recognize both forms regardless of the option.
+func WithXattrMetadata() Option {
+	return func(m *Mutex) {
+		m.xattrs = true
+	}
+}
+
+// WithSecret makes the Mutex sign timestamps it writes with HMAC based on the secret key
+// and verify signatures of timestamps written by other holders. Lock files with missing
+// or invalid signatures are treated as stale and reported as EventInvalidSignature.
+// All processes sharing the mutex have to use the same secret.
+func WithSecret(key []byte) Option {
+	return func(m *Mutex) {
+		m.secret = key
+	}
+}
+
+// WithEventHandler sets a function called synchronously for every Event reported by the Mutex.
+func WithEventHandler(handler func(Event)) Option {
+	return func(m *Mutex) {
+		m.events = handler
+	}
+}
+
+// WithAttemptEvents makes the Mutex report EventAttempt after each unsuccessful locking attempt
+// and EventStaleCheck with details of the competing lock, whenever it is checked for staleness.
+// Useful for tracing, but it costs an additional read of the competing lock per check.
+func WithAttemptEvents() Option {
+	return func(m *Mutex) {
+		m.attemptEvents = true
+	}
+}
+
+// WithDurableWrites makes the Mutex fsync lock files after writing them and the mutex directory
+// after creating or removing the lock, so the lock state survives a power failure.
+func WithDurableWrites() Option {
+	return func(m *Mutex) {
+		m.durable = true
+	}
+}
+
+// WithMtimeFreshness makes the Mutex judge freshness of locks by modification time of lock files
+// rather than by their contents, and refresh its own locks by updating their modification time.
+// It lets non-Go holders refresh locks with a simple touch. Signatures (see WithSecret)
+// are not verified in this mode.
+func WithMtimeFreshness() Option {
+	return func(m *Mutex) {
+		m.mtime = true
+	}
+}
+
+// WithClockSkewThreshold sets how far in the future a lock timestamp may be before it is reported
+// as EventClockSkew (DefaultClockSkewThreshold by default). Zero disables the detection.
+func WithClockSkewThreshold(threshold time.Duration) Option {
+	return func(m *Mutex) {
+		m.skewThreshold = threshold
+	}
+}
+
+// WithFlock makes the Mutex additionally hold an OS advisory lock (flock) on the file at path
+// while holding its lock file, so it excludes legacy scripts using flock(1) on that file and vice versa.
+// An empty path stands for FlockPath. As the flock is released when the holding process exits,
+// the mode is meaningful for processes which hold the Mutex while running.
+func WithFlock(path string) Option {
+	return func(m *Mutex) {
+		m.flock = true
+		m.flockPath = path
+	}
+}
+
+// WithIdempotentUnlock makes unlocking a Mutex, which is not locked, succeed instead of failing
+// with ErrNotLocked, so retry loops and double-release paths need no special care.
+func WithIdempotentUnlock() Option {
+	return func(m *Mutex) {
+		m.idempotentUnlock = true
+	}
+}
+
+// WithRequestIdKey makes LockWithContext record the value of the context key (e.g. a request or job id)
+// in candidate and lock metadata, so an operator can find the application trace of the holder.
+func WithRequestIdKey(key interface{}) Option {
+	return func(m *Mutex) {
+		m.requestKey = key
+	}
+}
+
+// requestId returns the value of the request id key of the context, see WithRequestIdKey.
+func (m *Mutex) requestId(ctx context.Context) string {
+	if m.requestKey == nil {
+		return ""
+	}
+	if value := ctx.Value(m.requestKey); value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+// WithNamespace prefixes ids of mutexes with the namespace (e.g. "staging" or "prod"), so multiple environments
+// can share a root without collisions of their ids. Managers with the option list only mutexes of the namespace,
+// by ids without the prefix.
+func WithNamespace(namespace string) Option {
+	return func(m *Mutex) {
+		m.namespace = strings.Trim(namespace, namespaceSeparator)
+	}
+}
+
+// WithLazyInit defers creation of the mutex directory until the Mutex is locked for the first time,
+// so a Mutex used only to inspect the lock (see Peek) does not modify the filesystem.
+func WithLazyInit() Option {
+	return func(m *Mutex) {
+		m.lazyInit = true
+	}
+}
+
+// WithMessage sets a human-readable intent (e.g. "loading warehouse, ticket OPS-123") recorded in metadata
+// of locks of the Mutex, telling why the lock is held.
+func WithMessage(message string) Option {
+	return func(m *Mutex) {
+		m.message = message
+	}
+}
+
+// WithOwner sets an application-defined owner (e.g. a job name) recorded in metadata of locks of the Mutex.
+func WithOwner(owner string) Option {
+	return func(m *Mutex) {
+		m.owner = owner
+	}
+}
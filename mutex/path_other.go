@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package mutex
+
+import "path/filepath"
+
+// windowsNames reports whether ids have to be valid names of Windows directories, see validateWindowsId.
+// Required on other platforms only WithCifs.
+const windowsNames = false
+
+// evalSymlinks returns the path with symbolic links resolved, see filepath.EvalSymlinks.
+func evalSymlinks(p string) (string, error) {
+	return filepath.EvalSymlinks(p)
+}
+
+// checkPathLength checks files of the Mutex will not have paths too long for the platform.
+// Long paths are limited on Windows only.
+func checkPathLength(m *Mutex) error {
+	return nil
+}
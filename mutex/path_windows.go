@@ -0,0 +1,68 @@
+//go:build windows
+// +build windows
+
+package mutex
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// windowsNames reports whether ids have to be valid names of Windows directories, see validateWindowsId.
+const windowsNames = true
+
+// maxPath is the length of paths, from which Windows APIs require the extended-length prefix (MAX_PATH
+// less the room for a file name of 8.3 characters, which directory operations reserve).
+const maxPath = 260 - 12
+
+// fileNameRoom is the length reserved for paths of files of a mutex, relative to its directory,
+// beyond the name of the mutex, e.g. the candidate ".candidates/<name>-candidate-<random>.tmp".
+const fileNameRoom = 48
+
+const (
+	longPathPrefix = `\\?\`
+	longUncPrefix  = `\\?\UNC\`
+)
+
+// longPath returns the absolute path with the extended-length prefix, if too long for plain Windows APIs.
+// The os package adds the prefix itself, but filepath.EvalSymlinks does not.
+func longPath(p string) string {
+	if len(p) < maxPath || !filepath.IsAbs(p) || strings.HasPrefix(p, longPathPrefix) {
+		return p
+	}
+	p = filepath.Clean(p)
+	if strings.HasPrefix(p, `\\`) {
+		return longUncPrefix + p[2:]
+	}
+	return longPathPrefix + p
+}
+
+// shortPath strips the extended-length prefix added by longPath.
+func shortPath(p string) string {
+	if strings.HasPrefix(p, longUncPrefix) {
+		return `\\` + p[len(longUncPrefix):]
+	}
+	return strings.TrimPrefix(p, longPathPrefix)
+}
+
+// evalSymlinks returns the path with symbolic links resolved, see filepath.EvalSymlinks,
+// supporting paths longer than MAX_PATH.
+func evalSymlinks(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(longPath(p))
+	if err != nil {
+		return "", err
+	}
+	return shortPath(resolved), nil
+}
+
+// checkPathLength checks files of the Mutex will not have paths too long for Windows: the os package
+// adds the extended-length prefix to long absolute paths itself, except to UNC paths (\\server\share\...).
+func checkPathLength(m *Mutex) error {
+	dir := filepath.Clean(m.directory)
+	if strings.HasPrefix(dir, `\\`) && !strings.HasPrefix(dir, longPathPrefix) &&
+		len(dir)+len(m.name())+fileNameRoom >= maxPath {
+		return fmt.Errorf("%w: path of \"%s\" too long for a UNC root (%s)", ErrInvalidId, m.id, dir)
+	}
+	return nil
+}
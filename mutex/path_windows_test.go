@@ -0,0 +1,42 @@
+//go:build windows
+// +build windows
+
+package mutex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := `C:\` + strings.Repeat(`x\`, 150)
+	cases := []struct {
+		path string
+		want string
+	}{
+		{`C:\short`, `C:\short`},
+		{long, longPathPrefix + strings.TrimSuffix(long, `\`)},
+		{`\\server\share\` + long[3:], longUncPrefix + `server\share\` + strings.TrimSuffix(long[3:], `\`)},
+	}
+	for _, c := range cases {
+		got := longPath(c.path)
+		if got != c.want {
+			t.Fatalf("wrong result of longPath(%s): %s instead of %s", c.path, got, c.want)
+		}
+		if shortPath(got) != strings.TrimSuffix(c.path, `\`) {
+			t.Fatalf("wrong result of shortPath(%s): %s instead of %s", got, shortPath(got), c.path)
+		}
+	}
+}
+
+func TestUncPathLength(t *testing.T) {
+	m := &Mutex{id: "test-mutex", directory: `\\server\share\` + strings.Repeat(`x\`, 100) + "test-mutex"}
+	if err := checkPathLength(m); !errors.Is(err, ErrInvalidId) {
+		t.Fatalf("wrong error of checkPathLength: %v instead of %v", err, ErrInvalidId)
+	}
+	m.directory = `\\server\share\test-mutex`
+	if err := checkPathLength(m); err != nil {
+		t.Fatal(err)
+	}
+}
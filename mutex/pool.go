@@ -0,0 +1,70 @@
+package mutex
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// A Pool caches Mutex instances of a Manager per id, keeping at most given number of them.
+// The least recently used instances are evicted first, except those holding their locks, so a held lock
+// is never orphaned by the Pool; while more than size mutexes are held, the Pool keeps all of them.
+// An evicted Mutex stays fully usable by whoever still references it; the Pool simply forgets it.
+// Pool is safe for concurrent use.
+type Pool struct {
+	mgr   *Manager
+	size  int
+	mx    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+// A poolEntry is an element of the Pool's LRU list.
+type poolEntry struct {
+	id    string
+	mutex *Mutex
+}
+
+// NewPool creates a Pool of at most size mutexes created by the Manager.
+func NewPool(mgr *Manager, size int) (*Pool, error) {
+	if size <= 0 {
+		return nil, errors.New("pool size must be positive")
+	}
+	return &Pool{
+		mgr:   mgr,
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}, nil
+}
+
+// Get returns the cached Mutex of given id, creating it if needed.
+func (p *Pool) Get(id string) (*Mutex, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if e, ok := p.items[id]; ok {
+		p.order.MoveToFront(e)
+		return e.Value.(*poolEntry).mutex, nil
+	}
+	m, err := p.mgr.Mutex(id)
+	if err != nil {
+		return nil, err
+	}
+	p.items[id] = p.order.PushFront(&poolEntry{id: id, mutex: m})
+	for e := p.order.Back(); e != p.order.Front() && p.order.Len() > p.size; {
+		prev := e.Prev()
+		if entry := e.Value.(*poolEntry); !entry.mutex.isHeld() {
+			p.order.Remove(e)
+			delete(p.items, entry.id)
+		}
+		e = prev
+	}
+	return m, nil
+}
+
+// Len returns the number of cached mutexes.
+func (p *Pool) Len() int {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return p.order.Len()
+}
@@ -0,0 +1,80 @@
+package mutex
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	mgr, err := NewManager(temporaryCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPool(mgr, 0); err == nil {
+		t.Fatal("zero pool size should be rejected")
+	}
+	const size = 3
+	pool, err := NewPool(mgr, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := pool.Get("job-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 10; i++ {
+		if _, err := pool.Get(fmt.Sprintf("job-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		// Keep job-0 recently used
+		if again, err := pool.Get("job-0"); err != nil {
+			t.Fatal(err)
+		} else if again != first {
+			t.Fatalf("job-0 evicted from the pool after %d insertions", i)
+		}
+	}
+	if pool.Len() != size {
+		t.Fatalf("wrong pool size %d instead of %d", pool.Len(), size)
+	}
+	evicted, err := pool.Get("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted.Id() != "job-1" {
+		t.Fatalf("wrong id \"%s\" instead of \"job-1\"", evicted.Id())
+	}
+	if pool.Len() != size {
+		t.Fatalf("wrong pool size %d instead of %d", pool.Len(), size)
+	}
+}
+
+func TestPoolHeld(t *testing.T) {
+	mgr, err := NewManager(temporaryCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewPool(mgr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := pool.Get("held-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := held.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer held.Unlock()
+	if _, err := pool.Get("other-job"); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != 2 {
+		t.Fatalf("wrong pool size %d instead of %d", pool.Len(), 2)
+	}
+	if again, err := pool.Get("held-job"); err != nil {
+		t.Fatal(err)
+	} else if again != held {
+		t.Fatal("a held mutex evicted from the pool")
+	}
+}
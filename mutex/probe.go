@@ -0,0 +1,72 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// ErrRootUnsupported is returned by Manager.Probe when the filesystem of the root lacks a capability
+// mutexes rely on.
+var ErrRootUnsupported = errors.New("root filesystem is not supported")
+
+// probeDirectoryTemplate defines name template of the temporary directory used by Manager.Probe.
+const probeDirectoryTemplate = ".probe-*"
+
+// Probe verifies that the filesystem of the Manager's root supports what its mutexes rely on:
+// creating directories and files, hard links with reliable link counts (or exclusive creation of files
+// in the WithCifs mode) and atomic replacement of files by renaming. The checks are made in a temporary
+// directory removed afterwards, so Probe may be run against a root in use. A root, which cannot be written to,
+// is reported by an error wrapping ErrReadOnlyRoot.
+func (mgr *Manager) Probe() error {
+	m := newConfiguredMutex(mgr.opts)
+	if err := os.MkdirAll(mgr.root, m.dirMode); readOnly(err) {
+		return fmt.Errorf("%w: %s: %v", ErrReadOnlyRoot, mgr.root, err)
+	} else if err != nil {
+		return fmt.Errorf("%w: cannot create root %s: %v", ErrRootUnsupported, mgr.root, err)
+	}
+	if err := checkWritable(mgr.root); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrReadOnlyRoot, mgr.root, err)
+	}
+	dir, err := ioutil.TempDir(mgr.root, probeDirectoryTemplate)
+	if readOnly(err) {
+		return fmt.Errorf("%w: %s: %v", ErrReadOnlyRoot, mgr.root, err)
+	} else if err != nil {
+		return fmt.Errorf("%w: cannot create directory in %s: %v", ErrRootUnsupported, mgr.root, err)
+	}
+	defer os.RemoveAll(dir)
+	m.directory = dir
+	target := path.Join(dir, "probe.lck")
+
+	if m.cifs {
+		if err := m.createExclusive(target, m.newMetadata()); err != nil {
+			return fmt.Errorf("%w: cannot create files exclusively in %s: %v", ErrRootUnsupported, mgr.root, err)
+		}
+		if err := m.createExclusive(target, m.newMetadata()); err == nil {
+			return fmt.Errorf("%w: exclusive creation of files succeeds twice in %s", ErrRootUnsupported, mgr.root)
+		}
+	} else {
+		candidate, err := ioutil.TempFile(dir, "probe-*.cnd")
+		if err != nil {
+			return fmt.Errorf("%w: cannot create files in %s: %v", ErrRootUnsupported, mgr.root, err)
+		}
+		defer candidate.Close()
+		if !linkedCandidate(candidate, false, target, linkCandidate(candidate, false, target)) {
+			return fmt.Errorf("%w: hard links are not supported (reliably) in %s", ErrRootUnsupported, mgr.root)
+		}
+		if os.Link(candidate.Name(), target) == nil {
+			return fmt.Errorf("%w: linking to an existing file succeeds in %s", ErrRootUnsupported, mgr.root)
+		}
+	}
+
+	const replaced = "replaced"
+	if err := m.replaceFile(target, []byte(replaced)); err != nil {
+		return fmt.Errorf("%w: cannot replace files by renaming in %s: %v", ErrRootUnsupported, mgr.root, err)
+	}
+	if b, err := ioutil.ReadFile(target); err != nil || string(b) != replaced {
+		return fmt.Errorf("%w: files replaced by renaming are not read back in %s", ErrRootUnsupported, mgr.root)
+	}
+	return nil
+}
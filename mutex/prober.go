@@ -0,0 +1,96 @@
+package mutex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A proberTemplate defines name template of the file flocked by the prober of local waiters, see WithLocalProbing;
+// the placeholder is replaced by a hash of the lock path.
+const proberTemplate = "fmutex-%s.prober"
+
+// A wakeupTemplate defines name template of the file touched to wake local waiters, see WithLocalProbing.
+const wakeupTemplate = "fmutex-%s.wakeup"
+
+// WithLocalProbing makes waiters of the same Mutex on the local host coordinate through files in the directory,
+// which should be on a local filesystem (e.g. os.TempDir()): only one of them, the prober elected by a flock,
+// attempts to claim the lock every pulse, while the others only watch a local notification file. When the prober
+// acquires the lock or gives up, it wakes the others and one of them takes its role over. Each waiter still
+// refreshes its candidate, checks the lock for staleness and attempts to claim it once per refresh period,
+// so a pileup of local waiters does not multiply the traffic to the root. Not supported on platforms without flock,
+// where all waiters probe the lock as usual.
+func WithLocalProbing(dir string) Option {
+	return func(m *Mutex) {
+		m.probeDirectory = dir
+	}
+}
+
+// A localProber takes part in the coordination of local waiters of a single acquisition, see WithLocalProbing.
+type localProber struct {
+	roleFile string
+	wakeup   string
+	role     *os.File  // The flocked role file, while being the prober
+	seen     time.Time // Modification time of the wakeup file as seen last
+	disabled bool      // The coordination is not possible, e.g. flock is not supported
+}
+
+// newLocalProber returns the localProber of a new acquisition of the Mutex, nil if not configured.
+func (m *Mutex) newLocalProber() *localProber {
+	if m.probeDirectory == "" {
+		return nil
+	}
+	hash := hashKey(m.LockPath())
+	p := &localProber{
+		roleFile: filepath.Join(m.probeDirectory, fmt.Sprintf(proberTemplate, hash)),
+		wakeup:   filepath.Join(m.probeDirectory, fmt.Sprintf(wakeupTemplate, hash)),
+	}
+	if info, err := os.Stat(p.wakeup); err == nil {
+		p.seen = info.ModTime()
+	}
+	return p
+}
+
+// probing reports whether the waiter should attempt to claim the lock now: it is the prober
+// (possibly just elected) or the prober has woken the waiters.
+func (p *localProber) probing(m *Mutex) bool {
+	if p == nil || p.disabled || p.role != nil {
+		return true
+	}
+	f, err := os.OpenFile(p.roleFile, os.O_RDWR|os.O_CREATE, m.fileMode)
+	if err != nil {
+		p.disabled = true
+		return true
+	}
+	if locked, err := tryFlock(f); locked || err != nil {
+		if err != nil {
+			f.Close()
+			p.disabled = true
+		} else {
+			p.role = f
+		}
+		return true
+	}
+	f.Close()
+	if info, err := os.Stat(p.wakeup); err == nil && !info.ModTime().Equal(p.seen) {
+		p.seen = info.ModTime()
+		return true
+	}
+	return false
+}
+
+// close gives up the role of the prober, if held, and wakes other waiters, so one of them takes it over.
+func (p *localProber) close(m *Mutex) {
+	if p == nil || p.role == nil {
+		return
+	}
+	p.role.Close() // closing the descriptor releases the flock
+	p.role = nil
+	tm := time.Now()
+	if err := os.Chtimes(p.wakeup, tm, tm); os.IsNotExist(err) {
+		if f, err := os.OpenFile(p.wakeup, os.O_RDWR|os.O_CREATE, m.fileMode); err == nil {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mutex
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalProbing(t *testing.T) {
+	const mutexId = "prober-test-mutex"
+	const waiters = 5
+	mutexRoot := temporaryCatalog(t)
+	probeDir := temporaryCatalog(t)
+	if f, err := os.Create(filepath.Join(probeDir, "flock")); err != nil {
+		t.Fatal(err)
+	} else if _, err := tryFlock(f); err != nil {
+		f.Close()
+		t.Skipf("flock not available: %v", err)
+	} else {
+		f.Close()
+	}
+	newMutex := func() *Mutex {
+		mx, err := NewMutexExt(mutexRoot, mutexId, 5*time.Millisecond, time.Second, DefaultDeadTimeout,
+			WithLocalProbing(probeDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mx
+	}
+	holder := newMutex()
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	mutexes := make([]*Mutex, waiters)
+	errs := make(chan error, waiters)
+	for i := range mutexes {
+		mutexes[i] = newMutex()
+		wg.Add(1)
+		go func(mx *Mutex) {
+			defer wg.Done()
+			if err := mx.TryLock(5 * time.Second); err != nil {
+				errs <- err
+				return
+			}
+			mx.Unlock()
+		}(mutexes[i])
+	}
+	time.Sleep(300 * time.Millisecond)
+	var attempts uint64
+	for _, mx := range mutexes {
+		attempts += mx.Stats().Attempts
+	}
+	// A single prober attempts every pulse, the others once per refresh
+	if attempts > uint64(time.Since(start)/(5*time.Millisecond))+2*waiters {
+		t.Fatalf("too many attempts %d of %d waiters", attempts, waiters)
+	}
+	holder.Unlock()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mutex
+
+// processAlive reports whether a process of given PID exists on the local host.
+// Not supported on this platform, so all processes are assumed to be alive.
+func processAlive(pid int) bool {
+	return true
+}
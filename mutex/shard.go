@@ -0,0 +1,62 @@
+package mutex
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// shardLength determines the number of hexadecimal digits of names of shard directories, see WithShardedLayout.
+const shardLength = 2
+
+// WithShardedLayout places directories of mutexes into 256 shard directories named by a hash of the first
+// component of their id, e.g. "root/3f/tenantA/jobs" for "tenantA/jobs" (below the namespace, if any),
+// so no directory of a root with tens of thousands of ids grows too large. Ids sharing the first component
+// share the shard, so nested ids and patterns like "tenantA/..." work as in the flat layout.
+// All users of a root must use the same layout; a flat root is migrated by Manager.Transplant
+// to a Manager configured with the sharded layout.
+func WithShardedLayout() Option {
+	return func(m *Mutex) {
+		m.sharded = true
+	}
+}
+
+// shardOf returns the name of the shard directory of the id, which is relative to the namespace.
+func shardOf(id string) string {
+	first := strings.SplitN(id, namespaceSeparator, 2)[0]
+	return hashKey(strings.ToLower(first))[:shardLength]
+}
+
+// idPath returns the path of the directory of the id (including the namespace) relative to the root.
+func (m *Mutex) idPath(id string) string {
+	if !m.sharded {
+		return id
+	}
+	namespace := ""
+	if m.namespace != "" && strings.HasPrefix(strings.ToLower(id), strings.ToLower(m.namespace)+namespaceSeparator) {
+		namespace, id = id[:len(m.namespace)], id[len(m.namespace)+1:]
+	}
+	return path.Join(namespace, shardOf(id), id)
+}
+
+// relDir returns the path of the directory of the id relative to the directory of the namespace of the Manager.
+func (mgr *Manager) relDir(id string) string {
+	if !mgr.sharded {
+		return id
+	}
+	return path.Join(shardOf(id), id)
+}
+
+// idOf returns the id of the directory at the path relative to the directory of the namespace of the Manager.
+// Returns false for shard directories and directories not placed by the layout of the Manager.
+func (mgr *Manager) idOf(rel string) (string, bool) {
+	rel = filepath.ToSlash(rel)
+	if !mgr.sharded {
+		return rel, true
+	}
+	parts := strings.SplitN(rel, namespaceSeparator, 2)
+	if len(parts) < 2 || shardOf(parts[1]) != parts[0] {
+		return "", false
+	}
+	return parts[1], true
+}
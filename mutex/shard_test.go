@@ -0,0 +1,69 @@
+package mutex
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShardedLayout(t *testing.T) {
+	flatRoot := temporaryCatalog(t)
+	flat, err := NewManagerExt(flatRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"tenantA", "tenantA/jobs", "tenantB"}
+	for _, id := range ids {
+		m, err := flat.Mutex(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		defer m.Unlock()
+	}
+
+	// Migration of the flat root
+	shardedRoot := temporaryCatalog(t)
+	sharded, err := NewManagerExt(shardedRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithShardedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flat.Transplant(sharded, true); err != nil {
+		t.Fatal(err)
+	}
+	m, err := sharded.Mutex("tenantA/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(shardedRoot, shardOf("tenantA"), "tenantA", "jobs")
+	if m.directory != expected {
+		t.Fatalf("wrong directory %s instead of %s", m.directory, expected)
+	}
+	if m.When().IsZero() {
+		t.Fatal("a held lock should be migrated")
+	}
+	if listed, err := sharded.List(AllIds); err != nil || !reflect.DeepEqual(listed, ids) {
+		t.Fatalf("wrong ids %v (%v) instead of %v", listed, err, ids)
+	}
+	if listed, err := sharded.List("tenantA/..."); err != nil || !reflect.DeepEqual(listed, ids[:2]) {
+		t.Fatalf("wrong ids %v (%v) instead of %v", listed, err, ids[:2])
+	}
+	if listed, err := sharded.List("tenantB"); err != nil || !reflect.DeepEqual(listed, ids[2:]) {
+		t.Fatalf("wrong ids %v (%v) instead of %v", listed, err, ids[2:])
+	}
+	// Directories of the flat layout are not mistaken for mutexes of the sharded one
+	legacy, err := NewManagerExt(shardedRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flat.Transplant(legacy, true); err != nil {
+		t.Fatal(err)
+	}
+	if listed, err := sharded.List(AllIds); err != nil || !reflect.DeepEqual(listed, ids) {
+		t.Fatalf("wrong ids %v (%v) instead of %v", listed, err, ids)
+	}
+}
@@ -0,0 +1,40 @@
+package mutex
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// raiseSignal terminates the process with the signal after the Mutex has been released by ReleaseOnSignal.
+var raiseSignal = func(sig os.Signal) {
+	signal.Reset(sig)
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+		select {} // wait for the default action of the signal
+	}
+	os.Exit(1)
+}
+
+// ReleaseOnSignal installs a handler of the signals (os.Interrupt and SIGTERM, if none are given), which
+// releases the Mutex, if held, before the process is terminated by the signal. Returned stop function uninstalls the handler, e.g. once the Mutex has been released.
+func ReleaseOnSignal(m *Mutex, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			m.releaseHeld()
+			raiseSignal(sig)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
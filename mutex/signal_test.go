@@ -0,0 +1,37 @@
+package mutex
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReleaseOnSignal(t *testing.T) {
+	const mutexId = "signal-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	raised := make(chan os.Signal, 1)
+	defer func(raise func(os.Signal)) { raiseSignal = raise }(raiseSignal)
+	raiseSignal = func(sig os.Signal) { raised <- sig }
+	mx.Lock()
+	stop := ReleaseOnSignal(mx, os.Interrupt)
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot signal the process: %v", err)
+	}
+	select {
+	case sig := <-raised:
+		if sig != os.Interrupt {
+			t.Fatalf("wrong signal %v instead of %v", sig, os.Interrupt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("signal not handled")
+	}
+	if _, err := os.Stat(mx.LockPath()); !os.IsNotExist(err) {
+		t.Fatalf("lock file not released: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package mutex
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidSignature is reported when a lock file of a Mutex configured with a secret
+// carries a missing or wrong signature. Such lock files are treated as stale.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// encodeMetadata returns JSON encoding of the metadata, signed if the Mutex has a secret.
+func (m *Mutex) encodeMetadata(md *Metadata) ([]byte, error) {
+	md.Signature = ""
+	data, err := json.Marshal(md)
+	if err != nil || m.secret == nil {
+		return data, err
+	}
+	md.Signature = m.sign(string(data))
+	return json.Marshal(md)
+}
+
+// verify reports whether the metadata carries a valid signature.
+func (m *Mutex) verify(md *Metadata) bool {
+	var expected string
+	if md.Version == LegacyVersion {
+		expected = m.sign(strconv.FormatInt(md.timestamp(), 10))
+	} else {
+		unsigned := *md
+		unsigned.Signature = ""
+		data, err := json.Marshal(&unsigned)
+		if err != nil {
+			return false
+		}
+		expected = m.sign(string(data))
+	}
+	return hmac.Equal([]byte(md.Signature), []byte(expected))
+}
+
+// sign returns HMAC signature of the value bound to the Mutex id.
+func (m *Mutex) sign(value string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(m.id + "\n" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package mutex
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedTimestamp(t *testing.T) {
+	const mutexId = "signed-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithSecret([]byte("top secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if md, err := mx.Metadata(); err != nil {
+		t.Fatal(err)
+	} else if md.Signature == "" {
+		t.Fatal("metadata should be signed")
+	}
+	if _, err := mx.readVerifiedTimestamp(mx.LockPath()); err != nil {
+		t.Fatalf("signature should be valid: %v", err)
+	}
+	other, err := NewMutex(mutexRoot, mutexId, WithSecret([]byte("another secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.readVerifiedTimestamp(mx.LockPath()); err == nil {
+		t.Fatal("signature should be invalid for another secret")
+	}
+}
+
+func TestForgedTimestamp(t *testing.T) {
+	const mutexId = "forged-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	var events []Event
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout,
+		WithSecret([]byte("top secret")), WithEventHandler(func(e Event) { events = append(events, e) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := os.Create(mx.LockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeCurrentTimestamp(forged); err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if len(events) != 3 || events[0].Kind != EventInvalidSignature || events[1].Kind != EventStaleBroken ||
+		events[2].Kind != EventAcquired {
+		t.Fatalf("wrong events: %v", events)
+	}
+}
+
+func TestSignedLegacyTimestamp(t *testing.T) {
+	const mutexId = "signed-legacy-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutex(mutexRoot, mutexId, WithSecret([]byte("top secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := strconv.FormatInt(now(), 10)
+	if err := os.WriteFile(mx.LockPath(), []byte(value+" "+mx.sign(value)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mx.readVerifiedTimestamp(mx.LockPath()); err != nil {
+		t.Fatalf("signature should be valid: %v", err)
+	}
+	if migrated, err := mx.Migrate(); err != nil || !migrated {
+		t.Fatalf("wrong result of Migrate(): %v, %v", migrated, err)
+	}
+	if _, err := mx.readVerifiedTimestamp(mx.LockPath()); err != nil {
+		t.Fatalf("signature should be valid after migration: %v", err)
+	}
+}
+
+func TestTouchedSignedLock(t *testing.T) {
+	const mutexId = "touched-signed-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	secret := WithSecret([]byte("top secret"))
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 200*time.Millisecond, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 200*time.Millisecond, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Abandoned by the holder, but kept touched by a process without the secret
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	done := make(chan struct{})
+	touched := make(chan struct{})
+	go func() {
+		defer close(touched)
+		for {
+			now := time.Now()
+			os.Chtimes(holder.LockPath(), now, now)
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}()
+	err = waiter.TryLock(time.Second)
+	close(done)
+	<-touched
+	if err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	waiter.Unlock()
+}
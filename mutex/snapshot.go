@@ -0,0 +1,93 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// A Snapshot captures metadata of locks held under a Manager's root at a point in time,
+// e.g. to migrate them to another root or to attach the lock state to an incident report.
+// Waiters are not captured.
+type Snapshot struct {
+	Root    string      `json:"root"`
+	Created time.Time   `json:"created"`
+	Locks   []*Metadata `json:"locks"`
+}
+
+// Export returns a Snapshot of locks of mutexes matching the pattern (see List).
+// Locks with an invalid signature are exported as they are, together with their signature.
+func (mgr *Manager) Export(pattern string) (*Snapshot, error) {
+	ids, err := mgr.List(pattern)
+	if err != nil {
+		return nil, err
+	}
+	result := &Snapshot{Root: mgr.root, Created: time.Now().UTC(), Locks: []*Metadata{}}
+	for _, id := range ids {
+		m, err := mgr.peek(id)
+		if err != nil {
+			return nil, err
+		}
+		md, err := m.Metadata()
+		if md == nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // Released meanwhile or only awaited
+			}
+			return nil, fmt.Errorf("cannot export lock %s: %w", id, err)
+		}
+		if md.Key == "" {
+			md.Id = id // Without the namespace, if any
+		}
+		result.Locks = append(result.Locks, md)
+	}
+	return result, nil
+}
+
+// SnapshotId returns the id of the mutex of exported metadata: the original key of hashed ids, if known.
+func (md *Metadata) SnapshotId() string {
+	if md.Key != "" {
+		return md.Key
+	}
+	return md.Id
+}
+
+// Restore locks the Mutex with the metadata of a lock exported by Manager.Export, preserving its holder,
+// owner, creation time, trace and fencing token. The lock is refreshed, so it gets a full lease in its
+// new location; the token counter of the Mutex is advanced to the restored token, if behind.
+// Fails with ErrExpired, if the Mutex is locked already.
+func (m *Mutex) Restore(md *Metadata) error {
+	attempt, cancel := context.WithCancel(context.Background())
+	cancel() // single locking attempt
+	if err := m.LockWithContext(attempt); err != nil {
+		return fmt.Errorf("cannot restore lock %s: %w", m.id, err)
+	}
+	restored := *md
+	restored.Version = MetadataVersion
+	restored.Id = m.id
+	restored.Key = ""
+	if m.hashedIds {
+		restored.Key = m.key
+	}
+	if restored.Lease == 0 {
+		restored.Lease = Duration(m.deadAgeRecovery)
+	}
+	if !m.dotLock {
+		if token, err := m.currentToken(); err != nil {
+			return fmt.Errorf("cannot restore lock %s: %w", m.id, err)
+		} else if token < restored.Token {
+			if err := m.replaceFile(m.tokenPath(), []byte(fmt.Sprintf("%d\n", restored.Token))); err != nil {
+				return fmt.Errorf("cannot restore lock %s: %w", m.id, err)
+			}
+		}
+	}
+	if _, err := m.writeMetadata(m.LockPath(), &restored); err != nil {
+		return fmt.Errorf("cannot restore lock %s: %w", m.id, err)
+	}
+	m.owner = restored.Owner
+	m.setAcquisition(restored.Trace, restored.Token)
+	m.markHeld()
+	m.mirrorLock()
+	return nil
+}
@@ -0,0 +1,64 @@
+package mutex
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	source, err := NewManager(temporaryCatalog(t), WithOwner("exporter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := source.Mutex("tenant/snapshot-test-mutex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ { // Advance the fencing token
+		if err := mx.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		if i < 2 {
+			mx.Unlock()
+		}
+	}
+	defer mx.Unlock()
+	snapshot, err := source.Export(AllIds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Locks) != 1 || snapshot.Locks[0].SnapshotId() != mx.Id() || snapshot.Locks[0].Token != 3 {
+		t.Fatalf("wrong snapshot: %+v", snapshot)
+	}
+
+	target, err := NewManager(temporaryCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := target.Mutex(snapshot.Locks[0].SnapshotId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Restore(snapshot.Locks[0]); err != nil {
+		t.Fatal(err)
+	}
+	md, err := restored.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Owner != "exporter" || md.Token != 3 || !md.Created.Equal(snapshot.Locks[0].Created) {
+		t.Fatalf("wrong restored metadata: %+v", md)
+	}
+	if err := restored.ValidateToken(3); err != nil {
+		t.Fatalf("wrong result of ValidateToken(): %v", err)
+	}
+	other, err := NewMutex(target.Root(), mx.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Restore(snapshot.Locks[0]); !errors.Is(err, ErrExpired) {
+		t.Fatalf("wrong result of Restore() of a locked mutex: %v instead of %v", err, ErrExpired)
+	}
+	restored.Unlock()
+}
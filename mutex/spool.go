@@ -0,0 +1,106 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Spool lets multiple workers (processes or hosts) drain a shared spool directory: each item (a file
+// of the directory) is claimed by exactly one worker through its own Mutex of the Manager, with id
+// "<name>/<item>". Claims of crashed workers get stale as any other lock, so their items are claimed again.
+// Mutexes of processed items are kept, so fencing tokens of their claims are never issued again.
+// Files whose names start with "." are ignored, so items can be prepared under such names and renamed.
+type Spool struct {
+	mgr  *Manager
+	name string
+	dir  string
+}
+
+// NewSpool creates a Spool of items in the directory, claimed by mutexes of the Manager named after name.
+func NewSpool(mgr *Manager, name string, dir string) *Spool {
+	return &Spool{mgr: mgr, name: strings.Trim(name, namespaceSeparator), dir: dir}
+}
+
+// List returns names of unclaimed items of the Spool, the oldest first.
+func (s *Spool) List() ([]string, error) {
+	items, err := s.items()
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, item := range items {
+		m, err := s.mgr.Mutex(s.claimId(item))
+		if err != nil {
+			return nil, err
+		}
+		if m.When().IsZero() {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// Claim claims an item of the Spool, waiting until there is an unclaimed one or the context is done (ErrExpired).
+// Returns name of the item and a function releasing the claim, which should be called once the item has been
+// processed and removed from (or moved out of) the spool directory.
+func (s *Spool) Claim(ctx context.Context) (item string, release func() error, err error) {
+	// Kept across rounds, so stale claims observed by the single attempts per round are broken
+	mutexes := make(map[string]*Mutex)
+	attempts := make(map[string]*lockAttempt)
+	for {
+		items, err := s.items()
+		if err != nil {
+			return "", nil, err
+		}
+		for _, item := range items {
+			m, ok := mutexes[item]
+			if !ok {
+				if m, err = s.mgr.Mutex(s.claimId(item)); err != nil {
+					return "", nil, err
+				}
+				mutexes[item], attempts[item] = m, &lockAttempt{}
+			}
+			if err := m.lockOnce(ctx, attempts[item]); errors.Is(err, ErrExpired) {
+				continue
+			} else if err != nil {
+				return "", nil, err
+			}
+			if _, err := os.Stat(filepath.Join(s.dir, item)); err != nil {
+				// Processed by another worker meanwhile
+				m.TryUnlock()
+				continue
+			}
+			return item, m.TryUnlock, nil
+		}
+		if sleepOrDone(ctx, s.mgr.pulse) {
+			return "", nil, ErrExpired
+		}
+	}
+}
+
+// items returns names of items of the Spool, the oldest first.
+func (s *Spool) items() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	var result []string
+	for _, info := range infos {
+		if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			result = append(result, info.Name())
+		}
+	}
+	return result, nil
+}
+
+// claimId returns id of the Mutex claiming the item.
+func (s *Spool) claimId(item string) string {
+	return path.Join(s.name, item)
+}
@@ -0,0 +1,111 @@
+package mutex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpool(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	spoolDir := temporaryCatalog(t)
+	items := []string{"a.job", "b.job", "c.job", "d.job"}
+	for _, item := range items {
+		if err := os.WriteFile(filepath.Join(spoolDir, item), []byte(item), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool := NewSpool(mgr, "spool", spoolDir)
+	if got, err := spool.List(); err != nil || len(got) != len(items) {
+		t.Fatalf("wrong result of List(): %v (%v)", got, err)
+	}
+	var mx sync.Mutex
+	processed := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				item, release, err := spool.Claim(ctx)
+				cancel()
+				if err == ErrExpired {
+					return
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				mx.Lock()
+				processed[item]++
+				mx.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				if err := os.Remove(filepath.Join(spoolDir, item)); err != nil {
+					t.Error(err)
+				}
+				if err := release(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, item := range items {
+		if processed[item] != 1 {
+			t.Fatalf("item %s processed %d times instead of once", item, processed[item])
+		}
+	}
+	// Mutexes of processed items are kept with their fencing tokens
+	for _, item := range items {
+		m, err := mgr.Mutex(spool.claimId(item))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.When().IsZero() {
+			t.Fatalf("item %s still claimed", item)
+		}
+		// Claimed again, if found by a worker before its removal
+		if token, err := m.currentToken(); err != nil || token == 0 {
+			t.Fatalf("wrong token %d (%v) of item %s", token, err, item)
+		}
+	}
+}
+
+func TestSpoolStaleClaim(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	spoolDir := temporaryCatalog(t)
+	if err := os.WriteFile(filepath.Join(spoolDir, "a.job"), []byte("a.job"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const deadTimeout = 50 * time.Millisecond
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, 10*time.Millisecond, deadTimeout, WithBreakGrace(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool := NewSpool(mgr, "spool", spoolDir)
+	// Claimed by a crashed worker, never refreshed
+	crashed, err := NewMutexExt(mutexRoot, spool.claimId("a.job"), 10*time.Millisecond, 10*time.Millisecond, deadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item, release, err := spool.Claim(ctx)
+	if err != nil {
+		t.Fatalf("Claim failed (%v), but should succeed.", err)
+	}
+	if item != "a.job" {
+		t.Fatalf("wrong item %s instead of a.job", item)
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultClockSkewThreshold determines how far in the future a lock timestamp may be
+// before it is reported as a clock skew.
+const DefaultClockSkewThreshold = 1 * time.Minute
+
+// ErrClockSkew is reported when a lock timestamp is in the future of the local clock
+// by more than the clock skew threshold, which usually means a host with a broken clock.
+var ErrClockSkew = errors.New("clock skew detected")
+
+// ErrStaleLock is returned by locking a Mutex configured WithNoRecovery, when the lock of another holder is stale.
+var ErrStaleLock = errors.New("lock is stale")
+
+// A progressObserver judges staleness of a lock by observing whether its timestamp advances.
+// The observation window is measured with the local monotonic clock, so unlike comparing
+// the holder's timestamp with the local time, it is immune to clock differences between hosts.
+type progressObserver struct {
+	value int64
+	since time.Time
+}
+
+// stale records the currently read timestamp of the lock (0 if there is no lock)
+// and reports whether it has not changed for longer than limit.
+func (o *progressObserver) stale(value int64, limit time.Duration) bool {
+	if value == 0 || value != o.value {
+		o.value = value
+		o.since = time.Now()
+		return false
+	}
+	return time.Since(o.since) > limit
+}
+
+// A lockReader reads metadata of a competing lock file, reading its contents again
+// only if the file has been replaced or modified since the last read. Stat is cheaper than read,
+// which matters for roots with many waiters.
+type lockReader struct {
+	info os.FileInfo
+	md   *Metadata
+	err  error
+}
+
+// read returns verified metadata of the lock file, see Mutex.readMetadata.
+// Nonexistent files yield nil metadata without an error.
+func (r *lockReader) read(m *Mutex, fileName string) (*Metadata, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		r.info, r.md, r.err = nil, nil, nil
+		return nil, nil
+	}
+	// Extended attributes may change without changing modification time of the file
+	if !m.xattrs && r.info != nil && os.SameFile(r.info, info) &&
+		info.ModTime().Equal(r.info.ModTime()) && info.Size() == r.info.Size() {
+		return r.md, r.err
+	}
+	r.info = info
+	r.md, r.err = m.readMetadata(fileName)
+	if r.md == nil {
+		r.err = nil // Removed meanwhile
+	}
+	return r.md, r.err
+}
+
+// timestamp returns the timestamp of the lock file in milliseconds, 0 if there is no lock.
+func (r *lockReader) timestamp(m *Mutex, fileName string) (int64, error) {
+	md, err := r.read(m, fileName)
+	if md == nil {
+		return 0, nil
+	}
+	return md.timestamp(), err
+}
+
+// refresh returns how often the holder of the last read lock refreshes it, as advertised in its metadata,
+// or the refresh period of the Mutex, if unknown.
+func (r *lockReader) refresh(m *Mutex) time.Duration {
+	if r.md != nil && r.md.Refresh > 0 {
+		return time.Duration(r.md.Refresh)
+	}
+	return m.refresh
+}
+
+// staleLimit returns how long the last read lock may stay unchanged before it is considered stale:
+// the dead timeout of the Mutex, but at least two advertised refresh periods of the holder, so a holder
+// refreshing less often than the dead timeout is not considered dead prematurely.
+func (r *lockReader) staleLimit(m *Mutex) time.Duration {
+	if r.md != nil && 2*time.Duration(r.md.Refresh) > m.deadAgeRecovery {
+		return 2 * time.Duration(r.md.Refresh)
+	}
+	return m.deadAgeRecovery
+}
+
+// CheckClockSkew verifies that the timestamp of the current lock, if any, is not in the future
+// by more than the clock skew threshold, returning an error wrapping ErrClockSkew otherwise.
+func (m *Mutex) CheckClockSkew() error {
+	timestamp, _ := m.readVerifiedTimestamp(m.LockPath())
+	return m.clockSkew(timestamp)
+}
+
+func (m *Mutex) clockSkew(timestamp int64) error {
+	if m.skewThreshold <= 0 || timestamp == 0 {
+		return nil
+	}
+	if skew := time.Duration(timestamp-now()) * time.Millisecond; skew > m.skewThreshold {
+		return fmt.Errorf("%w: timestamp of lock %s is %v ahead of the local clock", ErrClockSkew, m.id, skew)
+	}
+	return nil
+}
+
+// Stale reports whether the Mutex is locked, but the lock has not been refreshed for longer than its lease
+// (the dead timeout of the holder), which usually means the holder has crashed. Unlike waiters, which
+// observe the lock over time, Stale compares the lock timestamp with the local clock, so it depends
+// on clocks of the hosts being synchronized.
+func (m *Mutex) Stale() bool {
+	md, err := m.Metadata()
+	if md == nil || (err != nil && !errors.Is(err, ErrInvalidSignature)) {
+		return false
+	}
+	if m.holderDead(md) {
+		return true
+	}
+	lease := time.Duration(md.Lease)
+	if lease <= 0 {
+		lease = m.deadAgeRecovery
+	}
+	return lease >= 0 && time.Duration(now()-md.timestamp())*time.Millisecond > lease
+}
+
+// WithStealThreshold makes the Mutex break locks of other holders acquired longer than threshold ago,
+// even if they are still refreshed, e.g. for manual recovery or for jobs allowed to preempt very old runs.
+// Holders of the broken locks find out they lost them when refreshing, see KeepAlive.
+func WithStealThreshold(threshold time.Duration) Option {
+	return func(m *Mutex) {
+		m.stealThreshold = threshold
+	}
+}
+
+// WithNoRecovery makes the Mutex never break locks of other holders: once the lock is found stale
+// (or its holder dead, or acquired before the steal threshold), locking fails with an error wrapping ErrStaleLock,
+// EventStaleFound is reported and counted in Stats.StaleFound, so a human can confirm the holder is gone
+// and release the lock manually. Unlike a negative dead timeout, which disables checks for staleness entirely,
+// stale locks are reported.
+func WithNoRecovery() Option {
+	return func(m *Mutex) {
+		m.noRecovery = true
+	}
+}
+
+// staleFound reports the stale lock of the target file with the metadata, see WithNoRecovery.
+func (m *Mutex) staleFound(target string, md *Metadata) error {
+	m.stats.update(func(s *Stats) { s.StaleFound++ })
+	details := "held by unknown holder"
+	if md != nil {
+		details = fmt.Sprintf("held by %s since %s", md.Holder, md.Created.Local().Format(time.RFC3339))
+	}
+	m.emit(Event{Kind: EventStaleFound, Path: target, Info: details})
+	return fmt.Errorf("%w: lock %s %s, not broken", ErrStaleLock, m.id, details)
+}
+
+// tooOld reports whether the lock of the metadata is older than the steal threshold, see WithStealThreshold.
+func (m *Mutex) tooOld(md *Metadata) bool {
+	return m.stealThreshold > 0 && md != nil && time.Since(md.Created) > m.stealThreshold
+}
@@ -0,0 +1,233 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProgressObserver(t *testing.T) {
+	var observer progressObserver
+	const limit = 50 * time.Millisecond
+	if observer.stale(1000, limit) {
+		t.Fatal("a lock observed for the first time cannot be stale")
+	}
+	time.Sleep(2 * limit)
+	if observer.stale(1001, limit) {
+		t.Fatal("an advanced lock cannot be stale")
+	}
+	if observer.stale(1001, limit) {
+		t.Fatal("a lock unchanged shorter than limit cannot be stale")
+	}
+	time.Sleep(2 * limit)
+	if !observer.stale(1001, limit) {
+		t.Fatal("a lock unchanged longer than limit should be stale")
+	}
+	if observer.stale(0, limit) {
+		t.Fatal("a missing lock cannot be stale")
+	}
+}
+
+func TestSkewedStaleLock(t *testing.T) {
+	const mutexId = "skewed-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	var events []Event
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 50*time.Millisecond, 200*time.Millisecond,
+		WithEventHandler(func(e Event) { events = append(events, e) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A lock written by a host, whose clock is 10 minutes ahead
+	if err := os.WriteFile(mx.LockPath(), []byte(fmt.Sprintf("%d\n", now()+millis(10*time.Minute))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mx.CheckClockSkew(); !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("wrong result of CheckClockSkew(): %v instead of %v", err, ErrClockSkew)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	mx.Unlock()
+	if len(events) != 4 || events[0].Kind != EventClockSkew || events[1].Kind != EventStaleBroken ||
+		events[2].Kind != EventAcquired || events[3].Kind != EventReleased {
+		t.Fatalf("wrong events: %v", events)
+	}
+}
+
+func TestLockReader(t *testing.T) {
+	const mutexId = "reader-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, mutexId)
+	var r lockReader
+	if md, err := r.read(mx, mx.LockPath()); md != nil || err != nil {
+		t.Fatalf("wrong result %v, %v for a missing lock", md, err)
+	}
+	write := func(timestamp int64, modTime time.Time) {
+		if err := os.WriteFile(mx.LockPath(), []byte(fmt.Sprintf("%d\n", timestamp)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(mx.LockPath(), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Now().Add(-time.Minute)
+	write(1000000000000, modTime)
+	if got, _ := r.timestamp(mx, mx.LockPath()); got != 1000000000000 {
+		t.Fatalf("wrong timestamp %d instead of %d", got, 1000000000000)
+	}
+	// Same size and modification time - the contents are not read again
+	write(2000000000000, modTime)
+	if got, _ := r.timestamp(mx, mx.LockPath()); got != 1000000000000 {
+		t.Fatalf("wrong cached timestamp %d instead of %d", got, 1000000000000)
+	}
+	write(3000000000000, time.Now())
+	if got, _ := r.timestamp(mx, mx.LockPath()); got != 3000000000000 {
+		t.Fatalf("wrong timestamp %d instead of %d", got, 3000000000000)
+	}
+}
+
+func TestStale(t *testing.T) {
+	const mutexId = "stale-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	mx, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mx.Stale() {
+		t.Fatal("an unlocked mutex cannot be stale")
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if mx.Stale() {
+		t.Fatal("a freshly locked mutex cannot be stale")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if !mx.Stale() {
+		t.Fatal("a lock not refreshed longer than its lease should be stale")
+	}
+}
+
+func TestStealThreshold(t *testing.T) {
+	const mutexId = "steal-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	old, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	lost := old.KeepAlive(context.Background())
+	patient, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, time.Hour,
+		WithStealThreshold(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patient.TryLock(100 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	preempting, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, time.Hour,
+		WithStealThreshold(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := preempting.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer preempting.Unlock()
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrLockLost) {
+			t.Fatalf("wrong error %v instead of %v", err, ErrLockLost)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the preempted holder did not lose the lock")
+	}
+}
+
+func TestHolderRefresh(t *testing.T) {
+	const mutexId = "holder-refresh-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	holder, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 200*time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer holder.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	holder.KeepAlive(ctx)
+	if md, err := holder.Metadata(); err != nil || time.Duration(md.Refresh) != 200*time.Millisecond {
+		t.Fatalf("wrong metadata %+v (%v), expected refresh %v", md, err, 200*time.Millisecond)
+	}
+	checks := 0
+	// Its dead timeout is shorter than the refresh period of the holder
+	waiter, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 20*time.Millisecond, 100*time.Millisecond,
+		WithAttemptEvents(), WithEventHandler(func(e Event) {
+			if e.Kind == EventStaleCheck {
+				checks++
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.TryLock(700 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	if checks > 5 {
+		t.Fatalf("too many staleness checks: %d, expected one per refresh of the holder", checks)
+	}
+}
+
+func TestNoRecovery(t *testing.T) {
+	const mutexId = "strict-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	var events []Event
+	onEvent := WithEventHandler(func(e Event) { events = append(events, e) })
+	strict, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 50*time.Millisecond, 100*time.Millisecond,
+		WithNoRecovery(), onEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(strict.LockPath(), []byte(fmt.Sprintf("%d\n", now())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.TryLock(2 * time.Second); !errors.Is(err, ErrStaleLock) {
+		t.Fatalf("wrong result %v instead of %v", err, ErrStaleLock)
+	}
+	if _, err := os.Stat(strict.LockPath()); err != nil {
+		t.Fatalf("the stale lock has been broken: %v", err)
+	}
+	if len(events) != 1 || events[0].Kind != EventStaleFound {
+		t.Fatalf("wrong events: %v", events)
+	}
+	if found := strict.Stats().StaleFound; found != 1 {
+		t.Fatalf("wrong number of stale locks found %d instead of 1", found)
+	}
+
+	// A negative dead timeout disables checks for staleness: the lock is neither broken nor reported
+	events = nil
+	unchecked, err := NewMutexExt(mutexRoot, mutexId, 10*time.Millisecond, 50*time.Millisecond, -1, onEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unchecked.TryLock(300 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	if _, err := os.Stat(unchecked.LockPath()); err != nil {
+		t.Fatalf("the stale lock has been broken: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("wrong events: %v", events)
+	}
+	if unchecked.Stale() {
+		t.Fatal("no lock is stale with a negative dead timeout")
+	}
+}
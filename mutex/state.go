@@ -0,0 +1,138 @@
+package mutex
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// A stateTemplate defines name template of the file keeping the value of a State.
+const stateTemplate = "%s-mutex.state"
+
+// A Codec encodes and decodes values of a State, see JSONCodec and GobCodec.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values of a State as indented JSON, so they can be read by humans and shell scripts.
+var JSONCodec Codec = jsonCodec{}
+
+// GobCodec encodes values of a State with encoding/gob.
+var GobCodec Codec = gobCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// A State is a small value shared by processes (possibly on different hosts), like a configuration
+// or a progress of a job, kept in a file in the directory of the State's Mutex, which guards its updates.
+// The file is replaced atomically, so it can be read at any time without locking.
+// Like a Mutex, a State instance is used by a single process; each process creates its own.
+type State struct {
+	m     *Mutex
+	codec Codec
+}
+
+// NewState creates a State with given id under root, with values encoded by the codec (JSONCodec, if nil).
+func NewState(root string, id string, codec Codec, opts ...Option) (*State, error) {
+	m, err := NewMutex(root, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newState(m, codec), nil
+}
+
+// State creates a State with given id, using the Manager's configuration, see NewState.
+func (mgr *Manager) State(id string, codec Codec) (*State, error) {
+	m, err := mgr.Mutex(id)
+	if err != nil {
+		return nil, err
+	}
+	return newState(m, codec), nil
+}
+
+func newState(m *Mutex, codec Codec) *State {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &State{m: m, codec: codec}
+}
+
+// Path returns the path of the file keeping the value of the State.
+func (s *State) Path() string {
+	return path.Join(s.m.directory, expandTemplate(stateTemplate, s.m.name()))
+}
+
+// Load decodes the current value of the State into v, which should be a pointer, without locking.
+// If the State has not been saved yet, v is left as it is.
+func (s *State) Load(v interface{}) error {
+	data, err := ioutil.ReadFile(s.Path())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("cannot decode state %s: %w", s.m.id, err)
+	}
+	return nil
+}
+
+// Update locks the Mutex of the State, waiting until the context is done (ErrExpired), loads the value
+// of the State into v (see Load), calls fn to modify it and saves v, then unlocks the Mutex.
+// If fn returns an error, the value is not saved and the error is returned. Typically, fn modifies
+// the variable v points to:
+//
+//	var progress struct{ Runs int }
+//	err := state.Update(ctx, &progress, func() error { progress.Runs++; return nil })
+func (s *State) Update(ctx context.Context, v interface{}, fn func() error) (err error) {
+	if err := s.m.LockWithContext(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := s.m.TryUnlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	if err := s.Load(v); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cannot encode state %s: %w", s.m.id, err)
+	}
+	return s.m.replaceFile(s.Path(), data)
+}
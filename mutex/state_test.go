@@ -0,0 +1,66 @@
+package mutex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	const stateId = "state-test"
+	type progress struct {
+		Runs int
+		Last string
+	}
+	mutexRoot := temporaryCatalog(t)
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Each process creates its own State
+				s, err := NewState(mutexRoot, stateId, codec)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				s.m.pulse = 10 * time.Millisecond
+				var p progress
+				if err := s.Update(context.Background(), &p, func() error {
+					p.Runs++
+					p.Last = "worker"
+					return nil
+				}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		s, err := NewState(mutexRoot, stateId, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p progress
+		if err := s.Load(&p); err != nil || p.Runs != 5 {
+			t.Fatalf("wrong state %+v (%v) instead of %d runs", p, err, 5)
+		}
+		failure := errors.New("failure")
+		if err := s.Update(context.Background(), &p, func() error {
+			p.Runs = 0
+			return failure
+		}); err != failure {
+			t.Fatalf("wrong result of Update: %v instead of %v", err, failure)
+		}
+		p = progress{}
+		if err := s.Load(&p); err != nil || p.Runs != 5 {
+			t.Fatalf("wrong state %+v (%v) after a failed update instead of %d runs", p, err, 5)
+		}
+		if !s.m.When().IsZero() {
+			t.Fatal("mutex of the state should be unlocked")
+		}
+		removeIfPossible(s.Path())
+	}
+}
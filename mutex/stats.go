@@ -0,0 +1,92 @@
+package mutex
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Stats are contention statistics of a Mutex.
+type Stats struct {
+	Attempts     uint64        // Attempts to create the lock file
+	Acquisitions uint64        // Successful acquisitions
+	Wait         time.Duration // Total time spent waiting for the Mutex
+	Steals       uint64        // Locks broken or replaced by others while held
+	StaleFound   uint64        // Stale locks of others found, but not broken, see WithNoRecovery
+	WaitTimes    Histogram     // Time waited for successful acquisitions
+}
+
+// A statsCounter accumulates Stats of one or more Mutex instances of the same id.
+type statsCounter struct {
+	mx    sync.Mutex
+	stats Stats
+}
+
+func (c *statsCounter) update(fn func(s *Stats)) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	fn(&c.stats)
+}
+
+func (c *statsCounter) get() Stats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.stats
+}
+
+// Stats returns contention statistics of the Mutex. Mutexes created by a Manager
+// share statistics with other mutexes of the same id created by the Manager.
+func (m *Mutex) Stats() Stats {
+	return m.stats.get()
+}
+
+// Stats returns contention statistics of mutexes created by the Manager, by id.
+func (mgr *Manager) Stats() map[string]Stats {
+	mgr.statsMx.Lock()
+	defer mgr.statsMx.Unlock()
+	result := make(map[string]Stats, len(mgr.stats))
+	for id, c := range mgr.stats {
+		result[id] = c.get()
+	}
+	return result
+}
+
+// statsCounter returns the statistics shared by mutexes of the id created by the Manager.
+func (mgr *Manager) statsCounter(id string) *statsCounter {
+	mgr.statsMx.Lock()
+	defer mgr.statsMx.Unlock()
+	if mgr.stats == nil {
+		mgr.stats = make(map[string]*statsCounter)
+	}
+	c, ok := mgr.stats[id]
+	if !ok {
+		c = &statsCounter{}
+		mgr.stats[id] = c
+	}
+	return c
+}
+
+// markHeld remembers the lock file of the just acquired Mutex, so its steal can be detected.
+func (m *Mutex) markHeld() {
+	m.held, _ = os.Stat(m.LockPath())
+	registerHeld(m)
+}
+
+// isHeld reports whether the Mutex holds its lock.
+func (m *Mutex) isHeld() bool {
+	m.releaseMx.Lock()
+	defer m.releaseMx.Unlock()
+	return m.held != nil
+}
+
+// checkStolen counts a steal, if the lock file held by the Mutex has been removed or replaced.
+func (m *Mutex) checkStolen() {
+	if m.held == nil {
+		return
+	}
+	unregisterHeld(m)
+	if current, err := os.Stat(m.LockPath()); err != nil || !os.SameFile(m.held, current) {
+		m.stats.update(func(s *Stats) { s.Steals++ })
+	}
+	m.held = nil
+}
@@ -0,0 +1,107 @@
+package mutex
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManagerExt(mutexRoot, 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := mgr.Mutex("hot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mgr.Mutex("hot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Lock()
+	if err := second.TryLock(50 * time.Millisecond); err != ErrExpired {
+		t.Fatalf("wrong result %v instead of ErrExpired", err)
+	}
+	// The lock gets broken and taken by someone else
+	if err := os.Remove(first.LockPath()); err != nil {
+		t.Fatal(err)
+	}
+	thief := newTestMutex(mutexRoot, "hot")
+	thief.Lock()
+	thief.Unlock()
+	if err := first.TryUnlock(); err == nil {
+		t.Fatal("TryUnlock of a stolen lock should fail")
+	}
+	second.Lock()
+	second.Unlock()
+
+	stats := mgr.Stats()["hot"]
+	if stats.Acquisitions != 2 {
+		t.Fatalf("wrong number of acquisitions %d instead of 2", stats.Acquisitions)
+	}
+	if stats.Attempts != 2 {
+		t.Fatalf("wrong number of attempts %d instead of 2", stats.Attempts)
+	}
+	if stats.Wait < 50*time.Millisecond {
+		t.Fatalf("wrong wait time %v, expected at least %v", stats.Wait, 50*time.Millisecond)
+	}
+	if stats.Steals != 1 {
+		t.Fatalf("wrong number of steals %d instead of 1", stats.Steals)
+	}
+	if first.Stats() != stats {
+		t.Fatalf("wrong stats %+v instead of %+v", first.Stats(), stats)
+	}
+
+	single := newTestMutex(mutexRoot, "single")
+	single.Lock()
+	single.Unlock()
+	if s := single.Stats(); s.Acquisitions != 1 || s.Attempts != 1 || s.Steals != 0 {
+		t.Fatalf("wrong stats %+v", s)
+	}
+}
+
+func TestWaitHistogram(t *testing.T) {
+	var h Histogram
+	if got := h.Percentile(0.99); got != 0 {
+		t.Fatalf("wrong percentile of an empty histogram %v instead of 0", got)
+	}
+	for i := 0; i < 98; i++ {
+		h.observe(3 * time.Millisecond)
+	}
+	h.observe(700 * time.Millisecond)
+	h.observe(3 * time.Second)
+	if got := h.Percentile(0.5); got != 5*time.Millisecond {
+		t.Fatalf("wrong p50 %v instead of %v", got, 5*time.Millisecond)
+	}
+	if got := h.Percentile(0.99); got != time.Second {
+		t.Fatalf("wrong p99 %v instead of %v", got, time.Second)
+	}
+	if got := h.Percentile(1); got != 3*time.Second {
+		t.Fatalf("wrong p100 %v instead of %v", got, 3*time.Second)
+	}
+
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := mgr.Mutex("measured")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	mx.Unlock()
+	if s := mx.Stats(); s.WaitTimes.Count != 1 || s.WaitTimes.Counts[0]+s.WaitTimes.Counts[1] != 1 {
+		t.Fatalf("wrong wait times %+v", s.WaitTimes)
+	}
+	var b strings.Builder
+	if err := mgr.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := `fmutex_wait_seconds_count{id="measured"} 1`; !strings.Contains(b.String(), want) {
+		t.Fatalf("metrics without \"%s\":\n%s", want, b.String())
+	}
+}
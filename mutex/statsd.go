@@ -0,0 +1,102 @@
+package mutex
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStatsdPrefix determines default prefix of names of metrics sent to statsd.
+const DefaultStatsdPrefix = "fmutex"
+
+// A Statsd sends metrics over UDP to a statsd server (or a Datadog agent) in the DogStatsD format:
+// tags are appended as "|#key:value,...", plain statsd servers ignore them. Sending is fire and forget,
+// so an unavailable server never slows the Mutex down.
+type Statsd struct {
+	Addr   string   // Address of the server, e.g. "localhost:8125"
+	Prefix string   // Prefix of metric names, separated by a dot
+	Tags   []string // Tags sent with every metric, e.g. "env:prod"
+	mx     sync.Mutex
+	conn   net.Conn
+}
+
+// NewStatsd creates a Statsd sending metrics to the address, with names prefixed by the prefix
+// (no prefix, if empty) and given tags.
+func NewStatsd(addr string, prefix string, tags ...string) *Statsd {
+	return &Statsd{Addr: addr, Prefix: prefix, Tags: tags}
+}
+
+// WithStatsd makes the Mutex send its metrics to the statsd server at the address, see NewStatsd:
+// the count of acquisitions (acquisitions), time waited for them (wait) and the count of events (events)
+// with the kind of each event as the "kind" tag. All metrics are tagged with the id of the Mutex.
+func WithStatsd(addr string, prefix string, tags ...string) Option {
+	return func(m *Mutex) {
+		m.statsd = NewStatsd(addr, prefix, tags...)
+	}
+}
+
+// Count sends a counter.
+func (s *Statsd) Count(name string, value int64, tags ...string) error {
+	return s.send(name, fmt.Sprintf("%d|c", value), tags)
+}
+
+// Gauge sends a gauge.
+func (s *Statsd) Gauge(name string, value float64, tags ...string) error {
+	return s.send(name, fmt.Sprintf("%g|g", value), tags)
+}
+
+// Timing sends a duration in milliseconds.
+func (s *Statsd) Timing(name string, d time.Duration, tags ...string) error {
+	return s.send(name, fmt.Sprintf("%g|ms", float64(d)/float64(time.Millisecond)), tags)
+}
+
+// Close closes the connection to the server, if any. The Statsd reconnects, if used again.
+func (s *Statsd) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// send sends a single metric with the value already formatted with its type.
+func (s *Statsd) send(name string, value string, tags []string) error {
+	var b strings.Builder
+	if s.Prefix != "" {
+		b.WriteString(statsdNameEscaper.Replace(s.Prefix))
+		b.WriteString(".")
+	}
+	b.WriteString(statsdNameEscaper.Replace(name))
+	b.WriteString(":")
+	b.WriteString(value)
+	for i, tag := range append(append([]string{}, s.Tags...), tags...) {
+		if i == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(statsdEscaper.Replace(tag))
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.conn == nil {
+		conn, err := net.Dial("udp", s.Addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	_, err := s.conn.Write([]byte(b.String()))
+	return err
+}
+
+// statsdEscaper replaces characters delimiting fields of the DogStatsD format in tags.
+var statsdEscaper = strings.NewReplacer("|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
+
+// statsdNameEscaper replaces characters delimiting fields of the DogStatsD format in metric names.
+var statsdNameEscaper = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
@@ -0,0 +1,49 @@
+package mutex
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsd(t *testing.T) {
+	const mutexId = "statsd-test-mutex"
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	mx, err := NewMutex(temporaryCatalog(t), mutexId, WithStatsd(server.LocalAddr().String(), "batch", "env:test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mx.statsd.Close()
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	mx.Unlock()
+	var received []string
+	buf := make([]byte, 1024)
+	for len(received) < 4 {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("missing metrics (%v), received only: %v", err, received)
+		}
+		received = append(received, string(buf[:n]))
+	}
+	for i, expected := range []string{
+		"batch.acquisitions:1|c|#env:test,id:" + mutexId,
+		"batch.wait:",
+		"batch.events:1|c|#env:test,id:" + mutexId + ",kind:acquired",
+		"batch.events:1|c|#env:test,id:" + mutexId + ",kind:released",
+	} {
+		if !strings.HasPrefix(received[i], expected) {
+			t.Fatalf("wrong metric %q instead of %q", received[i], expected)
+		}
+	}
+	if !strings.HasSuffix(received[1], "|ms|#env:test,id:"+mutexId) {
+		t.Fatalf("wrong timing %q", received[1])
+	}
+}
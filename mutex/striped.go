@@ -0,0 +1,42 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// StripedLocks spread arbitrary many keys onto a fixed number of mutexes (stripes),
+// bounding the number of lock files needed by high-cardinality keyed workloads.
+// Different keys may share a stripe, so they exclude each other.
+type StripedLocks struct {
+	stripes []*Mutex
+}
+
+// NewStripedLocks creates n mutexes with ids "name/stripe-0" ... "name/stripe-<n-1>" under root.
+func NewStripedLocks(root string, name string, n int, opts ...Option) (*StripedLocks, error) {
+	if n <= 0 {
+		return nil, errors.New("number of stripes must be positive")
+	}
+	result := &StripedLocks{stripes: make([]*Mutex, n)}
+	for i := range result.stripes {
+		m, err := NewMutex(root, fmt.Sprintf("%s/stripe-%d", name, i), opts...)
+		if err != nil {
+			return nil, err
+		}
+		result.stripes[i] = m
+	}
+	return result, nil
+}
+
+// For returns the Mutex guarding the key.
+func (s *StripedLocks) For(key string) *Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.stripes[h.Sum32()%uint32(len(s.stripes))]
+}
+
+// Len returns the number of stripes.
+func (s *StripedLocks) Len() int {
+	return len(s.stripes)
+}
@@ -0,0 +1,33 @@
+package mutex
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStripedLocks(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	const stripes = 4
+	locks, err := NewStripedLocks(mutexRoot, "customers", stripes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks.Len() != stripes {
+		t.Fatalf("wrong number of stripes %d instead of %d", locks.Len(), stripes)
+	}
+	used := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("customer-%d", i)
+		mx := locks.For(key)
+		if mx != locks.For(key) {
+			t.Fatalf("different stripes for the same key %s", key)
+		}
+		used[mx.Id()] = true
+	}
+	if len(used) != stripes {
+		t.Fatalf("wrong number of used stripes %d instead of %d", len(used), stripes)
+	}
+	if _, err := NewStripedLocks(mutexRoot, "none", 0); err == nil {
+		t.Fatal("zero stripes should be rejected")
+	}
+}
@@ -0,0 +1,75 @@
+package mutex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sweep removes stale locks and orphaned candidates of mutexes matching the pattern (see List):
+// locks not refreshed for longer than olderThan, and candidates not refreshed for longer than olderThan
+// or left by processes of the local host, which do not exist anymore. Stale locks are challenged first
+// and removed only if not refreshed within the grace period (see WithBreakGrace), like by waiters.
+// Removal of a lock is reported as EventStaleBroken. Returns paths of the removed files.
+func (mgr *Manager) Sweep(pattern string, olderThan time.Duration) ([]string, error) {
+	return mgr.SweepSelected(pattern, nil, olderThan)
+}
+
+// SweepSelected sweeps as Sweep, but only locks and candidates with labels matching the selector.
+func (mgr *Manager) SweepSelected(pattern string, selector LabelSelector, olderThan time.Duration) ([]string, error) {
+	ids, err := mgr.List(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, id := range ids {
+		m, err := mgr.Listed(id)
+		if err != nil {
+			return result, err
+		}
+		removed, err := m.sweep(selector, olderThan)
+		result = append(result, removed...)
+		if err != nil {
+			return result, fmt.Errorf("cannot sweep mutex %s: %w", id, err)
+		}
+	}
+	return result, nil
+}
+
+// sweep removes the stale lock and orphaned candidates of the Mutex, see Manager.Sweep.
+func (m *Mutex) sweep(selector LabelSelector, olderThan time.Duration) ([]string, error) {
+	var result []string
+	target := m.LockPath()
+	var reader lockReader
+	if md, _ := reader.read(m, target); md != nil && now()-md.timestamp() > millis(olderThan) &&
+		selector.Matches(md.Labels) {
+		// Challenged as by a waiter, so a holder, which is alive, can veto it
+		if m.breakStale(context.Background(), target, &reader, md.timestamp(), true) {
+			result = append(result, target)
+		}
+	}
+	candidates, err := filepath.Glob(filepath.Join(m.candidateDirectory(), expandTemplate(m.candidateTemplate, m.name())))
+	if err != nil {
+		return result, err
+	}
+	for _, candidate := range candidates {
+		modTime := readModTime(candidate)
+		if modTime == 0 || (now()-modTime <= millis(olderThan) && !m.waiterDead(candidate)) {
+			continue
+		}
+		if len(selector) > 0 {
+			if md, _ := m.readMetadata(candidate); md == nil || !selector.Matches(md.Labels) {
+				continue
+			}
+		}
+		// A candidate still open on an NFS client is not orphaned
+		if err := removeFile(candidate); err == nil {
+			result = append(result, candidate)
+		} else if !os.IsNotExist(err) && !nfsBusy(err) {
+			return result, err
+		}
+	}
+	return result, nil
+}
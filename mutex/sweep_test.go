@@ -0,0 +1,88 @@
+package mutex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	mgr, err := NewManager(temporaryCatalog(t), WithBreakGrace(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := mgr.Mutex("stale-sweep-test-mutex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := mgr.Mutex("fresh-sweep-test-mutex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer fresh.Unlock()
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(stale.LockPath(), []byte(fmt.Sprintf("%d\n", old.UnixNano()/int64(time.Millisecond))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(stale.candidateDirectory(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	candidate := filepath.Join(stale.candidateDirectory(),
+		strings.Replace(expandTemplate(stale.candidateTemplate, stale.name()), "*", "orphan", 1))
+	if err := os.WriteFile(candidate, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(candidate, old, old); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := mgr.Sweep(AllIds, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || removed[0] != stale.LockPath() || removed[1] != candidate {
+		t.Fatalf("wrong removed files: %v", removed)
+	}
+	if fresh.When().IsZero() {
+		t.Fatal("a fresh lock has been swept")
+	}
+}
+
+func TestSweepVetoed(t *testing.T) {
+	mgr, err := NewManager(temporaryCatalog(t), WithBreakGrace(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := mgr.Mutex("vetoed-sweep-test-mutex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(mx.LockPath(), []byte(fmt.Sprintf("%d\n", old.UnixNano()/int64(time.Millisecond))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touched := make(chan struct{})
+	go func() {
+		defer close(touched)
+		// The holder refreshes the lock, once challenged
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(mx.challengePath()); err == nil {
+				mx.Touch()
+				return
+			}
+		}
+	}()
+	removed, err := mgr.Sweep(AllIds, time.Minute)
+	<-touched
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 || mx.When().IsZero() {
+		t.Fatalf("a refreshed lock has been swept: %v", removed)
+	}
+}
@@ -0,0 +1,100 @@
+package mutex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Transplant recreates the directory layout of the Manager's root under the root of dst: all directories,
+// ACL and key files of mutexes, and their fencing token counters, so tokens issued under dst never go back.
+// If held is true, locks currently held are transplanted as well, with their metadata and tokens
+// (see Mutex.Restore). Candidates and lock files of released mutexes are not transplanted.
+// Returns ids of the transplanted mutexes. Both Managers should be configured with the same options,
+// except the layout: transplanting a flat root to a Manager configured WithShardedLayout migrates it.
+func (mgr *Manager) Transplant(dst *Manager, held bool) ([]string, error) {
+	var result []string
+	mode := newConfiguredMutex(dst.opts).dirMode
+	err := filepath.Walk(mgr.base, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Vanished meanwhile
+			}
+			return err
+		}
+		if !info.IsDir() || dir == mgr.base {
+			return nil
+		}
+		if info.Name() == candidatesDirectory || strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(mgr.base, dir)
+		if err != nil {
+			return err
+		}
+		id, ok := mgr.idOf(rel)
+		if !ok {
+			return nil // A shard directory or one not placed by the layout
+		}
+		if err := mkdirAll(dst.base, dst.relDir(id), mode); err != nil {
+			return fmt.Errorf("cannot create directory (%s): %w", id, err)
+		}
+		// Not created with mgr.Mutex, as hashed ids are directory names already
+		src := newConfiguredMutex(mgr.opts)
+		src.id, src.key, src.directory = strings.ToLower(path.Join(src.namespace, id)), id, dir
+		if !fileExists(src.tokenPath()) && !mgr.isMutexDir(dir) {
+			return nil // A namespace only
+		}
+		if err := transplantMutex(src, dst, held); err != nil {
+			return fmt.Errorf("cannot transplant mutex %s: %w", id, err)
+		}
+		result = append(result, id)
+		return nil
+	})
+	return result, err
+}
+
+// transplantMutex transplants the src mutex to dst, see Transplant.
+func transplantMutex(src *Mutex, dst *Manager, held bool) error {
+	key := src.key
+	if b, err := ioutil.ReadFile(src.keyPath()); err == nil {
+		key = strings.TrimSpace(string(b))
+	}
+	m, err := dst.Mutex(key)
+	if err != nil {
+		return err
+	}
+	if b, err := ioutil.ReadFile(src.AclPath()); err == nil {
+		if err := m.replaceFile(m.AclPath(), b); err != nil {
+			return err
+		}
+	}
+	token, err := src.currentToken()
+	if err != nil {
+		return err
+	}
+	if current, err := m.currentToken(); err != nil {
+		return err
+	} else if current < token {
+		if err := m.replaceFile(m.tokenPath(), []byte(fmt.Sprintf("%d\n", token))); err != nil {
+			return err
+		}
+	}
+	if !held {
+		return nil
+	}
+	md, _ := src.Metadata()
+	if md == nil {
+		return nil // Not locked
+	}
+	return m.Restore(md)
+}
+
+// fileExists reports whether the file exists.
+func fileExists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return err == nil
+}
@@ -0,0 +1,77 @@
+package mutex
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCifs()}} {
+		mgr, err := NewManager(path.Join(temporaryCatalog(t), "root"), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mgr.Probe(); err != nil {
+			t.Fatalf("wrong result of Probe(): %v", err)
+		}
+		if entries, err := os.ReadDir(mgr.Root()); err != nil || len(entries) != 0 {
+			t.Fatalf("Probe() left files in the root: %v (%v)", entries, err)
+		}
+	}
+}
+
+func TestTransplant(t *testing.T) {
+	src, err := NewManager(temporaryCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := src.Mutex("tenant/held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	released, err := src.Mutex("tenant/released")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := released.TryLock(time.Second); err != nil {
+			t.Fatalf("TryLock failed (%v), but should succeed.", err)
+		}
+		released.Unlock()
+	}
+	if err := held.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer held.Unlock()
+
+	dst, err := NewManager(temporaryCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := src.Transplant(dst, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "tenant/held" || ids[1] != "tenant/released" {
+		t.Fatalf("wrong transplanted ids: %v", ids)
+	}
+	m, err := dst.Mutex("tenant/released")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := m.currentToken(); err != nil || token != 2 {
+		t.Fatalf("wrong transplanted token %d instead of %d (%v)", token, 2, err)
+	}
+	if !m.When().IsZero() {
+		t.Fatal("a released mutex has been transplanted locked")
+	}
+	m, err = dst.Mutex("tenant/held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md, err := m.Metadata(); err != nil || md.Trace != held.Trace() || md.Token != 1 {
+		t.Fatalf("wrong transplanted lock: %+v (%v)", md, err)
+	}
+}
@@ -0,0 +1,114 @@
+package mutex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode"
+)
+
+// ErrInvalidId is returned when a mutex id is empty, contains empty, "." or ".." components,
+// components starting with "." (reserved for the package) or reaches out of the root through symbolic links.
+// On Windows and WithCifs, components have to be valid names of Windows directories as well, see validateWindowsId,
+// and on Windows, paths of mutexes under UNC roots must not exceed MAX_PATH.
+var ErrInvalidId = errors.New("invalid mutex id")
+
+// ErrInvalidRoot is returned when a mutexes root is empty or cannot be resolved.
+var ErrInvalidRoot = errors.New("invalid mutexes root")
+
+// ErrReadOnlyRoot is returned when a mutex cannot be locked, as its root is mounted read-only
+// or the process is not allowed to write to it. Reading the state of mutexes (see Peek) still works.
+var ErrReadOnlyRoot = errors.New("mutexes root is read-only")
+
+// readOnly reports whether the error of a file operation has been caused by a read-only filesystem
+// or by missing permissions.
+func readOnly(err error) bool {
+	return errors.Is(err, syscall.EROFS) || os.IsPermission(err)
+}
+
+// resolveRoot returns the absolute root with symbolic links resolved, so it cannot be redirected
+// later by replacing a link. A root which does not exist yet is only cleaned.
+func resolveRoot(root string) (string, error) {
+	if strings.TrimSpace(root) == "" {
+		return "", fmt.Errorf("%w: empty root", ErrInvalidRoot)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidRoot, root, err)
+	}
+	if resolved, err := evalSymlinks(root); err == nil {
+		return resolved, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidRoot, root, err)
+	}
+	return root, nil
+}
+
+// validateId checks the id of a mutex directory relative to the root.
+func validateId(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidId)
+	}
+	if strings.ContainsRune(id, 0) || strings.Contains(id, `\`) {
+		return fmt.Errorf("%w: \"%s\" contains forbidden characters", ErrInvalidId, id)
+	}
+	for _, component := range strings.Split(id, namespaceSeparator) {
+		if component == "" || strings.HasPrefix(component, ".") {
+			return fmt.Errorf("%w: \"%s\" contains an empty or dot component", ErrInvalidId, id)
+		}
+	}
+	return nil
+}
+
+// windowsDevices are names reserved for devices on Windows: a file or a directory named so,
+// with any extension, opens the device instead.
+var windowsDevices = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true, "conin$": true, "conout$": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true,
+	"com9": true, "lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true,
+	"lpt8": true, "lpt9": true,
+}
+
+// validateWindowsId checks components of the id are valid names of Windows directories: they are not
+// reserved device names (like "CON" or "nul.txt"), do not end with a dot or a space, which Windows strips,
+// and do not contain characters forbidden on Windows, like ":" denoting an alternate data stream.
+func validateWindowsId(id string) error {
+	for _, component := range strings.Split(id, namespaceSeparator) {
+		if strings.ContainsAny(component, `<>:"|?*`) || strings.IndexFunc(component, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%w: \"%s\" contains characters forbidden on Windows", ErrInvalidId, id)
+		}
+		if strings.HasSuffix(component, ".") || strings.HasSuffix(component, " ") {
+			return fmt.Errorf("%w: \"%s\" contains a component ending with a dot or a space", ErrInvalidId, id)
+		}
+		device := strings.ToLower(strings.TrimRight(strings.SplitN(component, ".", 2)[0], " "))
+		if windowsDevices[device] {
+			return fmt.Errorf("%w: \"%s\" contains a name reserved on Windows (%s)", ErrInvalidId, id, component)
+		}
+	}
+	return nil
+}
+
+// checkContained checks the existing part of the directory does not lead out of the root through symbolic links.
+func checkContained(root string, dir string) error {
+	existing := dir
+	for existing != root {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if _, err := os.Lstat(existing); os.IsNotExist(err) {
+		return nil // Not created yet
+	}
+	resolved, err := evalSymlinks(existing)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s: %v", ErrInvalidId, existing, err)
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s leads out of the root %s", ErrInvalidId, dir, root)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInvalidIds(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	for _, id := range []string{"", "/", "a//b", "a/../../etc", "..", "a/./b", "a/.candidates", `a\b`} {
+		if _, err := NewMutex(mutexRoot, id); !errors.Is(err, ErrInvalidId) {
+			t.Fatalf("wrong error of NewMutex for id \"%s\": %v instead of %v", id, err, ErrInvalidId)
+		}
+	}
+	if _, err := NewMutex(mutexRoot, "tenant/jobs/nightly.v2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMutex(" ", "test-mutex"); !errors.Is(err, ErrInvalidRoot) {
+		t.Fatalf("wrong error of NewMutex for an empty root: %v instead of %v", err, ErrInvalidRoot)
+	}
+}
+
+func TestSymlinkEscape(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	outside := temporaryCatalog(t)
+	if err := os.Symlink(outside, filepath.Join(mutexRoot, "escape")); err != nil {
+		t.Skipf("cannot create symbolic link: %v", err)
+	}
+	if _, err := NewMutex(mutexRoot, "escape/test-mutex"); !errors.Is(err, ErrInvalidId) {
+		t.Fatalf("wrong error of NewMutex: %v instead of %v", err, ErrInvalidId)
+	}
+	link := filepath.Join(outside, "root")
+	if err := os.Symlink(mutexRoot, link); err != nil {
+		t.Fatal(err)
+	}
+	mx, err := NewMutex(link, "test-mutex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved, _ := filepath.EvalSymlinks(mutexRoot); filepath.Dir(mx.LockPath()) != filepath.Join(resolved, "test-mutex") {
+		t.Fatalf("wrong lock path %s, root not pinned to %s", mx.LockPath(), resolved)
+	}
+}
+
+func TestReadOnlyRoot(t *testing.T) {
+	const mutexId = "read-only-test-mutex"
+	if !readOnly(&os.PathError{Op: "mkdir", Path: "/ro", Err: syscall.EROFS}) || !readOnly(os.ErrPermission) {
+		t.Fatal("read-only filesystem and permission errors should be recognized")
+	}
+	if readOnly(os.ErrNotExist) {
+		t.Fatal("a missing file is not a read-only root")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	mutexRoot := temporaryCatalog(t)
+	locked := newTestMutex(mutexRoot, mutexId)
+	if err := locked.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer locked.Unlock()
+	if err := os.Chmod(mutexRoot, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(mutexRoot, 0700)
+	if _, err := NewMutex(mutexRoot, "other-test-mutex"); !errors.Is(err, ErrReadOnlyRoot) {
+		t.Fatalf("wrong result %v instead of %v", err, ErrReadOnlyRoot)
+	}
+	if err := os.Chmod(locked.directory, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked.directory, 0700)
+	if _, err := NewMutex(mutexRoot, mutexId); !errors.Is(err, ErrReadOnlyRoot) {
+		t.Fatalf("wrong result %v instead of %v", err, ErrReadOnlyRoot)
+	}
+	if info, err := Peek(mutexRoot, mutexId); err != nil || info.State != StateLocked {
+		t.Fatalf("wrong state %v (%v) instead of %v", info.State, err, StateLocked)
+	}
+}
+
+func TestWindowsIds(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	for _, id := range []string{"CON", "tenant/nul", "tenant/Com1.lock", "lpt9 .txt/jobs", "a:stream", "a/b.", "a/b ", `a/b?`} {
+		if _, err := NewMutex(mutexRoot, id, WithCifs()); !errors.Is(err, ErrInvalidId) {
+			t.Fatalf("wrong error of NewMutex for id \"%s\": %v instead of %v", id, err, ErrInvalidId)
+		}
+	}
+	for _, id := range []string{"console", "tenant/com10", "nullable/jobs", "a/b.c"} {
+		if _, err := NewMutex(mutexRoot, id, WithCifs()); err != nil {
+			t.Fatalf("NewMutex failed for id \"%s\" (%v), but should succeed.", id, err)
+		}
+	}
+	if !windowsNames {
+		if _, err := NewMutex(mutexRoot, "tenant/con"); err != nil {
+			t.Fatalf("NewMutex failed (%v), but should succeed without WithCifs.", err)
+		}
+	}
+}
+
+func TestLongIds(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mgr, err := NewManager(mutexRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	component := strings.Repeat("x", 60)
+	id := strings.Join([]string{component, component, component, component, component}, "/")
+	mx, err := mgr.Mutex(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mx.LockPath()) <= 260 {
+		t.Fatalf("wrong length of the lock path %d, should exceed %d", len(mx.LockPath()), 260)
+	}
+	if err := mx.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	defer mx.Unlock()
+	if ids, err := mgr.List(AllIds); err != nil || len(ids) != 1 || ids[0] != id {
+		t.Fatalf("wrong result of List: %v (%v) instead of [%s]", ids, err, id)
+	}
+	if _, err := NewMutexForPath(mutexRoot, filepath.Join(mx.directory, "target")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Waiters returns the number of processes waiting for the Mutex, i.e. the number of live candidate files.
+// A candidate file is live, if it has been refreshed within the last three refresh periods of the Mutex
+// and it has not been left by a process of the local host, which does not exist anymore.
+func (m *Mutex) Waiters() (int, error) {
+	candidates, err := filepath.Glob(filepath.Join(m.candidateDirectory(), expandTemplate(m.candidateTemplate, m.name())))
+	if err != nil {
+		return 0, err
+	}
+	result := 0
+	for _, candidate := range candidates {
+		if modTime := readModTime(candidate); modTime > 0 && now()-modTime <= millis(3*m.refresh) &&
+			!m.waiterDead(candidate) {
+			result++
+		}
+	}
+	return result, nil
+}
+
+// waiterDead reports whether the candidate file has been created by a process of the local host,
+// which does not exist anymore.
+func (m *Mutex) waiterDead(candidate string) bool {
+	md, err := m.readMetadata(candidate)
+	if md == nil || (err != nil && !errors.Is(err, ErrInvalidSignature)) || md.Holder.Pid <= 0 {
+		return false
+	}
+	host, _ := os.Hostname()
+	return (m.dotLock || md.Holder.Host == host) && !processAlive(md.Holder.Pid)
+}
@@ -0,0 +1,49 @@
+package mutex
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaiters(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	mx := newTestMutex(mutexRoot, "waiters-test")
+	if n, err := mx.Waiters(); err != nil || n != 0 {
+		t.Fatalf("wrong waiters %d, %v instead of 0", n, err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	const waiters = 2
+	done := make(chan struct{}, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			w, err := NewMutexExt(mutexRoot, "waiters-test", 10*time.Millisecond, DefaultRefresh, DefaultDeadTimeout)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := w.LockWithContext(ctx); err != ErrExpired {
+				t.Errorf("wrong result %v instead of ErrExpired", err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	n := 0
+	for n != waiters && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		n, _ = mx.Waiters()
+	}
+	cancel()
+	for i := 0; i < waiters; i++ {
+		<-done
+	}
+	if n != waiters {
+		t.Fatalf("wrong number of waiters %d instead of %d", n, waiters)
+	}
+	if n, _ := mx.Waiters(); n != 0 {
+		t.Fatalf("wrong number of waiters %d instead of 0 after cancellation", n)
+	}
+}
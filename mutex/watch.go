@@ -0,0 +1,28 @@
+package mutex
+
+import (
+	"context"
+	"time"
+)
+
+// waitUntil waits until the condition holds or the context is done (ErrExpired). The condition is checked
+// on each change of the directory notified by the file system, if supported (see watchDirectory), and every
+// pulse of the Mutex, as changes made by other hosts of a network file system are not notified.
+func (m *Mutex) waitUntil(ctx context.Context, dir string, condition func() (bool, error)) error {
+	changes, stop := watchDirectory(dir)
+	defer stop()
+	ticker := time.NewTicker(m.pulse)
+	defer ticker.Stop()
+	for {
+		// Checked after the watch has started, so no change is missed
+		if ok, err := condition(); err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ErrExpired
+		case <-changes:
+		case <-ticker.C:
+		}
+	}
+}
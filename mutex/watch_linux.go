@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package mutex
+
+import (
+	"os"
+	"syscall"
+)
+
+// watchedChanges are inotify events of files created, removed, renamed or rewritten in a watched directory.
+const watchedChanges = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB
+
+// watchDirectory starts watching the directory with inotify. It returns a channel receiving a value
+// (coalesced) on changes of files in the directory and a function stopping the watch. If the directory
+// cannot be watched, the channel never receives anything.
+func watchDirectory(dir string) (<-chan struct{}, func()) {
+	changes := make(chan struct{}, 1)
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return changes, func() {}
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, watchedChanges); err != nil {
+		syscall.Close(fd)
+		return changes, func() {}
+	}
+	// Non-blocking, so reads wait in the runtime poller and are interrupted by closing the file
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, func() { f.Close() }
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package mutex
+
+// watchDirectory would start watching the directory, but changes are not notified on this platform,
+// so waiters rely on checking every pulse. The returned channel never receives anything.
+func watchDirectory(dir string) (<-chan struct{}, func()) {
+	return make(chan struct{}), func() {}
+}
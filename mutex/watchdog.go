@@ -0,0 +1,92 @@
+package mutex
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAutoReleased is returned when unlocking a Mutex, which has already been released automatically, see WithMaxHold.
+var ErrAutoReleased = errors.New("released automatically after the maximum hold time")
+
+// WithMaxHoldWarning makes the Mutex report EventHeldTooLong and call the callback (if not nil),
+// when the current process holds the Mutex longer than the threshold. It is reported once per acquisition.
+func WithMaxHoldWarning(threshold time.Duration, callback func(m *Mutex, held time.Duration)) Option {
+	return func(m *Mutex) {
+		m.maxHold = threshold
+		m.maxHoldCallback = callback
+	}
+}
+
+// WithMaxHold makes the Mutex release itself, when the current process holds it longer than maxHold,
+// so a hung holder does not block other processes forever. The release is reported as EventAutoReleased
+// and the callback (if not nil) is called, so the application can abort its work guarded by the Mutex.
+// Unlocking the released Mutex returns ErrAutoReleased.
+func WithMaxHold(maxHold time.Duration, callback func(m *Mutex)) Option {
+	return func(m *Mutex) {
+		m.maxHoldRelease = maxHold
+		m.maxHoldReleased = callback
+	}
+}
+
+// startHoldWatch starts watching the hold time of the just acquired Mutex. The caller has to hold releaseMx.
+func (m *Mutex) startHoldWatch() {
+	m.stopHoldWatch()
+	if m.maxHold > 0 {
+		m.holdTimer = time.AfterFunc(m.maxHold, func() {
+			m.emit(Event{Kind: EventHeldTooLong, Path: m.LockPath()})
+			if m.maxHoldCallback != nil {
+				m.maxHoldCallback(m, m.maxHold)
+			}
+		})
+	}
+	if m.maxHoldRelease > 0 && m.held != nil {
+		trace := m.Trace()
+		m.releaseTimer = time.AfterFunc(m.maxHoldRelease, func() {
+			m.releaseMx.Lock()
+			held := m.held != nil && m.Trace() == trace
+			var err error
+			if held {
+				err = m.release()
+			}
+			released := held && err == nil
+			if released {
+				m.autoReleased = true
+			}
+			m.releaseMx.Unlock()
+			if held {
+				m.released(trace, err)
+			}
+			if released {
+				m.emit(Event{Kind: EventAutoReleased, Path: m.LockPath()})
+				if m.maxHoldReleased != nil {
+					m.maxHoldReleased(m)
+				}
+			}
+		})
+	}
+}
+
+// stopHoldWatch stops watching the hold time of the Mutex.
+func (m *Mutex) stopHoldWatch() {
+	if m.holdTimer != nil {
+		m.holdTimer.Stop()
+		m.holdTimer = nil
+	}
+	if m.releaseTimer != nil {
+		m.releaseTimer.Stop()
+		m.releaseTimer = nil
+	}
+}
+
+// releaseHeld releases the Mutex, if it is held by the current process.
+func (m *Mutex) releaseHeld() {
+	m.releaseMx.Lock()
+	if m.held == nil {
+		m.releaseMx.Unlock()
+		return
+	}
+	trace := m.Trace()
+	err := m.release()
+	m.releaseMx.Unlock()
+	m.released(trace, err)
+}
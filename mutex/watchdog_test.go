@@ -0,0 +1,80 @@
+package mutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxHoldWarning(t *testing.T) {
+	mutexRoot := temporaryCatalog(t)
+	warnings := make(chan time.Duration, 2)
+	heldEvents := make(chan Event, 10)
+	mx, err := NewMutex(mutexRoot, "held-too-long",
+		WithMaxHoldWarning(20*time.Millisecond, func(m *Mutex, held time.Duration) { warnings <- held }),
+		WithEventHandler(func(e Event) {
+			if e.Kind == EventHeldTooLong {
+				heldEvents <- e
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	select {
+	case held := <-warnings:
+		if held != 20*time.Millisecond {
+			t.Fatalf("wrong hold time %v instead of %v", held, 20*time.Millisecond)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing hold warning")
+	}
+	if e := <-heldEvents; e.Id != mx.Id() {
+		t.Fatalf("wrong event id \"%s\" instead of \"%s\"", e.Id, mx.Id())
+	}
+	mx.Unlock()
+
+	mx.Lock()
+	mx.Unlock()
+	select {
+	case <-warnings:
+		t.Fatal("unexpected hold warning after unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMaxHold(t *testing.T) {
+	const mutexId = "max-hold-test-mutex"
+	mutexRoot := temporaryCatalog(t)
+	released := make(chan *Mutex, 1)
+	mx, err := NewMutex(mutexRoot, mutexId, WithMaxHold(20*time.Millisecond, func(m *Mutex) { released <- m }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.Lock()
+	select {
+	case m := <-released:
+		if m != mx {
+			t.Fatal("wrong mutex released")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("mutex not released")
+	}
+	other := newTestMutex(mutexRoot, mutexId)
+	if err := other.TryLock(time.Second); err != nil {
+		t.Fatalf("TryLock failed (%v), but should succeed.", err)
+	}
+	other.Unlock()
+	if err := mx.TryUnlock(); err != ErrAutoReleased {
+		t.Fatalf("wrong result %v instead of %v", err, ErrAutoReleased)
+	}
+
+	mx.Lock()
+	if err := mx.TryUnlock(); err != nil {
+		t.Fatalf("TryUnlock failed (%v), but should succeed.", err)
+	}
+	select {
+	case <-released:
+		t.Fatal("unexpected release after unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
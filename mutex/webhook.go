@@ -0,0 +1,156 @@
+package mutex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultWebhookRetries determines default number of repeated deliveries of a webhook notification.
+const DefaultWebhookRetries = 3
+
+// DefaultWebhookTimeout determines default timeout of a single delivery of a webhook notification.
+const DefaultWebhookTimeout = 5 * time.Second
+
+// DefaultWebhookQueue determines how many events of a Mutex may wait for delivery to its webhook.
+const DefaultWebhookQueue = 100
+
+// ErrWebhookQueueFull is reported when an event has been dropped, as too many events wait for delivery
+// to the webhook, see WithWebhook.
+var ErrWebhookQueueFull = errors.New("webhook queue full")
+
+// A Webhook POSTs events of a Mutex as JSON objects (see Event.MarshalJSON) to a URL.
+type Webhook struct {
+	URL     string
+	Retries int           // Number of repeated deliveries after a failure
+	Backoff time.Duration // Delay before the first repeated delivery, doubled for subsequent ones
+	Client  *http.Client
+
+	mx         sync.Mutex
+	queue      []Event
+	delivering bool
+	failed     func(e Event, err error)
+}
+
+// webhookDeliveries counts events queued for delivery to webhooks of all mutexes, see FlushWebhooks.
+var webhookDeliveries sync.WaitGroup
+
+// NewWebhook creates a Webhook posting to the URL with default retries and timeout.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:     url,
+		Retries: DefaultWebhookRetries,
+		Backoff: time.Second,
+		Client:  &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+}
+
+// WithWebhook makes the Mutex POST its events (acquired, released, stale-broken, held-too-long etc.)
+// to the URL, see NewWebhook. Notifications are queued and delivered in order by a background goroutine,
+// so a slow webhook never delays locking or unlocking; failed ones are retried. Events, which could not
+// be delivered, are reported to the event handler (see WithEventHandler) as EventWebhookFailed.
+// At most DefaultWebhookQueue events wait for delivery, further ones are dropped as failed
+// with ErrWebhookQueueFull. Processes exiting right after unlocking should call FlushWebhooks.
+func WithWebhook(url string) Option {
+	return func(m *Mutex) {
+		m.webhook = NewWebhook(url)
+		m.webhook.failed = func(e Event, err error) {
+			if m.events != nil {
+				m.events(Event{Kind: EventWebhookFailed, Id: e.Id, Time: time.Now(), Path: m.webhook.URL, Err: err,
+					Trace: e.Trace, Info: fmt.Sprintf("event %s not delivered", e.Kind)})
+			}
+		}
+	}
+}
+
+// FlushWebhooks waits until events queued for delivery to webhooks of all mutexes (see WithWebhook)
+// have been delivered or have failed, or until the context is done.
+func FlushWebhooks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		webhookDeliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue queues the event for delivery by the background goroutine, which is started if not running.
+func (w *Webhook) enqueue(e Event) {
+	w.mx.Lock()
+	if len(w.queue) >= DefaultWebhookQueue {
+		w.mx.Unlock()
+		if w.failed != nil {
+			w.failed(e, ErrWebhookQueueFull)
+		}
+		return
+	}
+	webhookDeliveries.Add(1)
+	w.queue = append(w.queue, e)
+	if !w.delivering {
+		w.delivering = true
+		go w.deliver()
+	}
+	w.mx.Unlock()
+}
+
+// deliver delivers queued events in order, until the queue is empty.
+func (w *Webhook) deliver() {
+	for {
+		w.mx.Lock()
+		if len(w.queue) == 0 {
+			w.delivering = false
+			w.mx.Unlock()
+			return
+		}
+		e := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mx.Unlock()
+		if err := w.Notify(e); err != nil && w.failed != nil {
+			w.failed(e, err)
+		}
+		webhookDeliveries.Done()
+	}
+}
+
+// Notify delivers the event, retrying failed deliveries. Returns the error of the last delivery.
+func (w *Webhook) Notify(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = w.post(body); err == nil || attempt >= w.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post delivers a single notification.
+func (w *Webhook) post(body []byte) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", w.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package mutex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	kinds := make(chan string, 10)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e struct {
+			Kind string `json:"kind"`
+			Id   string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("cannot decode event: %v", err)
+		}
+		if e.Id != "webhook-test" {
+			t.Errorf("wrong id \"%s\" instead of \"webhook-test\"", e.Id)
+		}
+		kinds <- e.Kind
+	}))
+	defer server.Close()
+
+	mx, err := NewMutex(temporaryCatalog(t), "webhook-test", WithWebhook(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx.webhook.Backoff = time.Millisecond
+	mx.Lock()
+	mx.Unlock()
+	for _, expected := range []EventKind{EventAcquired, EventReleased} {
+		if kind := <-kinds; kind != expected.String() {
+			t.Fatalf("wrong event \"%s\" instead of \"%s\"", kind, expected)
+		}
+	}
+
+	failures = 10
+	w := NewWebhook(server.URL)
+	w.Retries, w.Backoff = 2, time.Millisecond
+	if err := w.Notify(Event{Kind: EventAcquired}); err == nil {
+		t.Fatal("failed delivery should be reported")
+	}
+	if failures != 7 {
+		t.Fatalf("wrong number of deliveries %d instead of 3", 10-failures)
+	}
+}
+
+func TestWebhookFailed(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var mx sync.Mutex
+	var failed []Event
+	handler := func(e Event) {
+		if e.Kind == EventWebhookFailed {
+			mx.Lock()
+			failed = append(failed, e)
+			mx.Unlock()
+		}
+	}
+	m, err := NewMutex(temporaryCatalog(t), "webhook-test", WithWebhook(server.URL), WithEventHandler(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.webhook.Retries = 0
+	// Locking and unlocking do not wait for the blocked webhook
+	for i := 0; i < DefaultWebhookQueue; i++ {
+		m.Lock()
+		m.Unlock()
+	}
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := FlushWebhooks(ctx); err != nil {
+		t.Fatalf("FlushWebhooks failed (%v), but should succeed.", err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if len(failed) != 2*DefaultWebhookQueue {
+		t.Fatalf("wrong number of failed events %d instead of %d", len(failed), 2*DefaultWebhookQueue)
+	}
+	full := 0
+	for _, e := range failed {
+		if errors.Is(e.Err, ErrWebhookQueueFull) {
+			full++
+		}
+	}
+	if full < DefaultWebhookQueue-1 {
+		t.Fatalf("wrong number of dropped events %d instead of at least %d", full, DefaultWebhookQueue-1)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package mutex
+
+// checkWritable returns an error, if the process cannot create files in the directory.
+// Not supported on this platform, so failures are detected only when creating files.
+func checkWritable(dir string) error {
+	return nil
+}
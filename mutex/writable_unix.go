@@ -0,0 +1,15 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package mutex
+
+import "syscall"
+
+// accessWrite is the W_OK mode of access(2).
+const accessWrite = 0x2
+
+// checkWritable returns an error, if the process cannot create files in the directory,
+// e.g. as it is on a read-only filesystem.
+func checkWritable(dir string) error {
+	return syscall.Access(dir, accessWrite)
+}
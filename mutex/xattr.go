@@ -0,0 +1,9 @@
+package mutex
+
+import "errors"
+
+// A timestampXattr is the name of the extended attribute keeping the timestamp, see WithXattrMetadata.
+const timestampXattr = "user.fmutex.timestamp"
+
+// ErrXattrUnsupported is returned when extended attributes are not supported on given platform.
+var ErrXattrUnsupported = errors.New("extended attributes are not supported")
@@ -0,0 +1,19 @@
+package mutex
+
+import "syscall"
+
+func setXattr(fileName string, name string, value []byte) error {
+	return syscall.Setxattr(fileName, name, value, 0)
+}
+
+func getXattr(fileName string, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(fileName, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Getxattr(fileName, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package mutex
+
+func setXattr(fileName string, name string, value []byte) error {
+	return ErrXattrUnsupported
+}
+
+func getXattr(fileName string, name string) ([]byte, error) {
+	return nil, ErrXattrUnsupported
+}
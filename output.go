@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+const (
+	OutputText = "text"
+	OutputCsv  = "csv"
+	OutputTsv  = "tsv"
+	OutputJson = "json"
+)
+
+// outputColumns are the columns of states of mutexes written in the csv and tsv formats.
+var outputColumns = []string{"id", "state", "holder", "age", "waiters"}
+
+// An outputRecord is a state of a mutex in the json format (JSON lines).
+type outputRecord struct {
+	Id      string `json:"id"`
+	State   string `json:"state"`
+	Holder  string `json:"holder,omitempty"`
+	Age     int64  `json:"age"` // In seconds
+	Waiters int    `json:"waiters"`
+}
+
+// An infoWriter writes states of mutexes in the csv, tsv or json format, see -output.
+type infoWriter struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+// newInfoWriter returns an infoWriter writing to w in the format, which is not OutputText.
+// In the csv and tsv formats, the header is written at once.
+func newInfoWriter(w io.Writer, format string) (*infoWriter, error) {
+	result := &infoWriter{w: w}
+	if format == OutputCsv || format == OutputTsv {
+		result.csv = csv.NewWriter(w)
+		if format == OutputTsv {
+			result.csv.Comma = '\t'
+		}
+		if err := result.flush(outputColumns); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// write writes the state of a mutex.
+func (iw *infoWriter) write(info mutex.Info) error {
+	record := outputRecord{Id: info.Id, State: info.State, Waiters: info.Waiters}
+	if info.State != mutex.StateUnlocked {
+		record.Holder, record.Age = info.Holder.String(), int64(info.Age/time.Second)
+	}
+	if iw.csv == nil {
+		b, err := json.Marshal(&record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(iw.w, string(b))
+		return err
+	}
+	return iw.flush([]string{record.Id, record.State, record.Holder, strconv.FormatInt(record.Age, 10),
+		strconv.Itoa(record.Waiters)})
+}
+
+// flush writes the row in the csv or tsv format at once, as listed mutexes are streamed, see doList.
+func (iw *infoWriter) flush(row []string) error {
+	if err := iw.csv.Write(row); err != nil {
+		return err
+	}
+	iw.csv.Flush()
+	return iw.csv.Error()
+}
+
+// defineOutputFlags defines flags of commands printing states of mutexes.
+func defineOutputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&out.Format, FlagOutput, out.Format, fmt.Sprintf("output format: \"%s\", \"%s\", \"%s\" or \"%s\" (JSON lines), "+
+		"with columns id, state, holder, age (in seconds) and waiters, except %s", OutputText, OutputCsv, OutputTsv,
+		OutputJson, OutputText))
+}
+
+// checkOutput checks the -output format is known.
+func checkOutput() {
+	switch out.Format {
+	case OutputText, OutputCsv, OutputTsv, OutputJson:
+	default:
+		fatalf(cmn.Id, "Parameter error - unknown output format \"%s\", valid formats are: %s, %s, %s, %s",
+			out.Format, OutputText, OutputCsv, OutputTsv, OutputJson)
+	}
+}
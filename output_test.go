@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+func TestOutput(t *testing.T) {
+	infos := []mutex.Info{
+		{Id: "tenant/jobs", State: mutex.StateLocked, Holder: mutex.Holder{Host: "host-a", Pid: 42},
+			Age: 90 * time.Second, Waiters: 2},
+		{Id: "tenant/idle", State: mutex.StateUnlocked, Waiters: 1},
+	}
+	holder := infos[0].Holder.String()
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{OutputCsv, "id,state,holder,age,waiters\ntenant/jobs,locked," + holder + ",90,2\ntenant/idle,unlocked,,0,1\n"},
+		{OutputTsv, "id\tstate\tholder\tage\twaiters\ntenant/jobs\tlocked\t" + holder + "\t90\t2\ntenant/idle\tunlocked\t\t0\t1\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		iw, err := newInfoWriter(&buf, c.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range infos {
+			if err := iw.write(info); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := buf.String(); got != c.want {
+			t.Fatalf("wrong %s output \"%s\" instead of \"%s\"", c.format, got, c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	iw, err := newInfoWriter(&buf, OutputJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.write(infos[0]); err != nil {
+		t.Fatal(err)
+	}
+	var record outputRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("cannot decode output line \"%s\": %v", buf.String(), err)
+	}
+	if want := (outputRecord{Id: "tenant/jobs", State: mutex.StateLocked, Holder: holder, Age: 90, Waiters: 2}); record != want {
+		t.Fatalf("wrong json output %+v instead of %+v", record, want)
+	}
+}
+
+func TestListOutput(t *testing.T) {
+	cmn.Root = temporaryCatalog(t)
+	cmn.Id = "test-list-output"
+	doLock()
+	defer doUnlock()
+	defer func() { out.Format = OutputText }()
+	for _, format := range []string{OutputCsv, OutputTsv, OutputJson} {
+		out.Format = format
+		if got := doInfo(); got != 0 {
+			t.Fatalf("wrong value of doInfo() => %d instead of %d", got, 0)
+		}
+		cmn.Id = mutex.AllIds
+		if got := doList(); got != 0 {
+			t.Fatalf("wrong value of doList() => %d instead of %d", got, 0)
+		}
+		cmn.Id = "test-list-output"
+	}
+}
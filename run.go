@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// doRun runs the command in its own process group while holding the mutex and returns its exit code
+// (128+n, if it has been killed by signal n). The lock is refreshed while the command runs; if it is lost
+// (e.g. broken as stale or stolen), the command is terminated, so two copies of it never run concurrently.
+// SIGINT and SIGTERM are forwarded to the command, and the mutex is released once all processes
+// of its group have finished; they are terminated as well, if the lock is lost meanwhile.
+// As the group of the command is not the foreground one, interactive commands reading from the terminal
+// are stopped (SIGTTIN), so run is meant for non-interactive commands, e.g. of cron or systemd.
+func doRun(args []string) int {
+	if len(args) == 0 {
+		fatalf(cmn.Id, "Parameter error - expected command to run")
+	}
+	m := newMutex()
+	lockMutex(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := m.KeepAlive(ctx)
+	if rn.SdNotify {
+		notifySystemd(m, "READY=1")
+		defer notifySystemd(m, "STOPPING=1")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		errorf(m.Id(), "Cannot run \"%s\": %v", args[0], err)
+		cancel()
+		unlockMutex(m)
+		return 127
+	}
+	if !isEmptyStr(rn.PidFile) {
+		if err := writePidFile(rn.PidFile, cmd.Process.Pid); err != nil {
+			errorf(m.Id(), "Cannot write PID file \"%s\": %v", rn.PidFile, err)
+		} else {
+			defer os.Remove(rn.PidFile)
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var err error
+	for finished := false; !finished; {
+		select {
+		case err = <-done:
+			finished = true
+		case sig := <-signals:
+			forwardSignal(cmd, sig)
+		case lostErr := <-lost:
+			errorf(m.Id(), "Lock of mutex \"%s\" lost, terminating \"%s\": %v", m.Key(), args[0], lostErr)
+			err = terminate(cmd, done)
+			if code := exitCode(err); code != 0 {
+				return code
+			}
+			return 1
+		}
+	}
+	// Descendants of the command keep running in its group, still guarded by the lock
+	for groupRunning(cmd) {
+		select {
+		case sig := <-signals:
+			forwardSignal(cmd, sig)
+		case lostErr := <-lost:
+			errorf(m.Id(), "Lock of mutex \"%s\" lost, terminating descendants of \"%s\": %v", m.Key(), args[0], lostErr)
+			terminateGroup(cmd)
+			if code := exitCode(err); code != 0 {
+				return code
+			}
+			return 1
+		case <-time.After(groupPollInterval):
+		}
+	}
+	cancel()
+	unlockMutex(m)
+	return exitCode(err)
+}
+
+// terminate sends SIGTERM to the process group of the command and SIGKILL, if it does not finish
+// within the grace period. Returns the result of the command.
+func terminate(cmd *exec.Cmd, done <-chan error) error {
+	signalGroup(cmd, false)
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(rn.Grace):
+		signalGroup(cmd, true)
+		return <-done
+	}
+}
+
+// terminateGroup sends SIGTERM to the process group of the finished command and SIGKILL, if its processes
+// do not finish within the grace period.
+func terminateGroup(cmd *exec.Cmd) {
+	signalGroup(cmd, false)
+	for deadline := time.Now().Add(rn.Grace); groupRunning(cmd); time.Sleep(groupPollInterval) {
+		if time.Now().After(deadline) {
+			signalGroup(cmd, true)
+			return
+		}
+	}
+}
+
+// exitCode returns the exit code of a finished command, following the shell convention of 128+n
+// for commands killed by signal n.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// writePidFile atomically writes the PID to the file, so readers never see it partially written.
+func writePidFile(fileName string, pid int) error {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprintf(f, "%d\n", pid)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fileName)
+	}
+	return err
+}
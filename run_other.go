@@ -0,0 +1,34 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup makes the command run in its own process group. Not supported on this platform.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// signalGroup kills the started command. Process groups and graceful termination are not supported
+// on this platform, so the command is killed regardless of kill.
+func signalGroup(cmd *exec.Cmd, kill bool) error {
+	return cmd.Process.Kill()
+}
+
+// forwardSignal sends the signal to the started command.
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+// groupPollInterval determines how often the process group of a finished command is checked for running processes.
+const groupPollInterval = 50 * time.Millisecond
+
+// groupRunning reports whether a process of the process group of the started command is running.
+// Process groups are not supported on this platform, so it reports false.
+func groupRunning(cmd *exec.Cmd) bool {
+	return false
+}
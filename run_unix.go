@@ -0,0 +1,42 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// groupPollInterval determines how often the process group of a finished command is checked for running processes.
+const groupPollInterval = 50 * time.Millisecond
+
+// setProcessGroup makes the command run in its own process group. The group is not the foreground one
+// of the terminal, so an interactive command is stopped (SIGTTIN) when it reads from the terminal.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends SIGTERM (or SIGKILL, if kill) to the process group of the started command.
+func signalGroup(cmd *exec.Cmd, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// forwardSignal sends the signal to the process group of the started command.
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		return syscall.Kill(-cmd.Process.Pid, s)
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// groupRunning reports whether a process of the process group of the started command is running.
+func groupRunning(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) == nil
+}
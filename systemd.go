@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bry00/fmutex/mutex"
+)
+
+// Environment variables of the systemd notification and socket activation protocols
+const (
+	EnvNotifySocket = "NOTIFY_SOCKET"
+	EnvListenPid    = "LISTEN_PID"
+	EnvListenFds    = "LISTEN_FDS"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation.
+const listenFdsStart = 3
+
+// sdNotify sends the state (e.g. "READY=1") to systemd, if the process runs as a notifying service.
+func sdNotify(state string) error {
+	socket := os.Getenv(EnvNotifySocket)
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notifySystemd sends the state to systemd, if requested by -sd-notify, logging a failure.
+func notifySystemd(m *mutex.Mutex, state string) {
+	if err := sdNotify(state); err != nil {
+		warnf(m.Id(), "Cannot notify systemd (%s): %v", state, err)
+	}
+}
+
+// sdListener returns the listener passed by systemd socket activation, nil if the process has not been
+// activated by a socket.
+func sdListener() (net.Listener, error) {
+	if os.Getenv(EnvListenPid) != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(os.Getenv(EnvListenFds)); err != nil || n < 1 {
+		return nil, nil
+	}
+	f := os.NewFile(listenFdsStart, "LISTEN_FD_"+strconv.Itoa(listenFdsStart))
+	defer f.Close()
+	return net.FileListener(f)
+}
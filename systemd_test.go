@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestSdNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix datagram sockets")
+	}
+	socket := path.Join(temporaryCatalog(t), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer os.Unsetenv(EnvNotifySocket)
+	os.Setenv(EnvNotifySocket, socket)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 64)
+	n, err := conn.Read(b)
+	if err != nil || string(b[:n]) != "READY=1" {
+		t.Fatalf("wrong notification \"%s\" (%v) instead of \"%s\"", string(b[:n]), err, "READY=1")
+	}
+	os.Unsetenv(EnvNotifySocket)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("wrong result of sdNotify() without %s: %v", EnvNotifySocket, err)
+	}
+}
+
+func TestSdListener(t *testing.T) {
+	if l, err := sdListener(); l != nil || err != nil {
+		t.Fatalf("wrong result of sdListener() without socket activation: %v, %v", l, err)
+	}
+}